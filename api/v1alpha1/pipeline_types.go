@@ -10,6 +10,250 @@ type WatchSocket struct {
 	Scheme    string   `json:"scheme"`
 	Stocks    []string `json:"stocks"`
 	Tablename string   `json:"tablename"`
+	// Headers are sent with the websocket handshake
+	Headers map[string]string `json:"headers,omitempty"`
+	// Subscribe is a text/template sent once for each of Items
+	// after connecting, the item is the template's dot
+	Subscribe string   `json:"subscribe,omitempty"`
+	Items     []string `json:"items,omitempty"`
+	// RecordPath is a JSONPath selecting the records within each
+	// message, the whole message is one record when it is empty
+	RecordPath   string       `json:"recordPath,omitempty"`
+	ExtractRules []SocketRule `json:"extractRules,omitempty"`
+}
+
+// SocketRule maps a JSONPath within a socket record to a column
+type SocketRule struct {
+	ColumnName string `json:"columnName"`
+	RuleSource string `json:"ruleSource"`
+}
+
+// HTTPSource is a REST endpoint that is polled on an interval
+type HTTPSource struct {
+	Name            string            `json:"name"`
+	URL             string            `json:"url"`
+	Method          string            `json:"method,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Body            string            `json:"body,omitempty"`
+	IntervalSeconds int               `json:"intervalSeconds"`
+	Tablename       string            `json:"tablename"`
+	Pagination      HTTPPagination    `json:"pagination,omitempty"`
+	// WatermarkColumn is the extract rule column whose greatest
+	// value is kept between polls and sent as WatermarkParam so
+	// only newer records are returned
+	WatermarkColumn string       `json:"watermarkColumn,omitempty"`
+	WatermarkParam  string       `json:"watermarkParam,omitempty"`
+	RecordPath      string       `json:"recordPath,omitempty"`
+	ExtractRules    []SocketRule `json:"extractRules,omitempty"`
+	// Schedule is a cron expression, when set the source is polled
+	// once per scheduled run instead of on IntervalSeconds
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// HTTPPagination describes how an HTTPSource returns more pages
+type HTTPPagination struct {
+	// Type is cursor, page or link, there is a single page when
+	// it is empty
+	Type string `json:"type,omitempty"`
+	// Param is the query parameter holding the cursor or page
+	Param string `json:"param,omitempty"`
+	// CursorPath is a JSONPath to the next cursor in a response
+	CursorPath string `json:"cursorPath,omitempty"`
+	// MaxPages bounds the pages read in one poll
+	MaxPages int `json:"maxPages,omitempty"`
+}
+
+// IngestSource is an HTTP endpoint that callers post records to
+type IngestSource struct {
+	Name      string `json:"name"`
+	Tablename string `json:"tablename"`
+	// Tables are the other tables a gRPC batch may name, a batch
+	// without a table is loaded into Tablename
+	Tables []string `json:"tables,omitempty"`
+	// TokenSecret names the Secret whose token key holds the
+	// bearer token callers must present
+	TokenSecret string `json:"tokenSecret"`
+	// RecordPath and ExtractRules map JSON and NDJSON bodies to
+	// columns, CSV bodies take their columns from the header row
+	RecordPath   string       `json:"recordPath,omitempty"`
+	ExtractRules []SocketRule `json:"extractRules,omitempty"`
+}
+
+// SQLSource is a relational database table or query that is read
+// incrementally on an interval
+type SQLSource struct {
+	Name string `json:"name"`
+	// Driver is the database/sql driver, postgres by default
+	Driver string `json:"driver,omitempty"`
+	// ConnectionSecret names the Secret whose connection key holds
+	// the connection string
+	ConnectionSecret string `json:"connectionSecret"`
+	// Query is read when set, otherwise every column of Table
+	Query string `json:"query,omitempty"`
+	Table string `json:"table,omitempty"`
+	// IncrementalColumn is a timestamp or increasing id, only rows
+	// past its high-water mark are read on each run
+	IncrementalColumn string `json:"incrementalColumn"`
+	IntervalSeconds   int    `json:"intervalSeconds"`
+	Tablename         string `json:"tablename"`
+	// Schedule is a cron expression, when set the source is read
+	// once per scheduled run instead of on IntervalSeconds
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// CDCSource mirrors the changes of an operational database table,
+// either from a CockroachDB changefeed or from a Postgres logical
+// replication slot using the wal2json plugin
+type CDCSource struct {
+	Name string `json:"name"`
+	// Type is cockroachdb or postgres
+	Type string `json:"type"`
+	// ConnectionSecret names the Secret whose connection key holds
+	// the connection string
+	ConnectionSecret string `json:"connectionSecret"`
+	Table            string `json:"table"`
+	// KeyColumns identify a row, updates and deletes replace the
+	// pipeline table rows matching them
+	KeyColumns []string `json:"keyColumns"`
+	// Slot is the postgres replication slot, it is created when
+	// it does not exist
+	Slot      string `json:"slot,omitempty"`
+	Tablename string `json:"tablename"`
+}
+
+// SyslogSource is a syslog listener on churro-watch accepting
+// RFC 5424 and RFC 3164 messages
+type SyslogSource struct {
+	Name string `json:"name"`
+	// Port receives messages over both UDP and TCP
+	Port int `json:"port"`
+	// TLSPort receives messages over TLS using the pipeline service
+	// credentials, TLS is off when it is zero
+	TLSPort   int    `json:"tlsPort,omitempty"`
+	Tablename string `json:"tablename"`
+}
+
+// S3Source is a bucket of an S3 compatible object store, new
+// objects under Prefix are downloaded and extracted with Scheme
+type S3Source struct {
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint"`
+	Region   string `json:"region,omitempty"`
+	Bucket   string `json:"bucket"`
+	Prefix   string `json:"prefix,omitempty"`
+	// PathStyle addresses the bucket in the url path, MinIO needs it
+	PathStyle bool `json:"pathStyle,omitempty"`
+	// CredentialsSecret names the Secret whose accessKeyId and
+	// secretAccessKey keys hold the store credentials, its optional
+	// notifyToken key is the bearer token of bucket notifications
+	CredentialsSecret string `json:"credentialsSecret"`
+	// Regex selects the object keys to extract, all when empty
+	Regex  string `json:"regex,omitempty"`
+	Scheme string `json:"scheme"`
+	// WatchDirectory names the watch directory whose extract rules
+	// apply to the objects, needed by the json and xml schemes
+	WatchDirectory string `json:"watchDirectory,omitempty"`
+	// DownloadPath is where objects are written for extraction,
+	// /churro/objectstore/<name> by default, it must not be watched
+	DownloadPath    string `json:"downloadPath,omitempty"`
+	IntervalSeconds int    `json:"intervalSeconds"`
+	Tablename       string `json:"tablename"`
+}
+
+// SFTPSource is a remote SFTP directory whose new files are
+// downloaded into a watch directory on an interval
+type SFTPSource struct {
+	Name string `json:"name"`
+	// Host is host:port, port 22 is used when it is omitted
+	Host string `json:"host"`
+	User string `json:"user"`
+	Path string `json:"path"`
+	// Glob selects the remote file names, all when empty
+	Glob string `json:"glob,omitempty"`
+	// KeySecret names the Secret whose privateKey key holds the
+	// client key and whose hostKey key holds the server public key
+	// in authorized_keys format
+	KeySecret string `json:"keySecret"`
+	// WatchPath is the watch directory files are downloaded into
+	WatchPath string `json:"watchPath"`
+	// Disposition is delete or rename to remove or rename remote
+	// files once downloaded, they are left in place when empty
+	Disposition     string `json:"disposition,omitempty"`
+	IntervalSeconds int    `json:"intervalSeconds"`
+	// Schedule is a cron expression, when set the remote directory
+	// is listed once per scheduled run instead of on IntervalSeconds
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// FileSource is a static file that is copied into a watch directory
+// on a cron schedule, so a file that is replaced in place, such as a
+// published reference list, is extracted again on each run
+type FileSource struct {
+	Name string `json:"name"`
+	// Path is a local path or an http or https url
+	Path string `json:"path"`
+	// WatchPath is the watch directory the file is copied into, its
+	// regex, scheme and extract rules apply to the copies
+	WatchPath string `json:"watchPath"`
+	Schedule  string `json:"schedule"`
+}
+
+// MQTTSource is a subscription to topics of an MQTT broker, the
+// JSON payloads are mapped to columns by the extract rules
+type MQTTSource struct {
+	Name string `json:"name"`
+	// Broker is the broker url, e.g. tcp://broker:1883 or
+	// ssl://broker:8883
+	Broker string `json:"broker"`
+	// Topics are topic filters and may hold + and # wildcards
+	Topics []string `json:"topics"`
+	// QoS is the subscription quality of service, 0, 1 or 2
+	QoS int `json:"qos,omitempty"`
+	// ClientID is kept across restarts so that a broker holds the
+	// messages of a QoS 1 or 2 subscription while disconnected
+	ClientID string `json:"clientId,omitempty"`
+	// CredentialsSecret optionally names the Secret whose username
+	// and password keys authenticate with the broker
+	CredentialsSecret string `json:"credentialsSecret,omitempty"`
+	// TLSSecret optionally names the Secret whose ca.crt key holds
+	// the broker CA and whose tls.crt and tls.key keys hold a
+	// client certificate
+	TLSSecret          string       `json:"tlsSecret,omitempty"`
+	InsecureSkipVerify bool         `json:"insecureSkipVerify,omitempty"`
+	RecordPath         string       `json:"recordPath,omitempty"`
+	ExtractRules       []SocketRule `json:"extractRules,omitempty"`
+	Tablename          string       `json:"tablename"`
+}
+
+// KafkaSource consumes a topic of a Kafka compatible broker, such
+// as Redpanda, into a table
+type KafkaSource struct {
+	Name    string   `json:"name"`
+	Brokers []string `json:"brokers"`
+	Topic   string   `json:"topic"`
+	// GroupID is the consumer group whose offsets are committed,
+	// churro-<pipeline>-<name> by default
+	GroupID string `json:"groupId,omitempty"`
+	// Format is json or avro
+	Format string `json:"format,omitempty"`
+	// AvroSchema is the writer schema of plain avro payloads
+	AvroSchema string `json:"avroSchema,omitempty"`
+	// SchemaRegistry is the url of a schema registry, avro payloads
+	// in its wire format are decoded with the schema they name
+	SchemaRegistry string `json:"schemaRegistry,omitempty"`
+	// RecordPath and ExtractRules map the decoded payloads to
+	// columns, avro unions appear as {"type": value}
+	RecordPath   string       `json:"recordPath,omitempty"`
+	ExtractRules []SocketRule `json:"extractRules,omitempty"`
+	Tablename    string       `json:"tablename"`
+}
+
+// ExtractJobConfig holds the settings of the Jobs that churro-watch
+// creates to extract each file
+type ExtractJobConfig struct {
+	BackoffLimit            int32 `json:"backoffLimit"`
+	ActiveDeadlineSeconds   int64 `json:"activeDeadlineSeconds"`
+	TTLSecondsAfterFinished int32 `json:"ttlSecondsAfterFinished"`
 }
 
 type Endpoint struct {
@@ -67,10 +311,31 @@ type PipelineSpec struct {
 	AdminDataSource Source `json:"adminDataSource,omitempty"`
 	DataSource      Source `json:"dataSource,omitempty"`
 
-	WatchSockets []WatchSocket `json:"watchSockets"`
+	WatchSockets  []WatchSocket  `json:"watchSockets"`
+	HTTPSources   []HTTPSource   `json:"httpSources"`
+	IngestSources []IngestSource `json:"ingestSources"`
+	SQLSources    []SQLSource    `json:"sqlSources"`
+	CDCSources    []CDCSource    `json:"cdcSources"`
+	SyslogSources []SyslogSource `json:"syslogSources"`
+	S3Sources     []S3Source     `json:"s3Sources"`
+	SFTPSources   []SFTPSource   `json:"sftpSources"`
+	MQTTSources   []MQTTSource   `json:"mqttSources"`
+	KafkaSources  []KafkaSource  `json:"kafkaSources"`
+	FileSources   []FileSource   `json:"fileSources"`
 	//WatchDirectories []WatchDirectory `json:"watchDirectories"`
 	WatchConfig struct {
 		Location Endpoint `json:"location"`
+		// MaxConcurrentExtracts caps the extractions running at
+		// once across all watch directories of the pipeline
+		MaxConcurrentExtracts int              `json:"maxConcurrentExtracts"`
+		ExtractJob            ExtractJobConfig `json:"extractJob"`
+		// CSVChunkSize splits csv files larger than this many bytes
+		// into chunks that are extracted in parallel, zero extracts
+		// every file in one piece
+		CSVChunkSize int64 `json:"csvChunkSize,omitempty"`
+		// CSVChunkWorkers is how many chunks of a file are extracted
+		// at once
+		CSVChunkWorkers int `json:"csvChunkWorkers,omitempty"`
 	} `json:"watchConfig"`
 	LoaderConfig struct {
 		Location    Endpoint `json:"location"`
@@ -63,6 +63,8 @@ func main() {
 	s := grpc.NewServer(grpc.Creds(creds))
 
 	pb.RegisterCtlServer(s, server)
+	pb.RegisterCtlScheduleServer(s, server)
+	pb.RegisterCtlPreviewServer(s, server)
 	if err := s.Serve(lis); err != nil {
 		panic(err)
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
 
@@ -58,17 +59,36 @@ func main() {
 		os.Exit(1)
 	}
 
+	// an interrupted extraction is relaunched with CHURRO_RESUME set
+	resume := os.Getenv("CHURRO_RESUME") == "true"
+	// a file whose content was loaded before carries the duplicate
+	// policy the watch applied to it
+	duplicate := os.Getenv("CHURRO_DUPLICATE")
+	// a file downloaded from a remote source carries its remote path
+	// and version
+	sourcePath := os.Getenv("CHURRO_SOURCE_PATH")
+	sourceVersion := os.Getenv("CHURRO_SOURCE_VERSION")
+
 	logger.Infof("CHURRO_TABLENAME %s\n", tableName)
 	logger.Infof("CHURRO_SCHEME %s\n", schemeValue)
 	logger.Infof("CHURRO_FILENAME %s\n", fileName)
 	logger.Infof("CHURRO_NAMESPACE %s\n", pipeline)
 	logger.Infof("CHURRO_WATCHDIR_NAME %s\n", watchDirName)
+	logger.Infof("CHURRO_RESUME %t\n", resume)
+	logger.Infof("CHURRO_DUPLICATE %s\n", duplicate)
+	logger.Infof("CHURRO_SOURCE_PATH %s\n", sourcePath)
 
 	dbCreds := cfg.DBCredentials{
 		SSLRootCertPath: *dbCertPath + "/ca.crt",
 		SSLKeyPath:      *dbCertPath + "/client." + pipeline + ".key",
 		SSLCertPath:     *dbCertPath + "/client." + pipeline + ".crt",
 	}
+	// polled sources keep their watermarks in the admin database
+	adminDBCreds := cfg.DBCredentials{
+		SSLRootCertPath: *dbCertPath + "/ca.crt",
+		SSLKeyPath:      *dbCertPath + "/client.root.key",
+		SSLCertPath:     *dbCertPath + "/client.root.crt",
+	}
 	svcCreds := cfg.ServiceCredentials{
 		ServiceCrt: *serviceCertPath + "/service.crt",
 		ServiceKey: *serviceCertPath + "/service.key",
@@ -91,7 +111,13 @@ func main() {
 		os.Exit(1)
 	}
 
-	extract.NewExtractServer(fileName, schemeValue, tableName, *debug, svcCreds, dbCreds, pi, logger)
+	// a failed extraction exits non-zero so the job is retried and
+	// its outcome recorded as failed
+	_, err = extract.NewExtractServer(context.Background(), fileName, schemeValue, tableName, watchDirName, duplicate, sourcePath, sourceVersion, *debug, resume, svcCreds, dbCreds, adminDBCreds, pi, logger)
+	if err != nil {
+		logger.Errorf("extract failed %s\n", err.Error())
+		os.Exit(1)
+	}
 	logger.Info("extract ending...")
 
 }
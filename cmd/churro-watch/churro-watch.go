@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"net"
+	"net/http"
 	"os"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
 	"gitlab.com/churro-group/churro/internal"
 	"gitlab.com/churro-group/churro/internal/config"
 	cfg "gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/extract"
 	"gitlab.com/churro-group/churro/internal/watch"
+	pbingest "gitlab.com/churro-group/churro/rpc/ingest"
+	pbloader "gitlab.com/churro-group/churro/rpc/loader"
 	pb "gitlab.com/churro-group/churro/rpc/watch"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
@@ -27,6 +36,8 @@ func main() {
 
 	serviceCertPath := flag.String("servicecert", "", "path to service creds")
 	dbCertPath := flag.String("dbcert", "", "path to database cert files (e.g. ca.crt)")
+	executorFlag := flag.String("executor", watch.KubeExecutorName, "where extractions run: kubernetes, goroutine or process")
+	extractCommand := flag.String("extract-command", "churro-extract", "churro-extract binary used by the process executor")
 
 	flag.Parse()
 
@@ -76,7 +87,41 @@ func main() {
 		os.Exit(1)
 	}
 
-	server := watch.NewWatchServer(*debugFlag, svcCreds, pi, logger, userDBCreds, dbCreds)
+	var executor watch.Executor
+	poolSize := pi.Spec.WatchConfig.MaxConcurrentExtracts
+	switch *executorFlag {
+	case watch.KubeExecutorName:
+		// NewWatchServer defaults to the kubernetes executor
+	case watch.RoutineExecutorName:
+		// the extract server reads the pipeline database with
+		// the pipeline user credentials, same as churro-extract
+		extractDBCreds := cfg.DBCredentials{
+			SSLRootCertPath: *dbCertPath + "/ca.crt",
+			SSLKeyPath:      *dbCertPath + "/client." + ns + ".key",
+			SSLCertPath:     *dbCertPath + "/client." + ns + ".crt",
+		}
+		run := func(ctx context.Context, w watch.ExtractWork) error {
+			_, err := extract.NewExtractServer(ctx, w.FilePath, w.Scheme, w.Tablename, w.WatchDirName, w.Duplicate, w.SourcePath, w.SourceVersion, *debugFlag, w.Resume, svcCreds, extractDBCreds, dbCreds, pi, logger)
+			return err
+		}
+		executor = watch.NewLocalExecutor(poolSize, run, logger)
+	case watch.ProcessExecutorName:
+		run := watch.ProcessExtractFunc(*extractCommand, *serviceCertPath, *dbCertPath)
+		executor = watch.NewLocalExecutor(poolSize, run, logger)
+	default:
+		logger.Errorf("unknown executor %s\n", *executorFlag)
+		os.Exit(1)
+	}
+
+	server := watch.NewWatchServer(*debugFlag, svcCreds, pi, logger, userDBCreds, dbCreds, executor)
+
+	if len(pi.Spec.IngestSources) > 0 || len(pi.Spec.SyslogSources) > 0 {
+		go startIngest(pi, svcCreds, userDBCreds)
+	}
+
+	if len(pi.Spec.S3Sources) > 0 {
+		go startObjectStoreNotifications(server, svcCreds)
+	}
 
 	lis, err := net.Listen("tcp", watch.DEFAULT_PORT)
 	if err != nil {
@@ -87,9 +132,110 @@ func main() {
 	s := grpc.NewServer(grpc.Creds(creds))
 
 	pb.RegisterWatchServer(s, server)
+	pb.RegisterWatchSocketServer(s, server)
 	if err := s.Serve(lis); err != nil {
 		logger.Errorf("failed to serve %s\n", err.Error())
 		os.Exit(1)
 	}
 
 }
+
+// startObjectStoreNotifications receives the bucket notifications
+// of the pipeline's s3 sources over https
+func startObjectStoreNotifications(server *watch.Server, svcCreds cfg.ServiceCredentials) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(watch.ObjectStoreNotifyPath, server.ServeObjectStoreNotification)
+	logger.Infof("object store notifications started %s\n", watch.DEFAULT_OBJECT_STORE_NOTIFY_PORT)
+	err := http.ListenAndServeTLS(watch.DEFAULT_OBJECT_STORE_NOTIFY_PORT, svcCreds.ServiceCrt, svcCreds.ServiceKey, mux)
+	if err != nil {
+		logger.Errorf("error in object store notifications %s\n", err.Error())
+	}
+}
+
+// startIngest serves the pipeline's ingest sources over https and
+// gRPC and listens for its syslog sources, records are written with
+// the pipeline user credentials
+func startIngest(pi v1alpha1.Pipeline, svcCreds cfg.ServiceCredentials, dbCreds cfg.DBCredentials) {
+	tokens, err := extract.GetIngestTokens(pi)
+	if err != nil {
+		logger.Errorf("error reading ingest tokens %s\n", err.Error())
+		return
+	}
+
+	creds, err := credentials.NewClientTLSFromFile(svcCreds.ServiceCrt, "")
+	if err != nil {
+		logger.Errorf("could not process the credentials %s\n", err.Error())
+		return
+	}
+	url := fmt.Sprintf("%s:%d", pi.Spec.LoaderConfig.Location.Host, pi.Spec.LoaderConfig.Location.Port)
+	conn, err := grpc.Dial(url, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		logger.Errorf("could not connect to loader %s\n", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	ingester, err := extract.NewIngester(pi, dbCreds, tokens, pbloader.NewLoaderClient(conn), logger)
+	if err != nil {
+		logger.Errorf("error in ingest sources %s\n", err.Error())
+		return
+	}
+
+	err = ingester.LoadTransforms()
+	if err != nil {
+		logger.Errorf("error reading transform rules for ingest %s\n", err.Error())
+	}
+
+	for _, src := range pi.Spec.SyslogSources {
+		listener, err := extract.NewSyslogListener(src, ingester, svcCreds, logger)
+		if err != nil {
+			logger.Errorf("error in syslog source %s\n", err.Error())
+			continue
+		}
+		go func(name string) {
+			logger.Infof("syslog source %s started\n", name)
+			err := listener.Serve(context.Background())
+			if err != nil {
+				logger.Errorf("error in syslog source %s %s\n", name, err.Error())
+			}
+		}(src.Name)
+	}
+	if len(pi.Spec.SyslogSources) > 0 {
+		go func() {
+			err := http.ListenAndServe(extract.DEFAULT_METRICS_PORT, promhttp.Handler())
+			if err != nil {
+				logger.Errorf("error in metrics %s\n", err.Error())
+			}
+		}()
+	}
+	if len(pi.Spec.IngestSources) == 0 {
+		select {}
+	}
+
+	go func() {
+		lis, err := net.Listen("tcp", extract.DEFAULT_INGEST_GRPC_PORT)
+		if err != nil {
+			logger.Errorf("failed to listen %s\n", err.Error())
+			return
+		}
+		serverCreds, err := credentials.NewServerTLSFromFile(svcCreds.ServiceCrt, svcCreds.ServiceKey)
+		if err != nil {
+			logger.Errorf("failed to setup TLS %s\n", err.Error())
+			return
+		}
+		s := grpc.NewServer(grpc.Creds(serverCreds))
+		pbingest.RegisterIngestServer(s, ingester)
+		logger.Infof("ingest grpc service started %s\n", extract.DEFAULT_INGEST_GRPC_PORT)
+		if err := s.Serve(lis); err != nil {
+			logger.Errorf("failed to serve ingest %s\n", err.Error())
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle(extract.IngestPath, ingester)
+	logger.Infof("ingest service started %s\n", extract.DEFAULT_INGEST_PORT)
+	err = http.ListenAndServeTLS(extract.DEFAULT_INGEST_PORT, svcCreds.ServiceCrt, svcCreds.ServiceKey, mux)
+	if err != nil {
+		logger.Errorf("error in ingest service %s\n", err.Error())
+	}
+}
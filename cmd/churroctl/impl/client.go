@@ -10,6 +10,41 @@ import (
 
 func GetServiceConnection(logger *zap.SugaredLogger, serviceCrt, urlFlag string) (client pb.CtlClient, err error) {
 
+	conn, err := dialCtl(logger, serviceCrt, urlFlag)
+	if err != nil {
+		return client, err
+	}
+
+	client = pb.NewCtlClient(conn)
+
+	return client, nil
+
+}
+
+// GetScheduleConnection connects to the schedule service of churro-ctl
+func GetScheduleConnection(logger *zap.SugaredLogger, serviceCrt, urlFlag string) (client pb.CtlScheduleClient, err error) {
+
+	conn, err := dialCtl(logger, serviceCrt, urlFlag)
+	if err != nil {
+		return client, err
+	}
+
+	return pb.NewCtlScheduleClient(conn), nil
+}
+
+// GetPreviewConnection connects to the preview service of churro-ctl
+func GetPreviewConnection(logger *zap.SugaredLogger, serviceCrt, urlFlag string) (client pb.CtlPreviewClient, err error) {
+
+	conn, err := dialCtl(logger, serviceCrt, urlFlag)
+	if err != nil {
+		return client, err
+	}
+
+	return pb.NewCtlPreviewClient(conn), nil
+}
+
+func dialCtl(logger *zap.SugaredLogger, serviceCrt, urlFlag string) (*grpc.ClientConn, error) {
+
 	url := urlFlag
 	if urlFlag == "" {
 		url = ctl.DEFAULT_PORT
@@ -18,18 +53,14 @@ func GetServiceConnection(logger *zap.SugaredLogger, serviceCrt, urlFlag string)
 	creds, err := credentials.NewClientTLSFromFile(serviceCrt, "")
 	if err != nil {
 		logger.Errorf("could not process the credentials %s\n", err.Error())
-		return client, err
+		return nil, err
 	}
 
 	logger.Info("url ", zap.String("url", url))
 	conn, err := grpc.Dial(url, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		logger.Errorf("did not connect %s\n", err.Error())
-		return client, err
+		return nil, err
 	}
-
-	client = pb.NewCtlClient(conn)
-
-	return client, nil
-
+	return conn, nil
 }
@@ -0,0 +1,84 @@
+package impl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/churro-group/churro/internal/extract"
+	pb "gitlab.com/churro-group/churro/rpc/ctl"
+	"go.uber.org/zap"
+)
+
+// Preview shows how a watch directory would extract a sample file
+func Preview(logger *zap.SugaredLogger, cmd *cobra.Command, args []string, serviceCrt string, urlFlag string, watchDir string, sampleFile string, rows int) {
+
+	if watchDir == "" || sampleFile == "" {
+		logger.Error("a watch directory and a sample file are required")
+		os.Exit(1)
+	}
+	// only the head of a large sample is sent
+	f, err := os.Open(sampleFile)
+	if err != nil {
+		logger.Errorf("error reading sample file %s\n", err.Error())
+		os.Exit(1)
+	}
+	content, truncated, err := extract.PreviewHead(f)
+	f.Close()
+	if err != nil {
+		logger.Errorf("error reading sample file %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	client, err := GetPreviewConnection(logger, serviceCrt, urlFlag)
+	if err != nil {
+		logger.Errorf("error in getPreviewConnection %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	req := pb.PreviewExtractRequest{
+		Watchdir:    watchDir,
+		FileName:    filepath.Base(sampleFile),
+		FileContent: content,
+		Truncated:   truncated,
+		Rows:        int32(rows),
+	}
+	resp, err := client.PreviewExtract(context.Background(), &req)
+	if err != nil {
+		logger.Errorf("error in PreviewExtract %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	var p extract.Preview
+	err = json.Unmarshal([]byte(resp.PreviewString), &p)
+	if err != nil {
+		logger.Errorf("error in PreviewExtract response %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ROW\t"+strings.Join(p.ColumnNames, "\t")+"\t")
+	fmt.Fprintln(w, "TYPE\t"+strings.Join(p.ColumnTypes, "\t")+"\t")
+	for i, row := range p.Rows {
+		values := row.Values
+		if values == nil {
+			values = row.Extracted
+		}
+		fmt.Fprintf(w, "%d\t%s\t\n", i+1, strings.Join(values, "\t"))
+	}
+	w.Flush()
+
+	for i, row := range p.Rows {
+		if row.Error != "" {
+			fmt.Printf("row %d error: %s\n", i+1, row.Error)
+		}
+	}
+	if p.Skipped > 0 {
+		fmt.Printf("%d rows skipped by extract rule filters\n", p.Skipped)
+	}
+}
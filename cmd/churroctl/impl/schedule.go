@@ -0,0 +1,82 @@
+package impl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/churro-group/churro/internal/watch"
+	pb "gitlab.com/churro-group/churro/rpc/ctl"
+	"go.uber.org/zap"
+)
+
+func GetSchedules(logger *zap.SugaredLogger, cmd *cobra.Command, args []string, serviceCrt string, urlFlag string) {
+
+	client, err := GetScheduleConnection(logger, serviceCrt, urlFlag)
+	if err != nil {
+		logger.Errorf("error in getScheduleConnection %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	resp, err := client.GetSchedules(context.Background(), &pb.GetSchedulesRequest{})
+	if err != nil {
+		logger.Errorf("error in GetSchedules %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	var schedules []watch.SourceSchedule
+	err = json.Unmarshal([]byte(resp.SchedulesString), &schedules)
+	if err != nil {
+		logger.Errorf("error in GetSchedules response %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKIND\tSCHEDULE\tPAUSED\tLAST RUN\tNEXT RUN\tSTATUS")
+	for _, s := range schedules {
+		lastRun := "-"
+		if !s.LastRun.IsZero() {
+			lastRun = s.LastRun.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\t%s\n", s.Name, s.Kind, s.Cron, s.Paused, lastRun, s.NextRun.Local().Format(time.RFC3339), s.LastStatus)
+	}
+	w.Flush()
+}
+
+// UpdateSchedule pauses or resumes the schedule named by args
+func UpdateSchedule(logger *zap.SugaredLogger, cmd *cobra.Command, args []string, serviceCrt string, urlFlag string, paused bool) {
+
+	client, err := GetScheduleConnection(logger, serviceCrt, urlFlag)
+	if err != nil {
+		logger.Errorf("error in getScheduleConnection %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	_, err = client.UpdateSchedule(context.Background(), &pb.UpdateScheduleRequest{Name: args[0], Paused: paused})
+	if err != nil {
+		logger.Errorf("error in UpdateSchedule %s\n", err.Error())
+		os.Exit(1)
+	}
+	logger.Infof("schedule %s paused %t\n", args[0], paused)
+}
+
+// RunSchedule requests a run of the scheduled source named by args
+func RunSchedule(logger *zap.SugaredLogger, cmd *cobra.Command, args []string, serviceCrt string, urlFlag string) {
+
+	client, err := GetScheduleConnection(logger, serviceCrt, urlFlag)
+	if err != nil {
+		logger.Errorf("error in getScheduleConnection %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	_, err = client.RunSchedule(context.Background(), &pb.RunScheduleRequest{Name: args[0]})
+	if err != nil {
+		logger.Errorf("error in RunSchedule %s\n", err.Error())
+		os.Exit(1)
+	}
+	logger.Infof("run of %s requested\n", args[0])
+}
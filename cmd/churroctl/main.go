@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"gitlab.com/churro-group/churro/api/v1alpha1"
@@ -28,6 +29,8 @@ var namespace string
 var crPath string
 var urlFlag string
 var adminUser string
+var previewWatchDir, previewFile string
+var previewRows int
 
 var logger *zap.SugaredLogger
 
@@ -41,6 +44,9 @@ func main() {
 	createCmd := createCommand()
 	deleteCmd := deleteCommand()
 	getCmd := getCommand()
+	runCmd := runCommand()
+	pauseCmd := pauseCommand()
+	resumeCmd := resumeCommand()
 
 	// pipeline subcommands
 	createPipelineCmd := createPipelineCommand()
@@ -84,6 +90,25 @@ func main() {
 	deleteTransformRuleCmd.PersistentFlags().StringVarP(&serviceCrt, "servicecrt", "s", "", "serivce certificate for a given pipeline")
 	deleteTransformRuleCmd.PersistentFlags().IntVarP(&transformRuleId, "transformruleid", "i", 0, "transformrule id, integer value")
 
+	previewCmd := previewCommand()
+	previewCmd.PersistentFlags().StringVarP(&serviceCrt, "servicecrt", "s", "", "service certificate for a given pipeline")
+	previewCmd.PersistentFlags().StringVarP(&previewWatchDir, "watchdir", "w", "", "watch directory name or id")
+	previewCmd.PersistentFlags().StringVarP(&previewFile, "file", "f", "", "sample file to extract")
+	previewCmd.PersistentFlags().IntVarP(&previewRows, "rows", "r", 20, "number of rows to preview")
+
+	// schedule subcommands
+	getScheduleCmd := getScheduleCommand()
+	getScheduleCmd.PersistentFlags().StringVarP(&serviceCrt, "servicecrt", "s", "", "service certificate for a given pipeline")
+
+	runScheduleCmd := runScheduleCommand()
+	runScheduleCmd.PersistentFlags().StringVarP(&serviceCrt, "servicecrt", "s", "", "service certificate for a given pipeline")
+
+	pauseScheduleCmd := updateScheduleCommand(true)
+	pauseScheduleCmd.PersistentFlags().StringVarP(&serviceCrt, "servicecrt", "s", "", "service certificate for a given pipeline")
+
+	resumeScheduleCmd := updateScheduleCommand(false)
+	resumeScheduleCmd.PersistentFlags().StringVarP(&serviceCrt, "servicecrt", "s", "", "service certificate for a given pipeline")
+
 	createCmd.AddCommand(createPipelineCmd)
 	createCmd.AddCommand(createWatchDirCmd)
 	createCmd.AddCommand(createTransformFunctionCmd)
@@ -98,6 +123,11 @@ func main() {
 	getCmd.AddCommand(getWatchDirCmd)
 	getCmd.AddCommand(getTransformFunctionCmd)
 	getCmd.AddCommand(getTransformRuleCmd)
+	getCmd.AddCommand(getScheduleCmd)
+
+	runCmd.AddCommand(runScheduleCmd)
+	pauseCmd.AddCommand(pauseScheduleCmd)
+	resumeCmd.AddCommand(resumeScheduleCmd)
 
 	// root command
 	rootCmd := &cobra.Command{}
@@ -108,6 +138,10 @@ func main() {
 	rootCmd.AddCommand(createCmd)
 	rootCmd.AddCommand(deleteCmd)
 	rootCmd.AddCommand(getCmd)
+	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(pauseCmd)
+	rootCmd.AddCommand(resumeCmd)
+	rootCmd.AddCommand(previewCmd)
 
 	createCmd.PersistentFlags().StringVarP(&adminUser, "adminuser", "u", "root", "database admin userid")
 
@@ -182,6 +216,45 @@ func getCommand() *cobra.Command {
 	return cmd
 }
 
+func runCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+		Use:   `run`,
+		Short: "Run churro resources now",
+		Args:  cobra.MinimumNArgs(1),
+		Long:  "This is a command that runs churro resources now",
+	}
+
+	return cmd
+}
+
+func pauseCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+		Use:   `pause`,
+		Short: "Pause churro resources",
+		Args:  cobra.MinimumNArgs(1),
+		Long:  "This is a command that pauses churro resources",
+	}
+
+	return cmd
+}
+
+func resumeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+		Use:   `resume`,
+		Short: "Resume churro resources",
+		Args:  cobra.MinimumNArgs(1),
+		Long:  "This is a command that resumes churro resources",
+	}
+
+	return cmd
+}
+
 func createPipelineCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Run: func(cmd *cobra.Command, args []string) {
@@ -329,6 +402,7 @@ func fillCRDefaults(cr *v1alpha1.Pipeline, pipelineName string) {
 	cr.Spec.WatchConfig.Location.Scheme = "http"
 	cr.Spec.WatchConfig.Location.Host = "churro-watch"
 	cr.Spec.WatchConfig.Location.Port = 8087
+	cr.Spec.WatchConfig.MaxConcurrentExtracts = 10
 }
 
 func createWatchDirCommand() *cobra.Command {
@@ -447,3 +521,61 @@ func getTransformRuleCommand() *cobra.Command {
 
 	return cmd
 }
+
+func getScheduleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Run: func(cmd *cobra.Command, args []string) {
+			impl.GetSchedules(logger, cmd, args, serviceCrt, urlFlag)
+		},
+		Use:   `schedule`,
+		Short: "Command get schedule",
+		Long:  "This is a command that gets the scheduled sources of a pipeline with their last and next runs",
+	}
+
+	return cmd
+}
+
+func runScheduleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Run: func(cmd *cobra.Command, args []string) {
+			impl.RunSchedule(logger, cmd, args, serviceCrt, urlFlag)
+		},
+		Use:   `schedule NAME`,
+		Short: "Command run schedule",
+		Args:  cobra.ExactArgs(1),
+		Long:  "This is a command that runs a scheduled source now, outside of its schedule",
+	}
+
+	return cmd
+}
+
+func updateScheduleCommand(paused bool) *cobra.Command {
+	verb := "resumes"
+	if paused {
+		verb = "pauses"
+	}
+	cmd := &cobra.Command{
+		Run: func(cmd *cobra.Command, args []string) {
+			impl.UpdateSchedule(logger, cmd, args, serviceCrt, urlFlag, paused)
+		},
+		Use:   `schedule NAME`,
+		Short: "Command " + strings.TrimSuffix(verb, "s") + " schedule",
+		Args:  cobra.ExactArgs(1),
+		Long:  "This is a command that " + verb + " the schedule of a source",
+	}
+
+	return cmd
+}
+
+func previewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Run: func(cmd *cobra.Command, args []string) {
+			impl.Preview(logger, cmd, args, serviceCrt, urlFlag, previewWatchDir, previewFile, previewRows)
+		},
+		Use:   `preview`,
+		Short: "Preview the extraction of a sample file",
+		Long:  "This is a command that runs the extract and transform rules of a watch directory on the first rows of a sample file without loading them",
+	}
+
+	return cmd
+}
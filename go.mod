@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	github.com/360EntSecGroup-Skylar/excelize/v2 v2.3.0
+	github.com/eclipse/paho.mqtt.golang v1.2.0
 	github.com/fsnotify/fsnotify v1.4.9
 	github.com/go-logr/logr v0.1.0
 	github.com/golang/protobuf v1.4.3 // indirect
@@ -11,15 +12,20 @@ require (
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/websocket v1.4.0
 	github.com/lib/pq v1.3.0
+	github.com/linkedin/goavro/v2 v2.9.8
 	github.com/mattn/go-sqlite3 v1.14.5
 	github.com/ohler55/ojg v1.2.0
 	github.com/pkg/errors v0.9.1 // indirect
+	github.com/pkg/sftp v1.11.0
 	github.com/prometheus/client_golang v1.0.0
 	github.com/prometheus/common v0.4.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/rs/xid v1.2.1
+	github.com/segmentio/kafka-go v0.4.12
 	github.com/spf13/cobra v0.0.6
 	github.com/traefik/yaegi v0.9.7
 	go.uber.org/zap v1.10.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/net v0.0.0-20201110031124-69a78807bb2b // indirect
 	golang.org/x/sys v0.0.0-20201119102817-f84b799fce68 // indirect
 	golang.org/x/text v0.3.4 // indirect
@@ -0,0 +1,23 @@
+package churrodata
+
+const (
+	CDCUpsert = "upsert"
+	CDCDelete = "delete"
+)
+
+// CDCChange is one captured change, Cols line up with the format's
+// ColumnNames, only the key columns are set for a delete
+type CDCChange struct {
+	Op   string   `json:"op"`
+	Cols []string `json:"cols"`
+}
+type CDCFormat struct {
+	Path         string      `json:"path"`
+	Dataprov     string      `json:"dataprov"`
+	Tablename    string      `json:"tablename"`
+	PipelineName string      `json:"pipelinename"`
+	ColumnNames  []string    `json:"columnnames"`
+	ColumnTypes  []string    `json:"columntypes"`
+	KeyColumns   []string    `json:"keycolumns"`
+	Changes      []CDCChange `json:"changes"`
+}
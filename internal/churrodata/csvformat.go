@@ -11,4 +11,25 @@ type CSVFormat struct {
 	ColumnNames  []string `json:"columnnames"`
 	ColumnTypes  []string `json:"columntypes"`
 	Records      []CSVRow `json:"records"`
+	// Skipped counts the rows left out by extract rule filters
+	Skipped int64 `json:"skipped,omitempty"`
+	// Chunk places the records within a file extracted in parallel
+	// chunks, it is nil for a file extracted in one piece
+	Chunk *CSVChunk `json:"chunk,omitempty"`
+	// Load is how the records are written to the table
+	Load
+}
+
+// CSVChunk describes the part of a chunked file a message holds,
+// Dataprov of the message is the chunk's own provenance
+type CSVChunk struct {
+	Index int `json:"index"`
+	Count int `json:"count"`
+	// FileDataprov is the provenance of the whole file
+	FileDataprov string `json:"filedataprov"`
+	// FirstRow is the row of the chunk the first record was read
+	// from, counting from 1
+	FirstRow int64 `json:"firstrow"`
+	// Last marks the final message of the chunk
+	Last bool `json:"last,omitempty"`
 }
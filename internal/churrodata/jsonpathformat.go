@@ -11,4 +11,8 @@ type JsonPathFormat struct {
 	ColumnNames  []string      `json:"columnnames"`
 	ColumnTypes  []string      `json:"columntypes"`
 	Records      []JsonPathRow `json:"records"`
+	// Skipped counts the rows left out by extract rule filters
+	Skipped int64 `json:"skipped,omitempty"`
+	// Load is how the records are written to the table
+	Load
 }
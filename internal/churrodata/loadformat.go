@@ -0,0 +1,18 @@
+package churrodata
+
+const (
+	// LoadAppend inserts every record as a new row
+	LoadAppend = "append"
+	// LoadUpsert replaces the row with the same key columns
+	LoadUpsert = "upsert"
+	// LoadReplacePartition replaces the rows loaded by earlier files
+	// that share the key columns of a record
+	LoadReplacePartition = "replace-partition"
+)
+
+// Load says how the loader writes the records of a message to
+// their table, the zero value appends
+type Load struct {
+	LoadMode   string   `json:"loadmode,omitempty"`
+	KeyColumns []string `json:"loadkeycolumns,omitempty"`
+}
@@ -11,4 +11,6 @@ type XLSFormat struct {
 	ColumnNames  []string `json:"columnnames"`
 	ColumnTypes  []string `json:"columntypes"`
 	Records      []XLSRow `json:"records"`
+	// Load is how the records are written to the table
+	Load
 }
@@ -12,12 +12,21 @@ import (
 )
 
 const (
-	XLSXScheme     = "xlsx"
-	CSVScheme      = "csv"
-	XMLScheme      = "xml"
-	JSONScheme     = "json"
-	JSONPathScheme = "jsonpath"
-	FinnHubScheme  = "finnhub-stocks"
+	XLSXScheme      = "xlsx"
+	CSVScheme       = "csv"
+	XMLScheme       = "xml"
+	JSONScheme      = "json"
+	JSONPathScheme  = "jsonpath"
+	FinnHubScheme   = "finnhub-stocks"
+	WebSocketScheme = "websocket"
+	HTTPPollScheme  = "http-poll"
+	IngestScheme    = "ingest"
+	SQLScheme       = "sql"
+	CDCScheme       = "cdc"
+	SyslogScheme    = "syslog"
+	TailScheme      = "tail"
+	MQTTScheme      = "mqtt"
+	KafkaScheme     = "kafka"
 )
 
 type Endpoint struct {
@@ -45,7 +45,7 @@ func Seed(dbPath string) error {
 func (a *PipelineAdminDatabase) CreateObjects(db *sql.DB) (err error) {
 
 	// create WatchDirectory
-	_, err = db.Exec("CREATE TABLE if not exists `watchdirectory` (`id` VARCHAR(255) PRIMARY KEY, `name` VARCHAR(64) NOT NULL, `path` VARCHAR(64) NOT NULL, `scheme` VARCHAR(10) NOT NULL, `regex` VARCHAR(64) NOT NULL, `tablename` VARCHAR(40) NOT NULL, `lastupdated` DATETIME NULL)")
+	_, err = db.Exec("CREATE TABLE if not exists `watchdirectory` (`id` VARCHAR(255) PRIMARY KEY, `name` VARCHAR(64) NOT NULL, `path` VARCHAR(64) NOT NULL, `scheme` VARCHAR(10) NOT NULL, `regex` VARCHAR(64) NOT NULL, `tablename` VARCHAR(40) NOT NULL, `maxconcurrent` INTEGER DEFAULT 0, `priority` INTEGER DEFAULT 0, `disposition` VARCHAR(10) DEFAULT '', `archivepath` VARCHAR(255) DEFAULT '', `quarantinepath` VARCHAR(255) DEFAULT '', `retentiondays` INTEGER DEFAULT 0, `watchmode` VARCHAR(10) DEFAULT '', `pollinterval` INTEGER DEFAULT 0, `lineparser` VARCHAR(10) DEFAULT '', `linepattern` TEXT DEFAULT '', `duplicatepolicy` VARCHAR(10) DEFAULT '', `loadmode` VARCHAR(20) DEFAULT '', `keycolumns` VARCHAR(255) DEFAULT '', `lastupdated` DATETIME NULL)")
 	if err != nil {
 		panic(err)
 	}
@@ -67,6 +67,48 @@ func (a *PipelineAdminDatabase) CreateObjects(db *sql.DB) (err error) {
 		panic(err)
 	}
 
+	// create ExtractQueue
+	_, err = db.Exec("CREATE TABLE if not exists `extractqueue` (`id` VARCHAR(255) PRIMARY KEY, `watchdirectoryid` VARCHAR(64) NOT NULL, `watchdirname` VARCHAR(64) NOT NULL, `scheme` VARCHAR(10) NOT NULL, `filepath` TEXT NOT NULL, `tablename` VARCHAR(40) NOT NULL, `priority` INTEGER DEFAULT 0, `createdtime` DATETIME NULL, `resume` BOOLEAN DEFAULT 0, `duplicate` VARCHAR(10) DEFAULT '', `decision` TEXT DEFAULT '', `sourcepath` TEXT DEFAULT '', `sourceversion` VARCHAR(255) DEFAULT '')")
+	if err != nil {
+		panic(err)
+	}
+
+	// create ExtractOutcome
+	_, err = db.Exec("CREATE TABLE if not exists `extractoutcome` (`id` VARCHAR(255) PRIMARY KEY, `watchdirectoryid` VARCHAR(64) NOT NULL, `filepath` TEXT NOT NULL, `status` VARCHAR(10) NOT NULL, `attempts` INTEGER DEFAULT 0, `decision` TEXT DEFAULT '', `lastupdated` DATETIME NULL)")
+	if err != nil {
+		panic(err)
+	}
+
+	// create WatchSnapshot
+	_, err = db.Exec("CREATE TABLE if not exists `watchsnapshot` (`watchdirectoryid` VARCHAR(64) NOT NULL, `path` TEXT NOT NULL, `size` INTEGER NOT NULL, `modtime` DATETIME NULL, PRIMARY KEY (`watchdirectoryid`, `path`))")
+	if err != nil {
+		panic(err)
+	}
+
+	// create SourceWatermark
+	_, err = db.Exec("CREATE TABLE if not exists `sourcewatermark` (`name` VARCHAR(64) PRIMARY KEY, `watermark` TEXT NOT NULL, `lastupdated` DATETIME NULL)")
+	if err != nil {
+		panic(err)
+	}
+
+	// create SourceSchedule
+	_, err = db.Exec("CREATE TABLE if not exists `sourceschedule` (`name` VARCHAR(64) PRIMARY KEY, `kind` VARCHAR(10) NOT NULL, `cronexpr` VARCHAR(64) NOT NULL, `paused` BOOLEAN DEFAULT 0, `runrequested` BOOLEAN DEFAULT 0, `lastrun` DATETIME NULL, `nextrun` DATETIME NULL, `laststatus` TEXT NULL, `lastupdated` DATETIME NULL)")
+	if err != nil {
+		panic(err)
+	}
+
+	// create TailOffset
+	_, err = db.Exec("CREATE TABLE if not exists `tailoffset` (`watchdirectoryid` VARCHAR(64) NOT NULL, `path` TEXT NOT NULL, `inode` INTEGER NOT NULL, `byteoffset` INTEGER NOT NULL, `lastupdated` DATETIME NULL, PRIMARY KEY (`watchdirectoryid`, `path`))")
+	if err != nil {
+		panic(err)
+	}
+
+	// create ExtractCheckpoint
+	_, err = db.Exec("CREATE TABLE if not exists `extractcheckpoint` (`path` VARCHAR(255) PRIMARY KEY, `watchdirectoryid` VARCHAR(64) NOT NULL, `watchdirname` VARCHAR(64) NOT NULL, `scheme` VARCHAR(10) NOT NULL, `tablename` VARCHAR(40) NOT NULL, `dataprov` VARCHAR(64) NOT NULL, `size` INTEGER NOT NULL, `modtime` DATETIME NULL, `rowoffset` INTEGER NOT NULL, `chunksize` INTEGER DEFAULT 0, `chunks` TEXT DEFAULT '', `resumes` INTEGER DEFAULT 0, `lastupdated` DATETIME NULL)")
+	if err != nil {
+		panic(err)
+	}
+
 	return err
 }
 
@@ -49,7 +49,7 @@ func (s *Server) createPipeline() error {
 		s.logger.Info("Successfully created database..", zap.String("sql", sqlStr), zap.String("database", pi.Spec.DataSource.Database))
 	}
 
-	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.dataprov ( id STRING PRIMARY KEY, name STRING, path STRING, createdtime TIMESTAMP);", pi.Spec.DataSource.Database)
+	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.dataprov ( id STRING PRIMARY KEY, name STRING, path STRING, createdtime TIMESTAMP, etag STRING DEFAULT '', parentid STRING DEFAULT '', hash STRING DEFAULT '', size INT DEFAULT 0, version INT DEFAULT 1, previousid STRING DEFAULT '', source STRING DEFAULT '', loaded BOOL DEFAULT false);", pi.Spec.DataSource.Database)
 	stmt, err = db.Prepare(sqlStr)
 	if err != nil {
 		return err
@@ -61,6 +61,40 @@ func (s *Server) createPipeline() error {
 
 	s.logger.Info("Table created successfully..", zap.String("sql", sqlStr))
 
+	// pipelines created before object store sources lack the etag
+	sqlStr = fmt.Sprintf("ALTER TABLE %s.dataprov ADD COLUMN IF NOT EXISTS etag STRING DEFAULT '';", pi.Spec.DataSource.Database)
+	_, err = db.Exec(sqlStr)
+	if err != nil {
+		return err
+	}
+
+	// nor the parent of the chunks of a file extracted in parallel
+	sqlStr = fmt.Sprintf("ALTER TABLE %s.dataprov ADD COLUMN IF NOT EXISTS parentid STRING DEFAULT '';", pi.Spec.DataSource.Database)
+	_, err = db.Exec(sqlStr)
+	if err != nil {
+		return err
+	}
+
+	// nor the content hash used to find files sent twice
+	sqlStr = fmt.Sprintf("ALTER TABLE %s.dataprov ADD COLUMN IF NOT EXISTS hash STRING DEFAULT '', ADD COLUMN IF NOT EXISTS size INT DEFAULT 0, ADD COLUMN IF NOT EXISTS version INT DEFAULT 1, ADD COLUMN IF NOT EXISTS previousid STRING DEFAULT '';", pi.Spec.DataSource.Database)
+	_, err = db.Exec(sqlStr)
+	if err != nil {
+		return err
+	}
+	sqlStr = fmt.Sprintf("CREATE INDEX IF NOT EXISTS dataprov_hash_idx ON %s.dataprov (hash);", pi.Spec.DataSource.Database)
+	_, err = db.Exec(sqlStr)
+	if err != nil {
+		return err
+	}
+
+	// nor the remote source of a download and whether it loaded,
+	// the files registered before are taken as loaded
+	sqlStr = fmt.Sprintf("ALTER TABLE %s.dataprov ADD COLUMN IF NOT EXISTS source STRING DEFAULT '', ADD COLUMN IF NOT EXISTS loaded BOOL DEFAULT true;", pi.Spec.DataSource.Database)
+	_, err = db.Exec(sqlStr)
+	if err != nil {
+		return err
+	}
+
 	/**
 	CREATE TABLE if not exists pipeline1.churroformat (
 	        id serial PRIMARY KEY,
@@ -92,6 +126,13 @@ func (s *Server) createPipeline() error {
 	}
 	s.logger.Info("Privs granted successfully..", zap.String("sql", sqlStr))
 
+	// extractions mark their dataprov loaded once they succeed
+	sqlStr = fmt.Sprintf("grant update on %s.dataprov to %s;", pi.Spec.DataSource.Database, pi.Spec.DataSource.Username)
+	_, err = db.Exec(sqlStr)
+	if err != nil {
+		return err
+	}
+
 	// grant privs to pipeline database user
 	// grant create on pipelinedatabase to someuser
 	sqlStr = fmt.Sprintf("grant all on database %s to %s;", pi.Spec.DataSource.Database, pi.Spec.DataSource.Username)
@@ -113,7 +154,7 @@ func (s *Server) createPipeline() error {
 	        records_in bigint,
 	        lastUpdated TIMESTAMP);
 	*/
-	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.pipeline_stats ( id serial PRIMARY KEY, dataprov_id text, file_name text, records_in bigint, lastupdated TIMESTAMP);", pi.Spec.DataSource.Database)
+	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.pipeline_stats ( id serial PRIMARY KEY, dataprov_id text, file_name text, records_in bigint, records_skipped bigint DEFAULT 0, lastupdated TIMESTAMP);", pi.Spec.DataSource.Database)
 	stmt, err = db.Prepare(sqlStr)
 	if err != nil {
 		return err
@@ -124,6 +165,13 @@ func (s *Server) createPipeline() error {
 	}
 	s.logger.Info("Table created successfully..", zap.String("sql", sqlStr))
 
+	// pipelines created before extract rule filters lack records_skipped
+	sqlStr = fmt.Sprintf("ALTER TABLE %s.pipeline_stats ADD COLUMN IF NOT EXISTS records_skipped bigint DEFAULT 0;", pi.Spec.DataSource.Database)
+	_, err = db.Exec(sqlStr)
+	if err != nil {
+		return err
+	}
+
 	// grant privs to pipeline database user
 	// grant insert,update,select on pipeline1.pipeline_stats to someuser
 	sqlStr = fmt.Sprintf("grant insert,select on %s.pipeline_stats to %s;", pi.Spec.DataSource.Database, pi.Spec.DataSource.Username)
@@ -33,7 +33,7 @@ func (s *Server) verify() error {
 	}
 	s.logger.Info("Successfully created database", zap.String("database", cfg.Database))
 
-	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.watchdirectory ( id STRING PRIMARY KEY, name STRING NOT NULL, path STRING NOT NULL, scheme STRING NOT NULL, regex STRING NOT NULL, tablename STRING NOT NULL, lastupdated TIMESTAMP);", cfg.Database)
+	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.watchdirectory ( id STRING PRIMARY KEY, name STRING NOT NULL, path STRING NOT NULL, scheme STRING NOT NULL, regex STRING NOT NULL, tablename STRING NOT NULL, maxconcurrent INT DEFAULT 0, priority INT DEFAULT 0, disposition STRING DEFAULT '', archivepath STRING DEFAULT '', quarantinepath STRING DEFAULT '', retentiondays INT DEFAULT 0, watchmode STRING DEFAULT '', pollinterval INT DEFAULT 0, lineparser STRING DEFAULT '', linepattern STRING DEFAULT '', duplicatepolicy STRING DEFAULT '', loadmode STRING DEFAULT '', keycolumns STRING DEFAULT '', lastupdated TIMESTAMP);", cfg.Database)
 	s.logger.Info("create table", zap.String("sql", sqlStr))
 	var stmt *sql.Stmt
 	stmt, err = db.Prepare(sqlStr)
@@ -46,6 +46,18 @@ func (s *Server) verify() error {
 	}
 	s.logger.Info("watchdirectory Table created successfully..")
 
+	// watch directories defined before an upgrade lack the later columns
+	sqlStr = fmt.Sprintf("ALTER TABLE %s.watchdirectory ADD COLUMN IF NOT EXISTS maxconcurrent INT DEFAULT 0, ADD COLUMN IF NOT EXISTS priority INT DEFAULT 0, ADD COLUMN IF NOT EXISTS disposition STRING DEFAULT '', ADD COLUMN IF NOT EXISTS archivepath STRING DEFAULT '', ADD COLUMN IF NOT EXISTS quarantinepath STRING DEFAULT '', ADD COLUMN IF NOT EXISTS retentiondays INT DEFAULT 0, ADD COLUMN IF NOT EXISTS watchmode STRING DEFAULT '', ADD COLUMN IF NOT EXISTS pollinterval INT DEFAULT 0, ADD COLUMN IF NOT EXISTS lineparser STRING DEFAULT '', ADD COLUMN IF NOT EXISTS linepattern STRING DEFAULT '', ADD COLUMN IF NOT EXISTS duplicatepolicy STRING DEFAULT '', ADD COLUMN IF NOT EXISTS loadmode STRING DEFAULT '', ADD COLUMN IF NOT EXISTS keycolumns STRING DEFAULT '';", cfg.Database)
+	s.logger.Info("alter table", zap.String("sql", sqlStr))
+	stmt, err = db.Prepare(sqlStr)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+
 	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.extractrule ( id STRING PRIMARY KEY, watchdirectoryid STRING NOT NULL, columnname STRING NOT NULL, rulesource STRING NOT NULL, matchvalues STRING, lastupdated TIMESTAMP);", cfg.Database)
 	s.logger.Info("create table", zap.String("sql", sqlStr))
 	stmt, err = db.Prepare(sqlStr)
@@ -82,5 +94,125 @@ func (s *Server) verify() error {
 	}
 	s.logger.Info("transformrule Table created successfully..")
 
+	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.extractqueue ( id STRING PRIMARY KEY, watchdirectoryid STRING NOT NULL, watchdirname STRING NOT NULL, scheme STRING NOT NULL, filepath STRING NOT NULL, tablename STRING NOT NULL, priority INT DEFAULT 0, createdtime TIMESTAMP, resume BOOL DEFAULT false, duplicate STRING DEFAULT '', decision STRING DEFAULT '', sourcepath STRING DEFAULT '', sourceversion STRING DEFAULT '');", cfg.Database)
+	s.logger.Info("create table", zap.String("sql", sqlStr))
+	stmt, err = db.Prepare(sqlStr)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+	s.logger.Info("extractqueue Table created successfully..")
+
+	// work queued before an upgrade lacks the later columns
+	sqlStr = fmt.Sprintf("ALTER TABLE %s.extractqueue ADD COLUMN IF NOT EXISTS resume BOOL DEFAULT false, ADD COLUMN IF NOT EXISTS duplicate STRING DEFAULT '', ADD COLUMN IF NOT EXISTS decision STRING DEFAULT '', ADD COLUMN IF NOT EXISTS sourcepath STRING DEFAULT '', ADD COLUMN IF NOT EXISTS sourceversion STRING DEFAULT '';", cfg.Database)
+	s.logger.Info("alter table", zap.String("sql", sqlStr))
+	stmt, err = db.Prepare(sqlStr)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+
+	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.extractoutcome ( id STRING PRIMARY KEY, watchdirectoryid STRING NOT NULL, filepath STRING NOT NULL, status STRING NOT NULL, attempts INT DEFAULT 0, decision STRING DEFAULT '', lastupdated TIMESTAMP);", cfg.Database)
+	s.logger.Info("create table", zap.String("sql", sqlStr))
+	stmt, err = db.Prepare(sqlStr)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+	s.logger.Info("extractoutcome Table created successfully..")
+
+	// outcomes recorded before an upgrade lack the decision
+	sqlStr = fmt.Sprintf("ALTER TABLE %s.extractoutcome ADD COLUMN IF NOT EXISTS decision STRING DEFAULT '';", cfg.Database)
+	s.logger.Info("alter table", zap.String("sql", sqlStr))
+	stmt, err = db.Prepare(sqlStr)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+
+	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.watchsnapshot ( watchdirectoryid STRING NOT NULL, path STRING NOT NULL, size INT NOT NULL, modtime TIMESTAMP, PRIMARY KEY (watchdirectoryid, path));", cfg.Database)
+	s.logger.Info("create table", zap.String("sql", sqlStr))
+	stmt, err = db.Prepare(sqlStr)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+	s.logger.Info("watchsnapshot Table created successfully..")
+
+	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.sourcewatermark ( name STRING PRIMARY KEY, watermark STRING NOT NULL, lastupdated TIMESTAMP);", cfg.Database)
+	s.logger.Info("create table", zap.String("sql", sqlStr))
+	stmt, err = db.Prepare(sqlStr)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+	s.logger.Info("sourcewatermark Table created successfully..")
+
+	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.sourceschedule ( name STRING PRIMARY KEY, kind STRING NOT NULL, cronexpr STRING NOT NULL, paused BOOL DEFAULT false, runrequested BOOL DEFAULT false, lastrun TIMESTAMP, nextrun TIMESTAMP, laststatus STRING, lastupdated TIMESTAMP);", cfg.Database)
+	s.logger.Info("create table", zap.String("sql", sqlStr))
+	stmt, err = db.Prepare(sqlStr)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+	s.logger.Info("sourceschedule Table created successfully..")
+
+	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.tailoffset ( watchdirectoryid STRING NOT NULL, path STRING NOT NULL, inode INT NOT NULL, byteoffset INT NOT NULL, lastupdated TIMESTAMP, PRIMARY KEY (watchdirectoryid, path));", cfg.Database)
+	s.logger.Info("create table", zap.String("sql", sqlStr))
+	stmt, err = db.Prepare(sqlStr)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+	s.logger.Info("tailoffset Table created successfully..")
+
+	sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.extractcheckpoint ( path STRING PRIMARY KEY, watchdirectoryid STRING NOT NULL, watchdirname STRING NOT NULL, scheme STRING NOT NULL, tablename STRING NOT NULL, dataprov STRING NOT NULL, size INT NOT NULL, modtime TIMESTAMP, rowoffset INT NOT NULL, chunksize INT DEFAULT 0, chunks STRING DEFAULT '', resumes INT DEFAULT 0, lastupdated TIMESTAMP);", cfg.Database)
+	s.logger.Info("create table", zap.String("sql", sqlStr))
+	stmt, err = db.Prepare(sqlStr)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+	s.logger.Info("extractcheckpoint Table created successfully..")
+
+	// checkpoints written before chunked extraction lack its columns
+	sqlStr = fmt.Sprintf("ALTER TABLE %s.extractcheckpoint ADD COLUMN IF NOT EXISTS chunksize INT DEFAULT 0, ADD COLUMN IF NOT EXISTS chunks STRING DEFAULT '';", cfg.Database)
+	s.logger.Info("alter table", zap.String("sql", sqlStr))
+	stmt, err = db.Prepare(sqlStr)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.Exec()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
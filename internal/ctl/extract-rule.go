@@ -37,6 +37,10 @@ func (s *Server) CreateExtractRule(ctx context.Context, request *pb.CreateExtrac
 		return nil, status.Errorf(codes.InvalidArgument,
 			"extract rule source is required")
 	}
+	_, err = watch.CompileMatchValues(rule.MatchValues)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
 
 	pgConnectString := s.DBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource)
 	s.logger.Info("extract db creds", zap.String("pgConnectString", pgConnectString))
@@ -86,6 +90,10 @@ func (s *Server) UpdateExtractRule(ctx context.Context, request *pb.UpdateExtrac
 		return nil, status.Errorf(codes.InvalidArgument,
 			err.Error())
 	}
+	_, err = watch.CompileMatchValues(rule.MatchValues)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
 
 	//WatchDirectories[request.PipelineId][request.WatchdirId].ExtractRules[rule.Id] = rule
 	pgConnectString := s.DBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource)
@@ -0,0 +1,74 @@
+package ctl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"gitlab.com/churro-group/churro/internal/extract"
+	"gitlab.com/churro-group/churro/internal/transform"
+	"gitlab.com/churro-group/churro/internal/watch"
+	pb "gitlab.com/churro-group/churro/rpc/ctl"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PreviewExtract runs the extract and transform rules of a watch
+// directory, named by name or id, on the first rows of a sample file
+// without registering or loading anything
+func (s *Server) PreviewExtract(ctx context.Context, request *pb.PreviewExtractRequest) (response *pb.PreviewExtractResponse, err error) {
+
+	response = &pb.PreviewExtractResponse{}
+	if request.Watchdir == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "watch directory is required")
+	}
+	if len(request.FileContent) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "sample file %s is empty", request.FileName)
+	}
+
+	db, err := sql.Open("postgres", s.DBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	defer db.Close()
+
+	dirs, err := watch.GetWatchDirectories(db)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	var dir *watch.WatchDirectory
+	for i := range dirs {
+		if dirs[i].Name == request.Watchdir || dirs[i].Id == request.Watchdir {
+			dir = &dirs[i]
+			break
+		}
+	}
+	if dir == nil {
+		return nil, status.Errorf(codes.NotFound, "watch directory %s not found", request.Watchdir)
+	}
+	if request.Truncated && extract.PreviewNeedsWholeFile(*dir) {
+		return nil, status.Errorf(codes.InvalidArgument, "sample file %s is over %d bytes, a %s preview needs a smaller sample", request.FileName, extract.MAX_PREVIEW_BYTES, dir.Scheme)
+	}
+
+	functions, err := transform.GetTransformFunctions(db)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	rules, err := transform.GetTransformRules(db)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	preview, err := extract.PreviewExtract(*dir, request.FileContent, int(request.Rows), rules, functions, s.logger)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "preview of %s %s", request.FileName, err.Error())
+	}
+
+	b, err := json.Marshal(preview)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	response.PreviewString = string(b)
+
+	return response, nil
+}
@@ -0,0 +1,85 @@
+package ctl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"gitlab.com/churro-group/churro/internal/watch"
+	pb "gitlab.com/churro-group/churro/rpc/ctl"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetSchedules returns the scheduled sources with their last and
+// next run times
+func (s *Server) GetSchedules(ctx context.Context, request *pb.GetSchedulesRequest) (response *pb.GetSchedulesResponse, err error) {
+
+	response = &pb.GetSchedulesResponse{}
+	db, err := sql.Open("postgres", s.DBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	defer db.Close()
+
+	values, err := watch.GetSourceSchedules(db)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	response.SchedulesString = string(b)
+
+	return response, nil
+}
+
+// UpdateSchedule pauses or resumes the schedule of a source
+func (s *Server) UpdateSchedule(ctx context.Context, request *pb.UpdateScheduleRequest) (response *pb.UpdateScheduleResponse, err error) {
+
+	response = &pb.UpdateScheduleResponse{}
+	if request.Name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "schedule name is required")
+	}
+
+	db, err := sql.Open("postgres", s.DBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	defer db.Close()
+
+	sched := watch.SourceSchedule{Name: request.Name, Paused: request.Paused}
+	err = sched.UpdatePaused(db)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "schedule %s %s", request.Name, err.Error())
+	}
+
+	return response, nil
+}
+
+// RunSchedule asks churro-watch to run a scheduled source now, the
+// run starts at the next scheduler tick even if the schedule is
+// paused
+func (s *Server) RunSchedule(ctx context.Context, request *pb.RunScheduleRequest) (response *pb.RunScheduleResponse, err error) {
+
+	response = &pb.RunScheduleResponse{}
+	if request.Name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "schedule name is required")
+	}
+
+	db, err := sql.Open("postgres", s.DBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	defer db.Close()
+
+	sched := watch.SourceSchedule{Name: request.Name}
+	err = sched.RequestRun(db)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "schedule %s %s", request.Name, err.Error())
+	}
+
+	return response, nil
+}
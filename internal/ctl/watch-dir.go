@@ -46,6 +46,26 @@ func (s *Server) CreateWatchDirectory(ctx context.Context, request *pb.CreateWat
 		return nil, status.Errorf(codes.InvalidArgument,
 			"watch directory tablename is required")
 	}
+	err = watch.ValidDisposition(wdir.Disposition)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	err = watch.ValidDuplicatePolicy(wdir.DuplicatePolicy)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	err = watch.ValidLoadMode(wdir)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	err = watch.ValidWatchMode(wdir.WatchMode)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	err = watch.ValidLineParser(wdir)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
 
 	pgConnectString := s.DBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource)
 	s.logger.Info("extract db creds", zap.String("pgConnectString", pgConnectString))
@@ -153,6 +173,26 @@ func (s *Server) UpdateWatchDirectory(ctx context.Context, request *pb.UpdateWat
 		return nil, status.Errorf(codes.InvalidArgument,
 			err.Error())
 	}
+	err = watch.ValidDisposition(f.Disposition)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	err = watch.ValidDuplicatePolicy(f.DuplicatePolicy)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	err = watch.ValidLoadMode(f)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	err = watch.ValidWatchMode(f.WatchMode)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+	err = watch.ValidLineParser(f)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
 
 	pgConnectString := s.DBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource)
 	s.logger.Info("extract db creds", zap.String("pgConnectString", pgConnectString))
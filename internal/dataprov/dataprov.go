@@ -5,8 +5,12 @@
 package dataprov
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"os"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -21,6 +25,24 @@ type DataProvenance struct {
 	Name        string
 	Path        string
 	CreatedTime time.Time
+	// Source is the remote path a downloaded file came from and
+	// ETag the version of it, the ETag is only recorded once the
+	// extraction of the file succeeded
+	Source string
+	ETag   string
+	// ParentId is the provenance of the file a chunk was split
+	// from when the file is extracted in parallel chunks
+	ParentId string
+	// Hash is the hex SHA-256 of a file's content and Size its
+	// length, they are empty for sources that are not files
+	Hash string
+	Size int64
+	// Version counts the loads of the same content under the
+	// version duplicate policy, PreviousId is the load before
+	Version    int
+	PreviousId string
+	// Loaded is set once the extraction of the file succeeded
+	Loaded bool
 }
 
 // Register a new data provenance instance, return an error
@@ -29,6 +51,10 @@ func Register(dp *DataProvenance, pipeline v1alpha1.Pipeline, dbCreds config.DBC
 
 	dp.CreatedTime = time.Now()
 	dp.Id = xid.New().String()
+	if dp.Version == 0 {
+		dp.Version = 1
+	}
+
 	// register the id with the churro data store
 
 	err = insertDataprov(*dp, pipeline, dbCreds, logger)
@@ -54,14 +80,81 @@ func insertDataprov(dp DataProvenance, cfg v1alpha1.Pipeline, dbCreds config.DBC
 	}
 	defer db.Close()
 
-	insertStmt, err := db.Prepare("INSERT into DATAPROV (id, name, path, createdtime) values ($1, $2, $3, $4)")
+	insertStmt, err := db.Prepare("INSERT into DATAPROV (id, name, path, createdtime, etag, parentid, hash, size, version, previousid, source, loaded) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)")
 	if err != nil {
 		return err
 	}
 	defer insertStmt.Close()
-	if _, err := insertStmt.Exec(dp.Id, dp.Name, dp.Path, dp.CreatedTime); err != nil {
+	if _, err := insertStmt.Exec(dp.Id, dp.Name, dp.Path, dp.CreatedTime, dp.ETag, dp.ParentId, dp.Hash, dp.Size, dp.Version, dp.PreviousId, dp.Source, dp.Loaded); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// ObjectSeen reports whether the version etag of the remote object
+// at path was already loaded
+func ObjectSeen(path, etag string, pipeline v1alpha1.Pipeline, dbCreds config.DBCredentials) (bool, error) {
+	db, err := sql.Open("postgres", dbCreds.GetDBConnectString(pipeline.Spec.DataSource))
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM DATAPROV WHERE source = $1 AND etag = $2 AND loaded = true", path, etag).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// SetLoaded records that the extraction registered as id succeeded,
+// etag is the version of the remote object the file came from if any
+func SetLoaded(id, etag string, pipeline v1alpha1.Pipeline, dbCreds config.DBCredentials) error {
+	db, err := sql.Open("postgres", dbCreds.GetDBConnectString(pipeline.Spec.DataSource))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec("UPDATE DATAPROV SET loaded = true, etag = $2 WHERE id = $1", id, etag)
+	return err
+}
+
+// HashFile returns the hex SHA-256 of the content of the file at
+// path and its size
+func HashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// FindByHash returns the latest loaded file with the content hash,
+// found is false when the content was never loaded
+func FindByHash(hash string, pipeline v1alpha1.Pipeline, dbCreds config.DBCredentials) (dp DataProvenance, found bool, err error) {
+	db, err := sql.Open("postgres", dbCreds.GetDBConnectString(pipeline.Spec.DataSource))
+	if err != nil {
+		return dp, false, err
+	}
+	defer db.Close()
+
+	row := db.QueryRow("SELECT id, name, path, createdtime, hash, size, version FROM DATAPROV WHERE hash = $1 AND parentid = '' AND loaded = true ORDER BY createdtime DESC LIMIT 1", hash)
+	switch err := row.Scan(&dp.Id, &dp.Name, &dp.Path, &dp.CreatedTime, &dp.Hash, &dp.Size, &dp.Version); err {
+	case sql.ErrNoRows:
+		return dp, false, nil
+	case nil:
+		return dp, true, nil
+	default:
+		return dp, false, err
+	}
+}
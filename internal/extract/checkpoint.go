@@ -0,0 +1,172 @@
+package extract
+
+import (
+	"database/sql"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/internal/watch"
+)
+
+var (
+	// checkpointRows is how many acknowledged rows may go by
+	// before the checkpoint of a file is written again
+	checkpointRows int64 = 1000
+
+	// checkpointInterval bounds how long an extraction that is
+	// making progress goes without writing its checkpoint
+	checkpointInterval = 30 * time.Second
+)
+
+// checkpointer records in the admin database how far the loader has
+// acknowledged the rows of the file being extracted, a checkpointer
+// without a database does nothing so the extraction carries on
+type checkpointer struct {
+	mu        sync.Mutex
+	logger    *zap.SugaredLogger
+	db        *sql.DB
+	cp        watch.ExtractCheckpoint
+	resumed   bool
+	savedRows int64
+	savedTime time.Time
+}
+
+// newCheckpointer opens the checkpoint of the file being extracted,
+// when the file is unchanged since the checkpoint was written the
+// extraction continues from it.  This holds whether or not a resume
+// was asked for since a retry of a failed job is not told it resumes.
+func (s *Server) newCheckpointer(info os.FileInfo) *checkpointer {
+	c := &checkpointer{
+		logger: s.logger,
+		cp: watch.ExtractCheckpoint{
+			Path:         s.FileName,
+			WatchDirName: s.WatchDirName,
+			Scheme:       s.SchemeValue,
+			Tablename:    s.TableName,
+			Size:         info.Size(),
+			ModTime:      info.ModTime(),
+		},
+		savedTime: time.Now(),
+	}
+	for _, d := range s.WatchDirectory {
+		if d.Name == s.WatchDirName {
+			c.cp.WatchDirectoryId = d.Id
+		}
+	}
+
+	db, err := sql.Open("postgres", s.AdminDBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource))
+	if err != nil {
+		s.logger.Errorf("checkpoints disabled, could not open the admin db %s\n", err.Error())
+		return c
+	}
+	c.db = db
+
+	existing, found, err := watch.GetExtractCheckpoint(s.FileName, db)
+	if err != nil {
+		s.logger.Errorf("could not get the checkpoint of %s %s\n", s.FileName, err.Error())
+		return c
+	}
+	if !found {
+		if s.Resume {
+			s.logger.Infof("%s has no checkpoint to resume, extracting from the start\n", s.FileName)
+		}
+		return c
+	}
+	if !existing.Matches(c.cp.Size, c.cp.ModTime) {
+		s.logger.Infof("%s changed since its checkpoint, extracting from the start\n", s.FileName)
+		return c
+	}
+
+	existing.WatchDirectoryId = c.cp.WatchDirectoryId
+	c.cp = existing
+	c.resumed = true
+	c.savedRows = existing.Rows
+	s.logger.Infof("resuming %s after row %d dataprov %s\n", s.FileName, existing.Rows, existing.Dataprov)
+	return c
+}
+
+// start records the dataprov of a fresh extraction
+func (c *checkpointer) start(dataprov string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cp.Dataprov = dataprov
+	c.cp.Rows = 0
+	c.cp.ChunkSize = 0
+	c.cp.Chunks = nil
+	c.cp.Resumes = 0
+	c.write()
+}
+
+// startChunks records the chunks of a fresh parallel extraction
+func (c *checkpointer) startChunks(chunkSize int64, chunks []watch.ChunkCheckpoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cp.ChunkSize = chunkSize
+	c.cp.Chunks = chunks
+	c.write()
+}
+
+// ack moves the checkpoint to rows once the loader accepted them,
+// the admin database is only written every checkpointRows rows or
+// checkpointInterval
+func (c *checkpointer) ack(rows int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cp.Rows = rows
+	c.writeDue()
+}
+
+// ackChunk moves the checkpoint of chunk i to rows, Rows of the
+// checkpoint is the total over all the chunks
+func (c *checkpointer) ackChunk(i int, rows int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cp.Chunks[i].Rows = rows
+	c.cp.Rows = 0
+	for _, chunk := range c.cp.Chunks {
+		c.cp.Rows += chunk.Rows
+	}
+	c.writeDue()
+}
+
+func (c *checkpointer) writeDue() {
+	if c.cp.Rows-c.savedRows < checkpointRows && time.Since(c.savedTime) < checkpointInterval {
+		return
+	}
+	c.write()
+}
+
+func (c *checkpointer) write() {
+	if c.db == nil {
+		return
+	}
+	err := c.cp.Upsert(c.db)
+	if err != nil {
+		c.logger.Errorf("could not write the checkpoint of %s %s\n", c.cp.Path, err.Error())
+		return
+	}
+	c.savedRows = c.cp.Rows
+	c.savedTime = time.Now()
+}
+
+// close removes the checkpoint once the extraction finished, a
+// failed extraction keeps its last progress to be resumed from
+func (c *checkpointer) close(err error) {
+	if c.db == nil {
+		return
+	}
+	defer c.db.Close()
+	if err != nil {
+		c.mu.Lock()
+		c.write()
+		c.mu.Unlock()
+		return
+	}
+	err = c.cp.Delete(c.db)
+	if err != nil {
+		c.logger.Errorf("could not remove the checkpoint of %s %s\n", c.cp.Path, err.Error())
+	}
+}
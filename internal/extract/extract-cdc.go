@@ -0,0 +1,461 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/churrodata"
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
+	"gitlab.com/churro-group/churro/internal/loader"
+	"gitlab.com/churro-group/churro/internal/watch"
+)
+
+const (
+	CDCCockroachDB = "cockroachdb"
+	CDCPostgres    = "postgres"
+
+	// cdcResolvedInterval is how often a changefeed reports that
+	// every change before a timestamp was sent, the cursor is saved
+	// on each of these
+	cdcResolvedInterval = "10s"
+
+	// cdcPollInterval is the wait between reads of a postgres slot
+	// that had no more changes
+	cdcPollInterval = 5 * time.Second
+
+	// cdcChangesPerPeek bounds the changes read from a slot at once
+	cdcChangesPerPeek = 1000
+)
+
+var cursorRegex = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// Extract the changes of a table until ctx is cancelled, inserts and
+// updates are loaded as upserts on the key columns and deletes remove
+// the matching rows, the source's cursor is kept in the admin
+// database and only moved past changes the loader wrote so a restart
+// resumes where it stopped
+func (s *Server) ExtractCDC(ctx context.Context) (err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	src, err := s.getCDCSource()
+	if err != nil {
+		return err
+	}
+	if len(src.KeyColumns) == 0 {
+		return fmt.Errorf("cdc source %s has no key columns", src.Name)
+	}
+	for _, part := range strings.Split(src.Table, ".") {
+		if !columnNameRegex.MatchString(part) {
+			return fmt.Errorf("%s is not a valid table name", src.Table)
+		}
+	}
+
+	connection, err := watch.GetSecretValue(src.ConnectionSecret, sqlConnectionKey)
+	if err != nil {
+		return fmt.Errorf("could not read connection secret of cdc source %s %v", src.Name, err)
+	}
+	srcDB, err := sql.Open("postgres", connection)
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+
+	adminDB, err := sql.Open("postgres", s.AdminDBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource))
+	if err != nil {
+		return fmt.Errorf("could not open the admin database %v", err)
+	}
+	defer adminDB.Close()
+
+	columns, err := cdcSourceColumns(ctx, srcDB, src.Table)
+	if err != nil {
+		return err
+	}
+	for _, k := range src.KeyColumns {
+		if cdcColumnIndex(columns, k) < 0 {
+			return fmt.Errorf("key column %s is not in table %s", k, src.Table)
+		}
+	}
+
+	dp := dataprov.DataProvenance{}
+	dp.Name = src.Name
+	dp.Path = "cdc/" + src.Table
+	err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+	if err != nil {
+		return fmt.Errorf("can not register data prov %v %v", dp, err)
+	}
+	s.logger.Info("dp info ", zap.String("dp", fmt.Sprintf("%+v", dp)))
+
+	cdcStruct := churrodata.CDCFormat{}
+	cdcStruct.Path = dp.Path
+	cdcStruct.Dataprov = dp.Id
+	cdcStruct.Tablename = s.TableName
+	cdcStruct.PipelineName = s.Pi.Name
+	cdcStruct.ColumnNames = columns
+	cdcStruct.ColumnTypes = make([]string, len(columns))
+	for c := range cdcStruct.ColumnTypes {
+		cdcStruct.ColumnTypes[c] = "TEXT"
+	}
+	cdcStruct.KeyColumns = src.KeyColumns
+
+	err = s.tableCheck(cdcStruct.ColumnNames, cdcStruct.ColumnTypes)
+	if err != nil {
+		return err
+	}
+	err = s.grantDelete()
+	if err != nil {
+		return err
+	}
+
+	conn, loaderclient, err := s.dialLoaderClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	push := func(changes []churrodata.CDCChange) error {
+		if len(changes) == 0 {
+			return nil
+		}
+		cdcStruct.Changes = changes
+		someBytes, _ := json.Marshal(cdcStruct)
+		return s.pushConfirmed(ctx, loaderclient, loader.LoaderMessage{Metadata: someBytes, DataFormat: config.CDCScheme})
+	}
+
+	switch src.Type {
+	case CDCCockroachDB:
+		return s.readChangefeed(ctx, srcDB, adminDB, src, columns, push)
+	case CDCPostgres:
+		return s.readReplicationSlot(ctx, srcDB, adminDB, src, columns, push)
+	}
+	return fmt.Errorf("cdc source type %s is not recognized", src.Type)
+}
+
+// readChangefeed runs a sinkless CockroachDB changefeed, the changes
+// are pushed and the cursor saved once they are written each time a
+// resolved timestamp arrives
+func (s *Server) readChangefeed(ctx context.Context, srcDB, adminDB *sql.DB, src v1alpha1.CDCSource, columns []string, push func([]churrodata.CDCChange) error) error {
+	mark, err := watch.GetSourceWatermark(src.Name, adminDB)
+	if err != nil {
+		return fmt.Errorf("could not read cursor %v", err)
+	}
+
+	query := fmt.Sprintf("EXPERIMENTAL CHANGEFEED FOR %s WITH updated, diff, resolved = '%s'", src.Table, cdcResolvedInterval)
+	if mark.Watermark != "" {
+		if !cursorRegex.MatchString(mark.Watermark) {
+			return fmt.Errorf("%s is not a valid changefeed cursor", mark.Watermark)
+		}
+		query += fmt.Sprintf(", cursor = '%s'", mark.Watermark)
+	}
+	s.logger.Info(query)
+
+	rows, err := srcDB.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	changes := make([]churrodata.CDCChange, 0)
+	for rows.Next() {
+		var table sql.NullString
+		var key, value []byte
+		err = rows.Scan(&table, &key, &value)
+		if err != nil {
+			return err
+		}
+
+		change, resolved, err := decodeChangefeedRow(value, columns)
+		if err != nil {
+			s.logger.Errorf("error decoding change of %s %s\n", src.Name, err.Error())
+			continue
+		}
+		if resolved == "" {
+			changes = append(changes, change)
+			if len(changes) >= RecordsPerPush {
+				err = push(changes)
+				if err != nil {
+					return err
+				}
+				changes = make([]churrodata.CDCChange, 0)
+			}
+			continue
+		}
+
+		err = push(changes)
+		if err != nil {
+			return err
+		}
+		changes = make([]churrodata.CDCChange, 0)
+		mark.Watermark = resolved
+		err = mark.Upsert(adminDB)
+		if err != nil {
+			return fmt.Errorf("could not save cursor %v", err)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return rows.Err()
+}
+
+// readReplicationSlot reads a postgres logical replication slot using
+// wal2json, the slot is only advanced past the changes once the loader
+// wrote them so unloaded changes survive a restart
+func (s *Server) readReplicationSlot(ctx context.Context, srcDB, adminDB *sql.DB, src v1alpha1.CDCSource, columns []string, push func([]churrodata.CDCChange) error) error {
+	if src.Slot == "" {
+		return fmt.Errorf("cdc source %s needs a replication slot", src.Name)
+	}
+
+	var count int
+	err := srcDB.QueryRowContext(ctx, "SELECT count(*) FROM pg_replication_slots WHERE slot_name = $1", src.Slot).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		_, err = srcDB.ExecContext(ctx, "SELECT pg_create_logical_replication_slot($1, 'wal2json')", src.Slot)
+		if err != nil {
+			return fmt.Errorf("could not create replication slot %s %v", src.Slot, err)
+		}
+	}
+
+	addTables := src.Table
+	if !strings.Contains(addTables, ".") {
+		addTables = "*." + addTables
+	}
+
+	mark, err := watch.GetSourceWatermark(src.Name, adminDB)
+	if err != nil {
+		return fmt.Errorf("could not read cursor %v", err)
+	}
+
+	for {
+		rows, err := srcDB.QueryContext(ctx, "SELECT lsn::text, data FROM pg_logical_slot_peek_changes($1, NULL, $2, 'format-version', '2', 'add-tables', $3)", src.Slot, cdcChangesPerPeek, addTables)
+		if err != nil {
+			return err
+		}
+
+		changes := make([]churrodata.CDCChange, 0)
+		var read int
+		var lsn string
+		for rows.Next() {
+			var data []byte
+			err = rows.Scan(&lsn, &data)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			read++
+
+			change, ok, err := decodeWal2JSON(data, columns)
+			if err != nil {
+				s.logger.Errorf("error decoding change of %s %s\n", src.Name, err.Error())
+				continue
+			}
+			if ok {
+				changes = append(changes, change)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < len(changes); i += RecordsPerPush {
+			end := i + RecordsPerPush
+			if end > len(changes) {
+				end = len(changes)
+			}
+			err = push(changes[i:end])
+			if err != nil {
+				return err
+			}
+		}
+
+		if read > 0 {
+			_, err = srcDB.ExecContext(ctx, "SELECT pg_replication_slot_advance($1, $2::pg_lsn)", src.Slot, lsn)
+			if err != nil {
+				return fmt.Errorf("could not advance replication slot %s %v", src.Slot, err)
+			}
+			mark.Watermark = lsn
+			err = mark.Upsert(adminDB)
+			if err != nil {
+				return fmt.Errorf("could not save cursor %v", err)
+			}
+		}
+
+		if read < cdcChangesPerPeek {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(cdcPollInterval):
+			}
+		}
+	}
+}
+
+// getCDCSource finds the pipeline cdc source being extracted
+func (s *Server) getCDCSource() (v1alpha1.CDCSource, error) {
+	for _, src := range s.Pi.Spec.CDCSources {
+		if src.Name == s.WatchDirName {
+			return src, nil
+		}
+	}
+	return v1alpha1.CDCSource{}, fmt.Errorf("cdc source %s is not defined in pipeline %s", s.WatchDirName, s.Pi.Name)
+}
+
+// cdcSourceColumns reads the column names of the source table, a
+// table without a schema is looked up in the current schema
+func cdcSourceColumns(ctx context.Context, db *sql.DB, table string) ([]string, error) {
+	query, args := cdcColumnsQuery(table)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make([]string, 0)
+	for rows.Next() {
+		var c string
+		err = rows.Scan(&c)
+		if err != nil {
+			return nil, err
+		}
+		c = strings.ToLower(c)
+		if !columnNameRegex.MatchString(c) {
+			return nil, fmt.Errorf("%s is not a valid column name", c)
+		}
+		columns = append(columns, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s has no columns", table)
+	}
+	return columns, nil
+}
+
+// cdcColumnsQuery builds the information_schema query of a table
+// named table, schema.table or database.schema.table
+func cdcColumnsQuery(table string) (string, []interface{}) {
+	parts := strings.Split(table, ".")
+	query := "SELECT column_name FROM information_schema.columns WHERE table_name = $1"
+	args := []interface{}{parts[len(parts)-1]}
+	if len(parts) > 1 {
+		query += " AND table_schema = $2"
+		args = append(args, parts[len(parts)-2])
+	} else {
+		query += " AND table_schema = current_schema()"
+	}
+	if len(parts) > 2 {
+		query += " AND table_catalog = $3"
+		args = append(args, parts[len(parts)-3])
+	}
+	return query + " ORDER BY ordinal_position", args
+}
+
+func cdcColumnIndex(columns []string, name string) int {
+	for i, c := range columns {
+		if c == strings.ToLower(name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// decodeChangefeedRow decodes the value of a changefeed row, it
+// returns the resolved timestamp when the row is a resolved message
+func decodeChangefeedRow(value []byte, columns []string) (change churrodata.CDCChange, resolved string, err error) {
+	var v struct {
+		After    map[string]interface{} `json:"after"`
+		Before   map[string]interface{} `json:"before"`
+		Resolved string                 `json:"resolved"`
+	}
+	d := json.NewDecoder(bytes.NewReader(value))
+	d.UseNumber()
+	err = d.Decode(&v)
+	if err != nil {
+		return change, "", err
+	}
+
+	switch {
+	case v.Resolved != "":
+		return change, v.Resolved, nil
+	case v.After != nil:
+		return cdcChangeFromMap(churrodata.CDCUpsert, v.After, columns), "", nil
+	case v.Before != nil:
+		return cdcChangeFromMap(churrodata.CDCDelete, v.Before, columns), "", nil
+	}
+	return change, "", fmt.Errorf("change has no row")
+}
+
+// decodeWal2JSON decodes a wal2json format-version 2 change, ok is
+// false for transaction begin and commit messages
+func decodeWal2JSON(data []byte, columns []string) (change churrodata.CDCChange, ok bool, err error) {
+	type column struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	}
+	var v struct {
+		Action   string   `json:"action"`
+		Columns  []column `json:"columns"`
+		Identity []column `json:"identity"`
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	err = d.Decode(&v)
+	if err != nil {
+		return change, false, err
+	}
+
+	row := make(map[string]interface{})
+	var op string
+	switch v.Action {
+	case "I", "U":
+		op = churrodata.CDCUpsert
+		for _, c := range v.Columns {
+			row[c.Name] = c.Value
+		}
+	case "D":
+		op = churrodata.CDCDelete
+		for _, c := range v.Identity {
+			row[c.Name] = c.Value
+		}
+	default:
+		return change, false, nil
+	}
+	return cdcChangeFromMap(op, row, columns), true, nil
+}
+
+func cdcChangeFromMap(op string, row map[string]interface{}, columns []string) churrodata.CDCChange {
+	change := churrodata.CDCChange{Op: op, Cols: make([]string, len(columns))}
+	for k, v := range row {
+		i := cdcColumnIndex(columns, k)
+		if i < 0 {
+			continue
+		}
+		switch t := v.(type) {
+		case nil:
+		case string:
+			change.Cols[i] = t
+		case json.Number:
+			change.Cols[i] = t.String()
+		default:
+			b, _ := json.Marshal(t)
+			change.Cols[i] = string(b)
+		}
+	}
+	return change
+}
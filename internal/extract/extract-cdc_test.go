@@ -0,0 +1,75 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+
+	"gitlab.com/churro-group/churro/internal/churrodata"
+)
+
+func TestDecodeChangefeedRow(t *testing.T) {
+	columns := []string{"id", "name", "tags"}
+
+	change, resolved, err := decodeChangefeedRow([]byte(`{"after": {"id": 12345678901234, "name": "a", "tags": ["x"]}, "before": null, "updated": "1.0"}`), columns)
+	if err != nil || resolved != "" {
+		t.Fatalf("unexpected result %s %v", resolved, err)
+	}
+	if change.Op != churrodata.CDCUpsert || change.Cols[0] != "12345678901234" || change.Cols[1] != "a" || change.Cols[2] != `["x"]` {
+		t.Errorf("unexpected upsert %+v", change)
+	}
+
+	change, _, err = decodeChangefeedRow([]byte(`{"after": null, "before": {"id": 7, "name": "b", "tags": null}}`), columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Op != churrodata.CDCDelete || change.Cols[0] != "7" {
+		t.Errorf("unexpected delete %+v", change)
+	}
+
+	_, resolved, err = decodeChangefeedRow([]byte(`{"resolved": "1609459200000000000.0000000000"}`), columns)
+	if err != nil || resolved != "1609459200000000000.0000000000" {
+		t.Errorf("expected a resolved timestamp, got %s %v", resolved, err)
+	}
+}
+
+func TestDecodeWal2JSON(t *testing.T) {
+	columns := []string{"id", "name"}
+
+	_, ok, err := decodeWal2JSON([]byte(`{"action": "B"}`), columns)
+	if err != nil || ok {
+		t.Errorf("expected begin to be skipped %v %v", ok, err)
+	}
+
+	change, ok, err := decodeWal2JSON([]byte(`{"action": "U", "schema": "public", "table": "t", "columns": [{"name": "id", "type": "integer", "value": 3}, {"name": "name", "type": "text", "value": "c"}], "identity": [{"name": "id", "type": "integer", "value": 3}]}`), columns)
+	if err != nil || !ok {
+		t.Fatalf("unexpected result %v %v", ok, err)
+	}
+	if change.Op != churrodata.CDCUpsert || change.Cols[0] != "3" || change.Cols[1] != "c" {
+		t.Errorf("unexpected update %+v", change)
+	}
+
+	change, ok, err = decodeWal2JSON([]byte(`{"action": "D", "schema": "public", "table": "t", "identity": [{"name": "id", "type": "integer", "value": 3}]}`), columns)
+	if err != nil || !ok {
+		t.Fatalf("unexpected result %v %v", ok, err)
+	}
+	if change.Op != churrodata.CDCDelete || change.Cols[0] != "3" || change.Cols[1] != "" {
+		t.Errorf("unexpected delete %+v", change)
+	}
+}
+
+func TestCDCColumnsQuery(t *testing.T) {
+	query, args := cdcColumnsQuery("orders")
+	if !strings.Contains(query, "table_schema = current_schema()") || len(args) != 1 || args[0] != "orders" {
+		t.Errorf("unexpected query %s %v", query, args)
+	}
+
+	query, args = cdcColumnsQuery("sales.orders")
+	if !strings.Contains(query, "table_schema = $2") || len(args) != 2 || args[1] != "sales" {
+		t.Errorf("unexpected query %s %v", query, args)
+	}
+
+	query, args = cdcColumnsQuery("shop.sales.orders")
+	if !strings.Contains(query, "table_catalog = $3") || len(args) != 3 || args[2] != "shop" {
+		t.Errorf("unexpected query %s %v", query, args)
+	}
+}
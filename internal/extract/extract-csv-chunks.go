@@ -0,0 +1,165 @@
+package extract
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"gitlab.com/churro-group/churro/internal/churrodata"
+	"gitlab.com/churro-group/churro/internal/dataprov"
+	"gitlab.com/churro-group/churro/internal/watch"
+	pb "gitlab.com/churro-group/churro/rpc/loader"
+)
+
+const (
+	// DEFAULT_CSV_CHUNK_WORKERS is how many chunks of a file are
+	// extracted at once when the pipeline does not say
+	DEFAULT_CSV_CHUNK_WORKERS = 4
+)
+
+// csvChunk is a byte range of a csv file holding whole records
+type csvChunk struct {
+	start int64
+	end   int64
+}
+
+// splitCSV splits the records following the header of a csv file
+// into chunks of at least chunkSize bytes, a chunk only ends at a
+// newline outside of a quoted field so no record spans two chunks
+func splitCSV(r io.Reader, chunkSize int64) ([]csvChunk, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	chunks := make([]csvChunk, 0)
+	var pos, start int64
+	inQuote := false
+	header := true
+
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		pos++
+
+		switch {
+		case b == '"':
+			// an escaped quote toggles twice and leaves the state as is
+			inQuote = !inQuote
+		case b == '\n' && !inQuote:
+			if header {
+				header = false
+				start = pos
+				continue
+			}
+			if pos-start >= chunkSize {
+				chunks = append(chunks, csvChunk{start: start, end: pos})
+				start = pos
+			}
+		}
+	}
+
+	if !header && pos > start {
+		chunks = append(chunks, csvChunk{start: start, end: pos})
+	}
+	return chunks, nil
+}
+
+// extractCSVChunks extracts the records of a large csv file as
+// chunks processed in parallel, each chunk has a provenance of its
+// own under the file's and is pushed to the loader independently
+func (s *Server) extractCSVChunks(ctx context.Context, loaderclient pb.LoaderClient, f *os.File, size int64, csvStruct churrodata.CSVFormat, filter rowFilter, cp *checkpointer, chunkSize int64) error {
+	chunks, err := splitCSV(io.NewSectionReader(f, 0, size), chunkSize)
+	if err != nil {
+		return err
+	}
+
+	if cp.resumed {
+		if len(cp.cp.Chunks) != len(chunks) {
+			return fmt.Errorf("checkpoint of %s has %d chunks, the file splits into %d", s.FileName, len(cp.cp.Chunks), len(chunks))
+		}
+	} else {
+		states := make([]watch.ChunkCheckpoint, len(chunks))
+		for i := range chunks {
+			dp := dataprov.DataProvenance{Name: fmt.Sprintf("%s#%d", s.FileName, i), Path: s.FileName, ParentId: csvStruct.Dataprov}
+			err := dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+			if err != nil {
+				return err
+			}
+			states[i].Dataprov = dp.Id
+		}
+		cp.startChunks(chunkSize, states)
+	}
+
+	// the chunk provenance and resume rows do not change once
+	// the workers start
+	dataprovs := make([]string, len(chunks))
+	skips := make([]int64, len(chunks))
+	for i, c := range cp.cp.Chunks {
+		dataprovs[i] = c.Dataprov
+		skips[i] = c.Rows
+	}
+
+	workers := s.Pi.Spec.WatchConfig.CSVChunkWorkers
+	if workers <= 0 {
+		workers = DEFAULT_CSV_CHUNK_WORKERS
+	}
+	s.logger.Infof("extracting %s in %d chunks with %d workers\n", s.FileName, len(chunks), workers)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	next := make(chan int)
+	errs := make(chan error, len(chunks))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				msg := csvStruct
+				msg.Dataprov = dataprovs[i]
+				msg.Chunk = &churrodata.CSVChunk{Index: i, Count: len(chunks), FileDataprov: csvStruct.Dataprov}
+
+				r := csv.NewReader(io.NewSectionReader(f, chunks[i].start, chunks[i].end-chunks[i].start))
+				r.FieldsPerRecord = len(csvStruct.ColumnNames)
+
+				chunk := i
+				rows, err := s.extractCSVRecords(ctx, loaderclient, r, msg, filter, skips[i], func(rows int64) {
+					cp.ackChunk(chunk, rows)
+				})
+				if err != nil {
+					s.logger.Errorf("error extracting chunk %d of %s after row %d %s\n", i, s.FileName, rows, err.Error())
+					errs <- err
+					// the other chunks stop, the file is not resumed
+					cancel()
+					continue
+				}
+				s.logger.Infof("chunk %d of %s extracted, %d rows\n", i, s.FileName, rows)
+			}
+		}()
+	}
+
+dispatch:
+	for i := range chunks {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(next)
+	wg.Wait()
+	close(errs)
+
+	// the first error is the one that cancelled the other chunks
+	if err := <-errs; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
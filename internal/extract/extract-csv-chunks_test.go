@@ -0,0 +1,57 @@
+package extract
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestSplitCSV(t *testing.T) {
+	content := "id,note\n1,plain\n2,\"two\nlines\"\n3,\"quoted \"\"comma,\"\"\"\n4,last"
+	r := strings.NewReader(content)
+
+	tests := []struct {
+		chunkSize int64
+		chunks    int
+	}{
+		{1, 4},
+		{12, 3},
+		{1000, 1},
+	}
+	for _, tt := range tests {
+		chunks, err := splitCSV(strings.NewReader(content), tt.chunkSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunks) != tt.chunks {
+			t.Fatalf("chunk size %d unexpected chunks %+v", tt.chunkSize, chunks)
+		}
+
+		// the chunks cover the records after the header exactly once
+		ids := make([]string, 0)
+		next := int64(len("id,note\n"))
+		for _, c := range chunks {
+			if c.start != next {
+				t.Fatalf("chunk size %d chunk %+v does not follow %d", tt.chunkSize, c, next)
+			}
+			next = c.end
+			cr := csv.NewReader(strings.NewReader(content[c.start:c.end]))
+			cr.FieldsPerRecord = 2
+			records, err := cr.ReadAll()
+			if err != nil {
+				t.Fatalf("chunk size %d chunk %+v %v", tt.chunkSize, c, err)
+			}
+			for _, record := range records {
+				ids = append(ids, record[0])
+			}
+		}
+		if next != r.Size() || strings.Join(ids, ",") != "1,2,3,4" {
+			t.Errorf("chunk size %d unexpected records %v ending at %d", tt.chunkSize, ids, next)
+		}
+	}
+
+	chunks, _ := splitCSV(strings.NewReader("id,note\n"), 1)
+	if len(chunks) != 0 {
+		t.Errorf("expected no chunks for a header only file %+v", chunks)
+	}
+}
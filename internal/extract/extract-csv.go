@@ -8,16 +8,20 @@ import (
 	"io"
 	"os"
 	"strings"
-	"time"
+
+	"google.golang.org/grpc/credentials"
 
 	"gitlab.com/churro-group/churro/internal/churrodata"
 	"gitlab.com/churro-group/churro/internal/config"
 	"gitlab.com/churro-group/churro/internal/dataprov"
 	"gitlab.com/churro-group/churro/internal/loader"
 	"gitlab.com/churro-group/churro/internal/transform"
+	pb "gitlab.com/churro-group/churro/rpc/loader"
 )
 
-// Extract a CSV file contents and exit
+// Extract a CSV file contents and exit, each batch is pushed once the
+// loader accepted the previous one so the checkpoint only moves past
+// acknowledged rows and an interrupted extraction can be resumed
 func (s *Server) ExtractCSV(ctx context.Context) (err error) {
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -30,20 +34,53 @@ func (s *Server) ExtractCSV(ctx context.Context) (err error) {
 		s.logger.Errorf("could not open csv file %s %s\n", s.FileName, err.Error())
 		return err
 	}
+	defer csvfile.Close()
 
-	dp := dataprov.DataProvenance{Name: s.FileName, Path: s.FileName}
-	err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+	info, err := csvfile.Stat()
 	if err != nil {
-		s.logger.Errorf("can not register data prov %s\n", err.Error())
-		os.Exit(1)
+		return err
+	}
+	cp := s.newCheckpointer(info)
+	defer func() {
+		cp.close(err)
+	}()
+
+	dp := dataprov.DataProvenance{Name: s.FileName, Path: s.FileName}
+	if cp.resumed {
+		// rows loaded before the interruption keep their dataprov
+		dp.Id = cp.cp.Dataprov
+		s.dataprovId = dp.Id
+	} else {
+		err = s.registerFile(&dp)
+		if err != nil {
+			s.logger.Errorf("can not register data prov %s\n", err.Error())
+			return err
+		}
+		cp.start(dp.Id)
 	}
 	s.logger.Infof("dp info %s\n", fmt.Sprintf("%v", dp))
 
-	r := csv.NewReader(csvfile)
+	creds, err := credentials.NewClientTLSFromFile(s.ServiceCreds.ServiceCrt, "")
+	if err != nil {
+		return err
+	}
+	conn, err := s.dialLoader(creds)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	loaderclient := pb.NewLoaderClient(conn)
 
-	go s.pushToLoader(ctx, config.CSVScheme)
+	r := csv.NewReader(csvfile)
 
-	time.Sleep(time.Second * time.Duration(sleepTime))
+	// process the csv header which we expect to be there
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
 	csvStruct := churrodata.CSVFormat{}
 	csvStruct.Path = s.FileName
@@ -51,83 +88,122 @@ func (s *Server) ExtractCSV(ctx context.Context) (err error) {
 	csvStruct.PipelineName = s.Pi.Name
 	csvStruct.ColumnNames = make([]string, 0)
 	csvStruct.ColumnTypes = make([]string, 0)
+	for i := 0; i < len(header); i++ {
+		csvStruct.ColumnNames = append(csvStruct.ColumnNames, strings.Trim(header[i], "\t \n"))
+		csvStruct.ColumnTypes = append(csvStruct.ColumnTypes, "TEXT")
+	}
+	err = s.tableCheck(csvStruct.ColumnNames, csvStruct.ColumnTypes)
+	if err != nil {
+		return err
+	}
+	csvStruct.Tablename = s.TableName
+	csvStruct.Load = s.watchDirLoad()
+	filter, err := newRowFilter(csvStruct.ColumnNames, s.watchDirRules())
+	if err != nil {
+		return err
+	}
+
+	// a resumed extraction splits the file as it did before
+	chunkSize := s.Pi.Spec.WatchConfig.CSVChunkSize
+	if cp.resumed {
+		chunkSize = cp.cp.ChunkSize
+	}
+	if chunkSize > 0 && info.Size() > chunkSize {
+		return s.extractCSVChunks(ctx, loaderclient, csvfile, info.Size(), csvStruct, filter, cp, chunkSize)
+	}
+
+	rows, err := s.extractCSVRecords(ctx, loaderclient, r, csvStruct, filter, cp.cp.Rows, cp.ack)
+	if err != nil {
+		s.logger.Errorf("error extracting %s after row %d %s\n", s.FileName, rows, err.Error())
+		return err
+	}
+
+	s.logger.Infof("end of CSV file reached, %d rows\n", rows)
+
+	return nil
+}
 
-	firstRow := true
-	// for now, only a single row per Queue message
+// extractCSVRecords transforms the records of r and pushes them to
+// the loader in batches, the first skip rows were acknowledged by
+// an interrupted extraction and are only read.  ack is called with
+// the rows read so far each time the loader accepts a batch.
+func (s *Server) extractCSVRecords(ctx context.Context, loaderclient pb.LoaderClient, r *csv.Reader, csvStruct churrodata.CSVFormat, filter rowFilter, skip int64, ack func(rows int64)) (rows int64, err error) {
 	csvStruct.Records = make([]churrodata.CSVRow, 0)
+	var chunk *churrodata.CSVChunk
+	if csvStruct.Chunk != nil {
+		c := *csvStruct.Chunk
+		c.FirstRow = skip + 1
+		chunk = &c
+		csvStruct.Chunk = chunk
+	}
 
-	for {
-		// back-pressure check
-		if backPressure == 1 {
-			s.logger.Info("sleeping due to backpressure...")
-			time.Sleep(time.Second * time.Duration(sleepTime))
-			continue
+	push := func(last bool) error {
+		if chunk != nil {
+			chunk.Last = last
+		}
+		csvBytes, _ := json.Marshal(csvStruct)
+		msg := loader.LoaderMessage{
+			Metadata:   csvBytes,
+			DataFormat: config.CSVScheme,
 		}
+		err := s.pushConfirmed(ctx, loaderclient, msg)
+		if err != nil {
+			return err
+		}
+		ack(rows)
+		csvStruct.Records = make([]churrodata.CSVRow, 0)
+		csvStruct.Skipped = 0
+		if chunk != nil {
+			chunk.FirstRow = rows + 1
+		}
+		return nil
+	}
 
+	for {
 		record, err := r.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return err
+			return rows, err
 		}
 
-		// process the csv header which we expect to be there
-		if firstRow {
-			firstRow = false
-			for i := 0; i < len(record); i++ {
-				csvStruct.ColumnNames = append(csvStruct.ColumnNames, strings.Trim(record[i], "\t \n"))
-				csvStruct.ColumnTypes = append(csvStruct.ColumnTypes, "TEXT")
-			}
-			err := s.tableCheck(csvStruct.ColumnNames, csvStruct.ColumnTypes)
-			if err != nil {
-				return err
-			}
-			csvStruct.Tablename = s.TableName
-		} else {
-			fmt.Printf("transform rules %v\n", s.TransformRules)
+		rows++
+		if rows <= skip {
+			continue
+		}
 
-			err := transform.RunRules(config.CSVScheme, csvStruct.ColumnNames, record, s.TransformRules, s.TransformFunctions, s.logger)
-			if err != nil {
-				s.logger.Errorf("error in runRules %s\n", err.Error())
-			}
+		if !filter.keep(record) {
+			csvStruct.Skipped++
+			continue
+		}
 
-			r := getCSVRow(record)
-			csvStruct.Records = append(csvStruct.Records, r)
-			s.logger.Debugf("csv record read %s\n", fmt.Sprintf("%v", record))
-			if s.Queue == nil {
-				s.logger.Debug("Info: queue is nil")
-			}
-			s.logger.Debugf("queue len %d\n", len(s.Queue))
-
-			if len(csvStruct.Records) >= RecordsPerPush {
-				s.logger.Info("pushing to Queue")
-				//convert csvStruct into []byte
-				csvBytes, _ := json.Marshal(csvStruct)
-				msg := loader.LoaderMessage{
-					Metadata:   csvBytes,
-					DataFormat: config.CSVScheme,
-				}
-				s.Queue <- msg
-				csvStruct.Records = make([]churrodata.CSVRow, 0)
-			}
+		err = transform.RunRules(config.CSVScheme, csvStruct.ColumnNames, record, s.TransformRules, s.TransformFunctions, s.logger)
+		if err != nil {
+			s.logger.Errorf("error in runRules %s\n", err.Error())
 		}
 
-	}
+		csvStruct.Records = append(csvStruct.Records, getCSVRow(record))
+		s.logger.Debugf("csv record read %s\n", fmt.Sprintf("%v", record))
 
-	if len(csvStruct.Records) > 0 {
-		csvBytes, _ := json.Marshal(csvStruct)
-		msg := loader.LoaderMessage{
-			Metadata:   csvBytes,
-			DataFormat: config.CSVScheme,
+		if len(csvStruct.Records) >= FileRecordsPerPush {
+			s.logger.Debug("pushing to loader")
+			err := push(false)
+			if err != nil {
+				return rows, err
+			}
 		}
-		s.Queue <- msg
 	}
 
-	s.logger.Info("end of CSV file reached, cancelling pushes...")
-	time.Sleep(time.Second * 10)
-
-	return err
+	// the last message of a chunk is sent even when empty so the
+	// loader learns the chunk is complete
+	if len(csvStruct.Records) > 0 || csvStruct.Skipped > 0 || chunk != nil {
+		err := push(true)
+		if err != nil {
+			return rows, err
+		}
+	}
+	return rows, nil
 }
 
 func getCSVRow(record []string) churrodata.CSVRow {
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"go.uber.org/zap"
-	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -42,8 +42,11 @@ func (s *Server) ExtractFinnhubStocks(ctx context.Context) (err error) {
 	defer w.Close()
 
 	// subscribe to the wss feed
-	// TODO get the stocks from the WatchSocket used in this config
 	symbols := []string{"AAPL", "AMZN"}
+	socket, err := s.getWatchSocket()
+	if err == nil && len(socket.Stocks) > 0 {
+		symbols = socket.Stocks
+	}
 	for _, s := range symbols {
 		msg, _ := json.Marshal(map[string]interface{}{"type": "subscribe", "symbol": s})
 		w.WriteMessage(websocket.TextMessage, msg)
@@ -56,7 +59,7 @@ func (s *Server) ExtractFinnhubStocks(ctx context.Context) (err error) {
 	err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
 	if err != nil {
 		s.logger.Error("can not register data prov", zap.Error(err))
-		os.Exit(1)
+		return err
 	}
 	s.logger.Info("dp info ", zap.String("dp", fmt.Sprintf("%+v", dp)))
 
@@ -93,7 +96,7 @@ func (s *Server) ExtractFinnhubStocks(ctx context.Context) (err error) {
 
 	for {
 		// back-pressure check
-		if backPressure == 1 {
+		if atomic.LoadInt32(&backPressure) == 1 {
 			fmt.Printf("sleeping due to backpressure...")
 			time.Sleep(time.Second * time.Duration(sleepTime))
 			continue
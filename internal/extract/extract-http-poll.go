@@ -0,0 +1,326 @@
+package extract
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohler55/ojg/jp"
+	"github.com/ohler55/ojg/oj"
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/churrodata"
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
+	"gitlab.com/churro-group/churro/internal/loader"
+	"gitlab.com/churro-group/churro/internal/watch"
+)
+
+const (
+	PaginationCursor = "cursor"
+	PaginationPage   = "page"
+	PaginationLink   = "link"
+
+	DEFAULT_HTTP_POLL_INTERVAL = 60
+	DEFAULT_HTTP_MAX_PAGES     = 100
+)
+
+var linkNextRegex = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+// Extract from an http source by polling it on its interval until
+// ctx is cancelled, or once when it has a schedule, the source's
+// watermark is kept in the admin database so each poll only reads
+// newer records, it is only moved once the loader wrote the records
+// read up to it
+func (s *Server) ExtractHTTPPoll(ctx context.Context) (err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	src, err := s.getHTTPSource()
+	if err != nil {
+		return err
+	}
+	if len(src.ExtractRules) == 0 {
+		return fmt.Errorf("http source %s has no extract rules", src.Name)
+	}
+	rules, err := compileSocketRules(src.RecordPath, src.ExtractRules)
+	if err != nil {
+		return err
+	}
+
+	adminDB, err := sql.Open("postgres", s.AdminDBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource))
+	if err != nil {
+		return fmt.Errorf("could not open the admin database %v", err)
+	}
+	defer adminDB.Close()
+
+	dp := dataprov.DataProvenance{}
+	dp.Name = src.Name
+	dp.Path = src.URL
+	err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+	if err != nil {
+		return fmt.Errorf("can not register data prov %v %v", dp, err)
+	}
+	s.logger.Info("dp info ", zap.String("dp", fmt.Sprintf("%+v", dp)))
+
+	jsonStruct := churrodata.JsonPathFormat{}
+	jsonStruct.Path = src.URL
+	jsonStruct.Dataprov = dp.Id
+	jsonStruct.Tablename = s.TableName
+	jsonStruct.PipelineName = s.Pi.Name
+	jsonStruct.ColumnNames = make([]string, 0)
+	jsonStruct.ColumnTypes = make([]string, 0)
+	for _, r := range src.ExtractRules {
+		jsonStruct.ColumnNames = append(jsonStruct.ColumnNames, r.ColumnName)
+		jsonStruct.ColumnTypes = append(jsonStruct.ColumnTypes, "TEXT")
+	}
+
+	err = s.tableCheck(jsonStruct.ColumnNames, jsonStruct.ColumnTypes)
+	if err != nil {
+		return err
+	}
+
+	conn, loaderclient, err := s.dialLoaderClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	interval := src.IntervalSeconds
+	if interval <= 0 {
+		interval = DEFAULT_HTTP_POLL_INTERVAL
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	client := &http.Client{Timeout: time.Minute}
+
+	for {
+		mark, err := watch.GetSourceWatermark(src.Name, adminDB)
+		if err != nil {
+			return fmt.Errorf("could not read watermark of %s %v", src.Name, err)
+		}
+
+		records, watermark, pollErr := pollHTTP(ctx, client, src, rules, mark.Watermark)
+		if pollErr != nil {
+			// the pages after the error were not read, the whole poll
+			// is repeated from the same watermark so the records read
+			// so far are not loaded now and again on the next poll
+			s.logger.Errorf("error polling %s %s\n", src.Name, pollErr.Error())
+			records = nil
+		}
+
+		var pushErr error
+		for i := 0; i < len(records) && pushErr == nil; i += RecordsPerPush {
+			end := i + RecordsPerPush
+			if end > len(records) {
+				end = len(records)
+			}
+			jsonStruct.Records = make([]churrodata.JsonPathRow, 0, end-i)
+			for _, r := range records[i:end] {
+				jsonStruct.Records = append(jsonStruct.Records, churrodata.JsonPathRow{Cols: r})
+			}
+			someBytes, _ := json.Marshal(jsonStruct)
+			pushErr = s.pushConfirmed(ctx, loaderclient, loader.LoaderMessage{Metadata: someBytes, DataFormat: config.JSONPathScheme})
+		}
+		if pushErr != nil {
+			// the watermark is kept so the next poll reads the records again
+			s.logger.Errorf("error loading %s %s\n", src.Name, pushErr.Error())
+			pollErr = pushErr
+		} else if pollErr == nil && watermark != mark.Watermark {
+			mark.Watermark = watermark
+			err = mark.Upsert(adminDB)
+			if err != nil {
+				return fmt.Errorf("could not save watermark of %s %v", src.Name, err)
+			}
+		}
+
+		// a scheduled source is polled once per run of its schedule
+		if src.Schedule != "" {
+			return pollErr
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// getHTTPSource finds the pipeline http source being extracted
+func (s *Server) getHTTPSource() (v1alpha1.HTTPSource, error) {
+	for _, src := range s.Pi.Spec.HTTPSources {
+		if src.Name == s.WatchDirName {
+			return src, nil
+		}
+	}
+	return v1alpha1.HTTPSource{}, fmt.Errorf("http source %s is not defined in pipeline %s", s.WatchDirName, s.Pi.Name)
+}
+
+// pollHTTP reads every page of the source newer than watermark
+// and returns the records along with the new watermark, the
+// records read before an error are still returned
+func pollHTTP(ctx context.Context, client *http.Client, src v1alpha1.HTTPSource, rules socketRules, watermark string) (records [][]string, newMark string, err error) {
+	newMark = watermark
+
+	markCol := -1
+	for i, r := range src.ExtractRules {
+		if src.WatermarkColumn != "" && r.ColumnName == src.WatermarkColumn {
+			markCol = i
+		}
+	}
+	if src.WatermarkColumn != "" && markCol < 0 {
+		return records, newMark, fmt.Errorf("watermark column %s has no extract rule", src.WatermarkColumn)
+	}
+
+	switch src.Pagination.Type {
+	case PaginationCursor, PaginationPage:
+		if src.Pagination.Param == "" {
+			return records, newMark, fmt.Errorf("%s pagination needs a param", src.Pagination.Type)
+		}
+	case PaginationLink, "":
+	default:
+		return records, newMark, fmt.Errorf("%s pagination is not recognized", src.Pagination.Type)
+	}
+
+	var cursorPath jp.Expr
+	if src.Pagination.Type == PaginationCursor {
+		cursorPath, err = jp.ParseString(src.Pagination.CursorPath)
+		if err != nil {
+			return records, newMark, fmt.Errorf("invalid cursor path %s %v", src.Pagination.CursorPath, err)
+		}
+	}
+
+	maxPages := src.Pagination.MaxPages
+	if maxPages <= 0 {
+		maxPages = DEFAULT_HTTP_MAX_PAGES
+	}
+
+	pageURL, err := url.Parse(src.URL)
+	if err != nil {
+		return records, newMark, err
+	}
+	q := pageURL.Query()
+	if src.WatermarkParam != "" && watermark != "" {
+		q.Set(src.WatermarkParam, watermark)
+	}
+	page := 1
+	if src.Pagination.Type == PaginationPage {
+		q.Set(src.Pagination.Param, strconv.Itoa(page))
+	}
+	pageURL.RawQuery = q.Encode()
+
+	for n := 0; n < maxPages; n++ {
+		body, header, err := fetchPage(ctx, client, src, pageURL.String())
+		if err != nil {
+			return records, newMark, err
+		}
+
+		pageRecords, err := rules.records(body)
+		if err != nil {
+			return records, newMark, err
+		}
+		for _, r := range pageRecords {
+			if markCol >= 0 && watermarkGreater(r[markCol], newMark) {
+				newMark = r[markCol]
+			}
+		}
+		records = append(records, pageRecords...)
+
+		switch src.Pagination.Type {
+		case PaginationCursor:
+			obj, err := oj.Parse(body)
+			if err != nil {
+				return records, newMark, err
+			}
+			found := cursorPath.Get(obj)
+			if len(found) == 0 || found[0] == nil || fmt.Sprint(found[0]) == "" {
+				return records, newMark, nil
+			}
+			q := pageURL.Query()
+			q.Set(src.Pagination.Param, fmt.Sprint(found[0]))
+			pageURL.RawQuery = q.Encode()
+		case PaginationPage:
+			if len(pageRecords) == 0 {
+				return records, newMark, nil
+			}
+			page++
+			q := pageURL.Query()
+			q.Set(src.Pagination.Param, strconv.Itoa(page))
+			pageURL.RawQuery = q.Encode()
+		case PaginationLink:
+			m := linkNextRegex.FindStringSubmatch(header.Get("Link"))
+			if m == nil {
+				return records, newMark, nil
+			}
+			next, err := pageURL.Parse(m[1])
+			if err != nil {
+				return records, newMark, err
+			}
+			pageURL = next
+		default:
+			return records, newMark, nil
+		}
+	}
+
+	return records, newMark, nil
+}
+
+func fetchPage(ctx context.Context, client *http.Client, src v1alpha1.HTTPSource, pageURL string) ([]byte, http.Header, error) {
+	method := src.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequest(method, pageURL, strings.NewReader(src.Body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range src.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, nil, fmt.Errorf("%s returned %s", pageURL, resp.Status)
+	}
+	return body, resp.Header, nil
+}
+
+// watermarkGreater compares watermarks as numbers when both are
+// numeric and otherwise as strings, which orders RFC 3339 times
+func watermarkGreater(a, b string) bool {
+	if a == "" {
+		return false
+	}
+	if b == "" {
+		return true
+	}
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		return x > y
+	}
+	return a > b
+}
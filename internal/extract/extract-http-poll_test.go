@@ -0,0 +1,138 @@
+package extract
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+)
+
+// items serves three records, two per page, records with an id
+// not greater than since are left out
+func items(since string) []int {
+	from, _ := strconv.Atoi(since)
+	ids := make([]int, 0)
+	for id := from + 1; id <= 3; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func page(ids []int, start int) (string, int) {
+	end := start + 2
+	if end > len(ids) {
+		end = len(ids)
+	}
+	body := `{"items":[`
+	for i := start; i < end; i++ {
+		if i > start {
+			body += ","
+		}
+		body += fmt.Sprintf(`{"id":%d,"name":"item%d"}`, ids[i], ids[i])
+	}
+	return body + "]", end
+}
+
+func TestPollHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		ids := items(r.URL.Query().Get("since"))
+		switch r.URL.Path {
+		case "/cursor":
+			start, _ := strconv.Atoi(r.URL.Query().Get("after"))
+			body, end := page(ids, start)
+			next := ""
+			if end < len(ids) {
+				next = strconv.Itoa(end)
+			}
+			fmt.Fprintf(w, `%s,"next":"%s"}`, body, next)
+		case "/page":
+			p, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			start := (p - 1) * 2
+			if start >= len(ids) {
+				fmt.Fprint(w, `{"items":[]}`)
+				return
+			}
+			body, _ := page(ids, start)
+			fmt.Fprint(w, body+"}")
+		case "/link":
+			start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+			body, end := page(ids, start)
+			if end < len(ids) {
+				w.Header().Set("Link", fmt.Sprintf(`</link?since=%s&start=%d>; rel="next"`, r.URL.Query().Get("since"), end))
+			}
+			fmt.Fprint(w, body+"}")
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		pagination v1alpha1.HTTPPagination
+	}{
+		{"cursor", "/cursor", v1alpha1.HTTPPagination{Type: PaginationCursor, Param: "after", CursorPath: "$.next"}},
+		{"page", "/page", v1alpha1.HTTPPagination{Type: PaginationPage, Param: "page"}},
+		{"link", "/link", v1alpha1.HTTPPagination{Type: PaginationLink}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := v1alpha1.HTTPSource{
+				Name:            tt.name,
+				URL:             srv.URL + tt.path,
+				Headers:         map[string]string{"Authorization": "Bearer token"},
+				Pagination:      tt.pagination,
+				RecordPath:      "$.items[*]",
+				WatermarkColumn: "id",
+				WatermarkParam:  "since",
+				ExtractRules: []v1alpha1.SocketRule{
+					{ColumnName: "id", RuleSource: "$.id"},
+					{ColumnName: "name", RuleSource: "$.name"},
+				},
+			}
+			rules, err := compileSocketRules(src.RecordPath, src.ExtractRules)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			records, mark, err := pollHTTP(context.Background(), srv.Client(), src, rules, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 3 || mark != "3" {
+				t.Fatalf("expected 3 records and watermark 3, got %v %s", records, mark)
+			}
+			if records[2][1] != "item3" {
+				t.Fatalf("unexpected record %v", records[2])
+			}
+
+			records, mark, err = pollHTTP(context.Background(), srv.Client(), src, rules, "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 2 || records[0][0] != "2" || mark != "3" {
+				t.Fatalf("expected records after the watermark, got %v %s", records, mark)
+			}
+		})
+	}
+}
+
+func TestWatermarkGreater(t *testing.T) {
+	if !watermarkGreater("10", "9") {
+		t.Fatal("expected numeric comparison")
+	}
+	if !watermarkGreater("2020-11-02T00:00:00Z", "2020-11-01T23:00:00Z") {
+		t.Fatal("expected time comparison")
+	}
+	if watermarkGreater("", "1") {
+		t.Fatal("an empty value is never greater")
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"go.uber.org/zap"
 	"io/ioutil"
 	"os"
-	"time"
 
 	"gitlab.com/churro-group/churro/internal/churrodata"
 	"gitlab.com/churro-group/churro/internal/config"
@@ -33,7 +32,7 @@ func (s *Server) ExtractJSON(ctx context.Context) (err error) {
 	dp := dataprov.DataProvenance{}
 	dp.Name = s.FileName
 	dp.Path = s.FileName
-	err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+	err = s.registerFile(&dp)
 	if err != nil {
 		return fmt.Errorf("can not register data prov %v %v", dp, err)
 	}
@@ -50,10 +49,6 @@ func (s *Server) ExtractJSON(ctx context.Context) (err error) {
 		return fmt.Errorf("can not unmarshal json input file %v", err)
 	}
 
-	go s.pushToLoader(ctx, config.JSONScheme)
-
-	time.Sleep(time.Second * time.Duration(sleepTime))
-
 	jsonStruct := churrodata.IntermediateFormat{}
 	jsonStruct.Path = dp.Path
 	jsonStruct.Dataprov = dp.Id
@@ -64,20 +59,12 @@ func (s *Server) ExtractJSON(ctx context.Context) (err error) {
 
 	someBytes, _ := json.Marshal(jsonStruct)
 
-	s.Queue <- loader.LoaderMessage{Metadata: someBytes, DataFormat: config.JSONScheme}
-
-	for {
-
-		// back-pressure check
-		if backPressure == 1 {
-			s.logger.Debug("sleeping due to backpressure...")
-			time.Sleep(time.Second * time.Duration(sleepTime))
-			continue
-		} else {
-			break
-		}
-
+	conn, loaderclient, err := s.dialLoaderClient()
+	if err != nil {
+		return err
 	}
+	defer conn.Close()
 
-	return err
+	// the file is only disposed of once the loader wrote it
+	return s.pushConfirmed(ctx, loaderclient, loader.LoaderMessage{Metadata: someBytes, DataFormat: config.JSONScheme})
 }
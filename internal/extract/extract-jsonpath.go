@@ -6,8 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"os"
-	"time"
 
 	"go.uber.org/zap"
 
@@ -42,16 +40,12 @@ func (s *Server) ExtractJSONPath(ctx context.Context) (err error) {
 	dp := dataprov.DataProvenance{}
 	dp.Name = s.FileName
 	dp.Path = s.FileName
-	err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+	err = s.registerFile(&dp)
 	if err != nil {
 		return fmt.Errorf("can not register data prov %v %v", dp, err)
 	}
 	s.logger.Debug("dp info", zap.String("dp", fmt.Sprintf("%v", dp)))
 
-	go s.pushToLoader(ctx, config.JSONPathScheme)
-
-	time.Sleep(time.Second * time.Duration(sleepTime))
-
 	jsonStruct := churrodata.JsonPathFormat{}
 	jsonStruct.Path = dp.Path
 	jsonStruct.Dataprov = dp.Id
@@ -63,9 +57,9 @@ func (s *Server) ExtractJSONPath(ctx context.Context) (err error) {
 	// into a single record with multiple columns
 	jsonStruct.Records = make([]churrodata.JsonPathRow, 1)
 
-	watchDirName := os.Getenv("CHURRO_WATCHDIR_NAME")
+	watchDirName := s.WatchDirName
 	if watchDirName == "" {
-		return fmt.Errorf("CHURRO_WATCHDIR_NAME is not set")
+		return fmt.Errorf("watch directory name is not set")
 	}
 
 	// get the watch directories
@@ -74,7 +68,7 @@ func (s *Server) ExtractJSONPath(ctx context.Context) (err error) {
 	db, err := sql.Open("postgres", pgConnectString)
 	if err != nil {
 		s.logger.Error("could not open the database: ", zap.Error(err))
-		os.Exit(1)
+		return err
 	}
 
 	var wdirs []watch.WatchDirectory
@@ -92,16 +86,22 @@ func (s *Server) ExtractJSONPath(ctx context.Context) (err error) {
 	allCols := make([][]string, 0)
 
 	jsonStruct.Tablename = s.TableName
+	jsonStruct.Load = s.watchDirLoad()
 	err = s.tableCheck(jsonStruct.ColumnNames, jsonStruct.ColumnTypes)
 	if err != nil {
 		return err
 	}
 
+	filter, err := newRowFilter(jsonStruct.ColumnNames, rules)
+	if err != nil {
+		return err
+	}
+
 	var rows int
 	for r := 0; r < len(rules); r++ {
 		cols, err := getColumns(obj, rules[r].RuleSource)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		allCols = append(allCols, cols)
 		rows = len(cols)
@@ -113,18 +113,23 @@ func (s *Server) ExtractJSONPath(ctx context.Context) (err error) {
 		for cell := 0; cell < len(allCols); cell++ {
 			r.Cols = append(r.Cols, allCols[cell][row])
 		}
+		if !filter.keep(r.Cols) {
+			jsonStruct.Skipped++
+			continue
+		}
 		jsonStruct.Records = append(jsonStruct.Records, r)
 	}
 
 	someBytes, _ := json.Marshal(jsonStruct)
 
-	fmt.Println("jeff pushing a message to the queue")
-	s.Queue <- loader.LoaderMessage{Metadata: someBytes, DataFormat: config.JSONPathScheme}
-
-	s.logger.Info("end of jsonpath file reached, cancelling pushes...")
-	time.Sleep(time.Second * 10)
+	conn, loaderclient, err := s.dialLoaderClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
 
-	return err
+	// the file is only disposed of once the loader wrote it
+	return s.pushConfirmed(ctx, loaderclient, loader.LoaderMessage{Metadata: someBytes, DataFormat: config.JSONPathScheme})
 }
 
 func getRules(watchDirName string, p []watch.WatchDirectory) ([]string, []string, []watch.ExtractRule) {
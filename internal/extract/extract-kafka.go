@@ -0,0 +1,338 @@
+package extract
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/credentials"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/churrodata"
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
+	"gitlab.com/churro-group/churro/internal/loader"
+	"gitlab.com/churro-group/churro/internal/transform"
+	pb "gitlab.com/churro-group/churro/rpc/loader"
+)
+
+const (
+	KafkaFormatJSON = "json"
+	KafkaFormatAvro = "avro"
+
+	// kafkaBatchSize is the number of messages loaded and committed
+	// together
+	kafkaBatchSize = 500
+
+	// schemaRegistryMagic starts a payload in the schema registry
+	// wire format, it is followed by a 4 byte schema id
+	schemaRegistryMagic = 0
+)
+
+var (
+	// kafkaBatchWait bounds how long a batch waits to fill
+	kafkaBatchWait = 5 * time.Second
+
+	// kafkaRetryWait is the pause before a batch the loader did not
+	// accept is sent again
+	kafkaRetryWait = 5 * time.Second
+)
+
+var kafkaLagMetric = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "churro_kafka_consumer_lag",
+	Help: "Messages of a partition after the last offset committed by churro",
+}, []string{"pipeline", "source", "topic", "partition"})
+
+// kafkaReader is the part of a kafka.Reader used to consume a topic
+type kafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// kafkaDecoder turns a message value into JSON
+type kafkaDecoder func(value []byte) ([]byte, error)
+
+// Extract the messages of a kafka topic until ctx is cancelled, the
+// consumer group offsets are committed once the loader wrote the
+// records of a batch so a restart replays anything not loaded
+func (s *Server) ExtractKafka(ctx context.Context) (err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	src, err := s.getKafkaSource()
+	if err != nil {
+		return err
+	}
+	if len(src.ExtractRules) == 0 {
+		return fmt.Errorf("kafka source %s has no extract rules", src.Name)
+	}
+	rules, err := compileSocketRules(src.RecordPath, src.ExtractRules)
+	if err != nil {
+		return err
+	}
+	decode, err := newKafkaDecoder(src, &http.Client{Timeout: time.Minute})
+	if err != nil {
+		return err
+	}
+
+	dp := dataprov.DataProvenance{}
+	dp.Name = src.Name
+	dp.Path = "kafka://" + src.Topic
+	err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+	if err != nil {
+		return fmt.Errorf("can not register data prov %v %v", dp, err)
+	}
+	s.logger.Info("dp info ", zap.String("dp", fmt.Sprintf("%+v", dp)))
+
+	jsonStruct := churrodata.JsonPathFormat{}
+	jsonStruct.Path = dp.Path
+	jsonStruct.Dataprov = dp.Id
+	jsonStruct.Tablename = s.TableName
+	jsonStruct.PipelineName = s.Pi.Name
+	jsonStruct.ColumnNames = make([]string, 0)
+	jsonStruct.ColumnTypes = make([]string, 0)
+	for _, r := range src.ExtractRules {
+		jsonStruct.ColumnNames = append(jsonStruct.ColumnNames, r.ColumnName)
+		jsonStruct.ColumnTypes = append(jsonStruct.ColumnTypes, "TEXT")
+	}
+
+	err = s.tableCheck(jsonStruct.ColumnNames, jsonStruct.ColumnTypes)
+	if err != nil {
+		return err
+	}
+
+	creds, err := credentials.NewClientTLSFromFile(s.ServiceCreds.ServiceCrt, "")
+	if err != nil {
+		return fmt.Errorf("could not process the credentials %v", err)
+	}
+	conn, err := s.dialLoader(creds)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	loaderclient := pb.NewLoaderClient(conn)
+
+	groupID := src.GroupID
+	if groupID == "" {
+		groupID = "churro-" + s.Pi.Name + "-" + src.Name
+	}
+	// a zero CommitInterval commits synchronously in CommitMessages
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     src.Brokers,
+		GroupID:     groupID,
+		Topic:       src.Topic,
+		StartOffset: kafka.FirstOffset,
+	})
+	defer reader.Close()
+
+	// the lag is scraped from the extractor, when it runs within
+	// churro-watch the port is already served
+	go func() {
+		err := http.ListenAndServe(DEFAULT_METRICS_PORT, promhttp.Handler())
+		if err != nil {
+			s.logger.Infof("kafka metrics not served by the extractor %s\n", err.Error())
+		}
+	}()
+
+	load := func(records [][]string) error {
+		for _, record := range records {
+			err := transform.RunRules(config.KafkaScheme, jsonStruct.ColumnNames, record, s.TransformRules, s.TransformFunctions, s.logger)
+			if err != nil {
+				s.logger.Error("error in runrules", zap.Error(err))
+			}
+		}
+		jsonStruct.Records = make([]churrodata.JsonPathRow, 0, len(records))
+		for _, r := range records {
+			jsonStruct.Records = append(jsonStruct.Records, churrodata.JsonPathRow{Cols: r})
+		}
+		someBytes, _ := json.Marshal(jsonStruct)
+		return s.pushConfirmed(ctx, loaderclient, loader.LoaderMessage{Metadata: someBytes, DataFormat: config.JSONPathScheme})
+	}
+	lag := func(m kafka.Message) {
+		kafkaLagMetric.WithLabelValues(s.Pi.Name, src.Name, m.Topic, strconv.Itoa(m.Partition)).Set(float64(m.HighWaterMark - m.Offset - 1))
+	}
+
+	return consumeKafka(ctx, reader, rules, decode, load, lag, s.logger)
+}
+
+// getKafkaSource finds the pipeline kafka source being extracted
+func (s *Server) getKafkaSource() (v1alpha1.KafkaSource, error) {
+	for _, src := range s.Pi.Spec.KafkaSources {
+		if src.Name == s.WatchDirName {
+			return src, nil
+		}
+	}
+	return v1alpha1.KafkaSource{}, fmt.Errorf("kafka source %s is not defined in pipeline %s", s.WatchDirName, s.Pi.Name)
+}
+
+// consumeKafka loads the messages of r in batches, a batch is
+// offered to load until it is written and only then committed,
+// lag is given the last message of each partition in the batch
+func consumeKafka(ctx context.Context, r kafkaReader, rules socketRules, decode kafkaDecoder, load func(records [][]string) error, lag func(kafka.Message), l *zap.SugaredLogger) error {
+	for {
+		msgs, err := fetchKafkaBatch(ctx, r, kafkaBatchSize, kafkaBatchWait)
+		if err != nil {
+			return err
+		}
+
+		records := make([][]string, 0, len(msgs))
+		for _, m := range msgs {
+			value, err := decode(m.Value)
+			if err == nil {
+				var recs [][]string
+				recs, err = rules.records(value)
+				records = append(records, recs...)
+			}
+			if err != nil {
+				// an undecodable message is committed with its batch
+				// rather than blocking the partition
+				l.Errorf("skipping message %s/%d/%d %s\n", m.Topic, m.Partition, m.Offset, err.Error())
+			}
+		}
+
+		for len(records) > 0 {
+			err = load(records)
+			if err == nil {
+				break
+			}
+			l.Errorf("error loading kafka batch, retrying %s\n", err.Error())
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(kafkaRetryWait):
+			}
+		}
+
+		err = r.CommitMessages(ctx, msgs...)
+		if err != nil {
+			return fmt.Errorf("could not commit offsets %v", err)
+		}
+
+		last := make(map[int]kafka.Message)
+		for _, m := range msgs {
+			last[m.Partition] = m
+		}
+		for _, m := range last {
+			lag(m)
+		}
+	}
+}
+
+// fetchKafkaBatch waits for a first message and then gathers more
+// until the batch is full or wait has passed
+func fetchKafkaBatch(ctx context.Context, r kafkaReader, size int, wait time.Duration) ([]kafka.Message, error) {
+	m, err := r.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msgs := []kafka.Message{m}
+
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	for len(msgs) < size {
+		m, err := r.FetchMessage(waitCtx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			break
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+// newKafkaDecoder returns the decoder of a source's payload format
+func newKafkaDecoder(src v1alpha1.KafkaSource, client *http.Client) (kafkaDecoder, error) {
+	switch src.Format {
+	case "", KafkaFormatJSON:
+		return func(value []byte) ([]byte, error) {
+			return value, nil
+		}, nil
+	case KafkaFormatAvro:
+	default:
+		return nil, fmt.Errorf("kafka source %s format %s is not json or avro", src.Name, src.Format)
+	}
+
+	if src.AvroSchema == "" && src.SchemaRegistry == "" {
+		return nil, fmt.Errorf("kafka source %s needs an avro schema or a schema registry", src.Name)
+	}
+	var plain *goavro.Codec
+	if src.AvroSchema != "" {
+		var err error
+		plain, err = goavro.NewCodec(src.AvroSchema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid avro schema of kafka source %s %v", src.Name, err)
+		}
+	}
+	registry := &schemaRegistry{url: src.SchemaRegistry, client: client, codecs: make(map[uint32]*goavro.Codec)}
+
+	return func(value []byte) ([]byte, error) {
+		codec := plain
+		if src.SchemaRegistry != "" && len(value) > 5 && value[0] == schemaRegistryMagic {
+			var err error
+			codec, err = registry.codec(binary.BigEndian.Uint32(value[1:5]))
+			if err != nil {
+				return nil, err
+			}
+			value = value[5:]
+		}
+		if codec == nil {
+			return nil, fmt.Errorf("payload is not in the schema registry format")
+		}
+
+		native, _, err := codec.NativeFromBinary(value)
+		if err != nil {
+			return nil, err
+		}
+		return codec.TextualFromNative(nil, native)
+	}, nil
+}
+
+// schemaRegistry fetches and caches the avro schemas of a schema
+// registry by id, it is only used by a single consumer
+type schemaRegistry struct {
+	url    string
+	client *http.Client
+	codecs map[uint32]*goavro.Codec
+}
+
+func (r *schemaRegistry) codec(id uint32) (*goavro.Codec, error) {
+	if codec, ok := r.codecs[id]; ok {
+		return codec, nil
+	}
+
+	resp, err := r.client.Get(fmt.Sprintf("%s/schemas/ids/%d", r.url, id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("schema %d returned %s", id, resp.Status)
+	}
+
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %d response %v", id, err)
+	}
+	codec, err := goavro.NewCodec(body.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %d %v", id, err)
+	}
+	r.codecs[id] = codec
+	return codec, nil
+}
@@ -0,0 +1,169 @@
+package extract
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+)
+
+// fakeKafkaReader hands out its messages and then blocks until ctx
+// is done, like a reader at the end of a topic
+type fakeKafkaReader struct {
+	msgs      []kafka.Message
+	committed []kafka.Message
+	// loaded counts the loads when commit is called
+	loaded  *int
+	commits []int
+}
+
+func (r *fakeKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(r.msgs) == 0 {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	m := r.msgs[0]
+	r.msgs = r.msgs[1:]
+	return m, nil
+}
+
+func (r *fakeKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.committed = append(r.committed, msgs...)
+	r.commits = append(r.commits, *r.loaded)
+	return nil
+}
+
+func TestConsumeKafka(t *testing.T) {
+	kafkaBatchWait, kafkaRetryWait = 100*time.Millisecond, 10*time.Millisecond
+	loaded := 0
+	r := &fakeKafkaReader{loaded: &loaded, msgs: []kafka.Message{
+		{Topic: "orders", Partition: 0, Offset: 10, HighWaterMark: 15, Value: []byte(`{"id":"a"}`)},
+		{Topic: "orders", Partition: 1, Offset: 3, HighWaterMark: 4, Value: []byte(`not json`)},
+		{Topic: "orders", Partition: 0, Offset: 11, HighWaterMark: 15, Value: []byte(`{"id":"b"}`)},
+	}}
+	rules, err := compileSocketRules("", []v1alpha1.SocketRule{{ColumnName: "id", RuleSource: "$.id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode, _ := newKafkaDecoder(v1alpha1.KafkaSource{}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	load := func(records [][]string) error {
+		attempts++
+		if len(r.committed) > 0 {
+			t.Error("offsets committed before the batch was loaded")
+		}
+		if len(records) != 2 || records[0][0] != "a" || records[1][0] != "b" {
+			t.Errorf("unexpected records %v", records)
+		}
+		// the loader refuses the batch once
+		if attempts == 1 {
+			return fmt.Errorf("loader unavailable")
+		}
+		loaded++
+		return nil
+	}
+	lags := make(map[int]int64)
+	lag := func(m kafka.Message) {
+		lags[m.Partition] = m.HighWaterMark - m.Offset - 1
+		cancel()
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- consumeKafka(ctx, r, rules, decode, load, lag, zap.NewNop().Sugar())
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatal("consumer did not stop")
+	}
+	if err != context.Canceled {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if attempts != 2 || len(r.committed) != 3 || len(r.commits) != 1 || r.commits[0] != 1 {
+		t.Errorf("attempts %d committed %d commits %v", attempts, len(r.committed), r.commits)
+	}
+	if lags[0] != 3 || lags[1] != 0 {
+		t.Errorf("unexpected lag %v", lags)
+	}
+}
+
+func TestKafkaAvroDecoder(t *testing.T) {
+	schema := `{"type":"record","name":"order","fields":[{"name":"id","type":"string"},{"name":"qty","type":"int"}]}`
+	codec, err := goavro.NewCodec(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := codec.BinaryFromNative(nil, map[string]interface{}{"id": "a", "qty": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := 0
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/schemas/ids/7" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"schema": schema})
+	}))
+	defer registry.Close()
+
+	framed := append([]byte{schemaRegistryMagic, 0, 0, 0, 0}, payload...)
+	binary.BigEndian.PutUint32(framed[1:5], 7)
+
+	rules, _ := compileSocketRules("", []v1alpha1.SocketRule{{ColumnName: "id", RuleSource: "$.id"}, {ColumnName: "qty", RuleSource: "$.qty"}})
+	tests := []struct {
+		name  string
+		src   v1alpha1.KafkaSource
+		value []byte
+	}{
+		{"Schema", v1alpha1.KafkaSource{Format: KafkaFormatAvro, AvroSchema: schema}, payload},
+		{"Registry", v1alpha1.KafkaSource{Format: KafkaFormatAvro, SchemaRegistry: registry.URL}, framed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decode, err := newKafkaDecoder(tt.src, registry.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				value, err := decode(tt.value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				records, err := rules.records(value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(records) != 1 || records[0][0] != "a" || records[0][1] != "2" {
+					t.Errorf("unexpected records %v", records)
+				}
+			}
+		})
+	}
+	if requests != 1 {
+		t.Errorf("schema fetched %d times", requests)
+	}
+
+	if _, err := newKafkaDecoder(v1alpha1.KafkaSource{Format: KafkaFormatAvro}, nil); err == nil {
+		t.Error("expected avro without a schema to fail")
+	}
+	if _, err := newKafkaDecoder(v1alpha1.KafkaSource{Format: "protobuf"}, nil); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+}
@@ -0,0 +1,261 @@
+package extract
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/churrodata"
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
+	"gitlab.com/churro-group/churro/internal/loader"
+	"gitlab.com/churro-group/churro/internal/transform"
+	"gitlab.com/churro-group/churro/internal/watch"
+)
+
+const (
+	// mqttFlushInterval bounds how long received records wait for a
+	// full push to the loader
+	mqttFlushInterval = 5 * time.Second
+
+	// mqttQueueDepth bounds the messages received but not yet
+	// pushed, once it is full the broker connection stalls until
+	// the loader catches up
+	mqttQueueDepth = 1000
+
+	mqttConnectTimeout = 30 * time.Second
+	mqttDisconnectWait = 250
+)
+
+// Extract the messages published to the topics of an mqtt source
+// until ctx is cancelled, each JSON payload is mapped to columns
+// using the source's JSONPath extract rules
+func (s *Server) ExtractMQTT(ctx context.Context) (err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	src, err := s.getMQTTSource()
+	if err != nil {
+		return err
+	}
+	if len(src.ExtractRules) == 0 {
+		return fmt.Errorf("mqtt source %s has no extract rules", src.Name)
+	}
+	rules, err := compileSocketRules(src.RecordPath, src.ExtractRules)
+	if err != nil {
+		return err
+	}
+	opts, err := mqttClientOptions(src, s.Pi.Name, watch.GetSecretValue)
+	if err != nil {
+		return err
+	}
+
+	dp := dataprov.DataProvenance{}
+	dp.Name = src.Name
+	dp.Path = src.Broker
+	err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+	if err != nil {
+		return fmt.Errorf("can not register data prov %v %v", dp, err)
+	}
+	s.logger.Info("dp info ", zap.String("dp", fmt.Sprintf("%+v", dp)))
+
+	jsonStruct := churrodata.JsonPathFormat{}
+	jsonStruct.Path = src.Broker
+	jsonStruct.Dataprov = dp.Id
+	jsonStruct.Tablename = s.TableName
+	jsonStruct.PipelineName = s.Pi.Name
+	jsonStruct.ColumnNames = make([]string, 0)
+	jsonStruct.ColumnTypes = make([]string, 0)
+	for _, r := range src.ExtractRules {
+		jsonStruct.ColumnNames = append(jsonStruct.ColumnNames, r.ColumnName)
+		jsonStruct.ColumnTypes = append(jsonStruct.ColumnTypes, "TEXT")
+	}
+
+	err = s.tableCheck(jsonStruct.ColumnNames, jsonStruct.ColumnTypes)
+	if err != nil {
+		return err
+	}
+
+	// records pushed as the subscription ends still reach the loader
+	stop := s.startPushing(config.JSONPathScheme)
+	defer stop()
+
+	msgs := make(chan []byte, mqttQueueDepth)
+	client, err := subscribeMQTT(ctx, opts, src, msgs, s.logger)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(mqttDisconnectWait)
+
+	jsonStruct.Records = make([]churrodata.JsonPathRow, 0, RecordsPerPush)
+	push := func() {
+		if len(jsonStruct.Records) == 0 {
+			return
+		}
+		// back-pressure check
+		if atomic.LoadInt32(&backPressure) == 1 {
+			s.logger.Info("sleeping due to backpressure...")
+			time.Sleep(time.Second * time.Duration(sleepTime))
+		}
+		someBytes, _ := json.Marshal(jsonStruct)
+		s.Queue <- loader.LoaderMessage{Metadata: someBytes, DataFormat: config.JSONPathScheme}
+		jsonStruct.Records = make([]churrodata.JsonPathRow, 0, RecordsPerPush)
+	}
+
+	flush := time.NewTicker(mqttFlushInterval)
+	defer flush.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			push()
+			return ctx.Err()
+		case <-flush.C:
+			push()
+		case msg := <-msgs:
+			records, err := rules.records(msg)
+			if err != nil {
+				// a payload that is not JSON does not end the
+				// subscription
+				s.logger.Debugf("skipping mqtt payload of %s %s\n", src.Name, err.Error())
+				continue
+			}
+			for _, record := range records {
+				err := transform.RunRules(config.MQTTScheme, jsonStruct.ColumnNames, record, s.TransformRules, s.TransformFunctions, s.logger)
+				if err != nil {
+					s.logger.Error("error in runrules", zap.Error(err))
+				}
+				jsonStruct.Records = append(jsonStruct.Records, churrodata.JsonPathRow{Cols: record})
+				if len(jsonStruct.Records) >= RecordsPerPush {
+					push()
+				}
+			}
+		}
+	}
+}
+
+// getMQTTSource finds the pipeline mqtt source being extracted
+func (s *Server) getMQTTSource() (v1alpha1.MQTTSource, error) {
+	for _, src := range s.Pi.Spec.MQTTSources {
+		if src.Name == s.WatchDirName {
+			return src, nil
+		}
+	}
+	return v1alpha1.MQTTSource{}, fmt.Errorf("mqtt source %s is not defined in pipeline %s", s.WatchDirName, s.Pi.Name)
+}
+
+// mqttClientOptions builds the broker connection of a source, the
+// credentials and certificates are read using secret
+func mqttClientOptions(src v1alpha1.MQTTSource, pipelineName string, secret func(name, key string) (string, error)) (*mqtt.ClientOptions, error) {
+	if src.Broker == "" || len(src.Topics) == 0 {
+		return nil, fmt.Errorf("mqtt source %s needs a broker and topics", src.Name)
+	}
+	if src.QoS < 0 || src.QoS > 2 {
+		return nil, fmt.Errorf("mqtt source %s qos %d is not 0, 1 or 2", src.Name, src.QoS)
+	}
+
+	clientID := src.ClientID
+	if clientID == "" {
+		clientID = "churro-" + pipelineName + "-" + src.Name
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(src.Broker)
+	opts.SetClientID(clientID)
+	// the broker keeps a QoS 1 or 2 subscription, and the messages
+	// published to it, while churro is disconnected
+	opts.SetCleanSession(src.QoS == 0)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectTimeout(mqttConnectTimeout)
+
+	if src.CredentialsSecret != "" {
+		username, err := secret(src.CredentialsSecret, "username")
+		if err != nil {
+			return nil, fmt.Errorf("could not read credentials secret of mqtt source %s %v", src.Name, err)
+		}
+		password, err := secret(src.CredentialsSecret, "password")
+		if err != nil {
+			return nil, fmt.Errorf("could not read credentials secret of mqtt source %s %v", src.Name, err)
+		}
+		opts.SetUsername(username)
+		opts.SetPassword(password)
+	}
+
+	if src.TLSSecret != "" || src.InsecureSkipVerify {
+		tlsConfig := &tls.Config{InsecureSkipVerify: src.InsecureSkipVerify}
+		if src.TLSSecret != "" {
+			ca, err := secret(src.TLSSecret, "ca.crt")
+			if err != nil {
+				return nil, fmt.Errorf("could not read tls secret of mqtt source %s %v", src.Name, err)
+			}
+			if ca != "" {
+				tlsConfig.RootCAs = x509.NewCertPool()
+				if !tlsConfig.RootCAs.AppendCertsFromPEM([]byte(ca)) {
+					return nil, fmt.Errorf("mqtt source %s ca.crt holds no certificates", src.Name)
+				}
+			}
+			cert, _ := secret(src.TLSSecret, "tls.crt")
+			key, _ := secret(src.TLSSecret, "tls.key")
+			if cert != "" && key != "" {
+				pair, err := tls.X509KeyPair([]byte(cert), []byte(key))
+				if err != nil {
+					return nil, fmt.Errorf("invalid client certificate of mqtt source %s %v", src.Name, err)
+				}
+				tlsConfig.Certificates = []tls.Certificate{pair}
+			}
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	return opts, nil
+}
+
+// subscribeMQTT connects to the broker and subscribes to the source
+// topics, again after each reconnect, payloads are sent on msgs
+func subscribeMQTT(ctx context.Context, opts *mqtt.ClientOptions, src v1alpha1.MQTTSource, msgs chan<- []byte, l *zap.SugaredLogger) (mqtt.Client, error) {
+	filters := make(map[string]byte, len(src.Topics))
+	for _, t := range src.Topics {
+		filters[t] = byte(src.QoS)
+	}
+
+	// the handler blocks while msgs is full so that a slow loader
+	// holds back the broker rather than dropping messages
+	handler := func(c mqtt.Client, m mqtt.Message) {
+		select {
+		case msgs <- m.Payload():
+		case <-ctx.Done():
+		}
+	}
+
+	opts.SetOnConnectHandler(func(c mqtt.Client) {
+		token := c.SubscribeMultiple(filters, handler)
+		token.Wait()
+		if token.Error() != nil {
+			l.Errorf("error subscribing to mqtt source %s %s\n", src.Name, token.Error().Error())
+			return
+		}
+		l.Infof("subscribed to mqtt source %s %v\n", src.Name, src.Topics)
+	})
+	opts.SetConnectionLostHandler(func(c mqtt.Client, err error) {
+		l.Errorf("lost connection to mqtt source %s %s\n", src.Name, err.Error())
+	})
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(mqttConnectTimeout) {
+		client.Disconnect(0)
+		return nil, fmt.Errorf("timed out connecting to mqtt broker %s", src.Broker)
+	}
+	if token.Error() != nil {
+		return nil, token.Error()
+	}
+	return client, nil
+}
@@ -0,0 +1,145 @@
+package extract
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+)
+
+// startBroker accepts one client, acknowledges its subscription and
+// publishes payloads to the first subscribed topic
+func startBroker(t *testing.T, payloads []string, subscribed chan<- *packets.SubscribePacket) net.Listener {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			cp, err := packets.ReadPacket(conn)
+			if err != nil {
+				return
+			}
+			switch p := cp.(type) {
+			case *packets.ConnectPacket:
+				packets.NewControlPacket(packets.Connack).Write(conn)
+			case *packets.SubscribePacket:
+				ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+				ack.MessageID = p.MessageID
+				ack.ReturnCodes = p.Qoss
+				ack.Write(conn)
+				subscribed <- p
+				for i, payload := range payloads {
+					pub := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+					pub.TopicName = "plant/line1/temp"
+					pub.Qos = p.Qoss[0]
+					pub.MessageID = uint16(i + 1)
+					pub.Payload = []byte(payload)
+					pub.Write(conn)
+				}
+			case *packets.PingreqPacket:
+				packets.NewControlPacket(packets.Pingresp).Write(conn)
+			case *packets.DisconnectPacket:
+				return
+			}
+		}
+	}()
+	return lis
+}
+
+func TestSubscribeMQTT(t *testing.T) {
+	subscribed := make(chan *packets.SubscribePacket, 1)
+	lis := startBroker(t, []string{`{"sensor":"s1","value":20.5}`, "not json", `{"sensor":"s2","value":21}`}, subscribed)
+	defer lis.Close()
+
+	src := v1alpha1.MQTTSource{
+		Name:   "plant",
+		Broker: "tcp://" + lis.Addr().String(),
+		Topics: []string{"plant/+/temp"},
+		QoS:    1,
+		ExtractRules: []v1alpha1.SocketRule{
+			{ColumnName: "sensor", RuleSource: "$.sensor"},
+			{ColumnName: "value", RuleSource: "$.value"},
+		},
+	}
+	opts, err := mqttClientOptions(src, "pipeline1", func(name, key string) (string, error) { return "", nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := compileSocketRules(src.RecordPath, src.ExtractRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msgs := make(chan []byte, 10)
+	client, err := subscribeMQTT(ctx, opts, src, msgs, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(0)
+
+	select {
+	case p := <-subscribed:
+		if len(p.Topics) != 1 || p.Topics[0] != "plant/+/temp" || p.Qoss[0] != 1 {
+			t.Errorf("unexpected subscription %v %v", p.Topics, p.Qoss)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no subscription")
+	}
+
+	got := make([]string, 0)
+	for len(got) < 2 {
+		select {
+		case msg := <-msgs:
+			records, err := rules.records(msg)
+			if err != nil {
+				continue
+			}
+			for _, r := range records {
+				got = append(got, r[0]+"="+r[1])
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out with records %v", got)
+		}
+	}
+	if got[0] != "s1=20.5" || got[1] != "s2=21" {
+		t.Errorf("unexpected records %v", got)
+	}
+}
+
+func TestMQTTClientOptions(t *testing.T) {
+	secret := func(name, key string) (string, error) {
+		return name + "-" + key, nil
+	}
+
+	src := v1alpha1.MQTTSource{Name: "plant", Broker: "tcp://broker:1883", Topics: []string{"a/#"}, CredentialsSecret: "mqtt"}
+	opts, err := mqttClientOptions(src, "pipeline1", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ClientID != "churro-pipeline1-plant" || opts.Username != "mqtt-username" || opts.Password != "mqtt-password" || !opts.CleanSession {
+		t.Errorf("unexpected options %+v", opts)
+	}
+
+	src.QoS = 3
+	if _, err := mqttClientOptions(src, "pipeline1", secret); err == nil {
+		t.Error("expected qos 3 to fail")
+	}
+	src.QoS = 1
+	src.Topics = nil
+	if _, err := mqttClientOptions(src, "pipeline1", secret); err == nil {
+		t.Error("expected a source without topics to fail")
+	}
+}
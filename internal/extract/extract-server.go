@@ -5,6 +5,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -16,6 +19,7 @@ import (
 	_ "github.com/lib/pq"
 	"gitlab.com/churro-group/churro/api/v1alpha1"
 	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
 	"gitlab.com/churro-group/churro/internal/loader"
 	"gitlab.com/churro-group/churro/internal/transform"
 	"gitlab.com/churro-group/churro/internal/watch"
@@ -28,34 +32,63 @@ const (
 )
 
 var sleepTime = 3 //seconds to sleep when backpressure
+
+// backPressure is set from the loader responses, it is shared by
+// the pushers and chunk workers so it is only accessed atomically
 var backPressure int32
 
 type Server struct {
-	Pi                 v1alpha1.Pipeline
-	Queue              chan loader.LoaderMessage
-	ServiceCreds       config.ServiceCredentials
-	DBCreds            config.DBCredentials
-	TableName          string
-	SchemeValue        string
-	FileName           string
+	Pi           v1alpha1.Pipeline
+	Queue        chan loader.LoaderMessage
+	ServiceCreds config.ServiceCredentials
+	DBCreds      config.DBCredentials
+	AdminDBCreds config.DBCredentials
+	TableName    string
+	SchemeValue  string
+	FileName     string
+	WatchDirName string
+	// Resume is set when churro-watch relaunched an interrupted
+	// extraction, any matching checkpoint is continued regardless
+	Resume bool
+	// Duplicate is the duplicate policy the watch applied to the
+	// file, it is set when the file content was loaded before
+	Duplicate string
+	// SourcePath and SourceVersion identify the remote object a
+	// downloaded file came from
+	SourcePath         string
+	SourceVersion      string
 	TransformFunctions []transform.TransformFunction
 	TransformRules     []transform.TransformRule
 	WatchDirectory     []watch.WatchDirectory
 	logger             *zap.SugaredLogger
+	// dataprovId is the provenance of the file being extracted
+	dataprovId string
 }
 
 // NewExtractServer creates an extract server based on the configPath
-// and returns a pointer to the extract server
-func NewExtractServer(fileName, schemeValue, tableName string, debug bool, svcCreds config.ServiceCredentials, dbCreds config.DBCredentials, pipeline v1alpha1.Pipeline, l *zap.SugaredLogger) *Server {
+// and returns a pointer to the extract server, the extraction stops
+// early when ctx is cancelled and resume continues an interrupted
+// extraction of fileName from its checkpoint, duplicate is the
+// duplicate policy applied to fileName if any, sourcePath and
+// sourceVersion identify the remote object fileName was downloaded
+// from.  An error is returned when the extraction failed so the
+// caller can report it.
+func NewExtractServer(ctx context.Context, fileName, schemeValue, tableName, watchDirName, duplicate, sourcePath, sourceVersion string, debug, resume bool, svcCreds config.ServiceCredentials, dbCreds config.DBCredentials, adminDBCreds config.DBCredentials, pipeline v1alpha1.Pipeline, l *zap.SugaredLogger) (*Server, error) {
 	s := &Server{
-		logger:       l,
-		Queue:        make(chan loader.LoaderMessage, 32),
-		ServiceCreds: svcCreds,
-		DBCreds:      dbCreds,
-		Pi:           pipeline,
-		FileName:     fileName,
-		SchemeValue:  schemeValue,
-		TableName:    tableName,
+		logger:        l,
+		Queue:         make(chan loader.LoaderMessage, 32),
+		ServiceCreds:  svcCreds,
+		DBCreds:       dbCreds,
+		AdminDBCreds:  adminDBCreds,
+		Pi:            pipeline,
+		FileName:      fileName,
+		SchemeValue:   schemeValue,
+		TableName:     tableName,
+		WatchDirName:  watchDirName,
+		Resume:        resume,
+		Duplicate:     duplicate,
+		SourcePath:    sourcePath,
+		SourceVersion: sourceVersion,
 	}
 
 	var err error
@@ -65,7 +98,7 @@ func NewExtractServer(fileName, schemeValue, tableName string, debug bool, svcCr
 	db, err := sql.Open("postgres", pgConnectString)
 	if err != nil {
 		s.logger.Error("could not open the database: ", zap.Error(err))
-		os.Exit(1)
+		return s, err
 	}
 
 	//s.TransformFunctions, err = transform.GetTransformFunctions(db, s.Pi.Name)
@@ -74,7 +107,8 @@ func NewExtractServer(fileName, schemeValue, tableName string, debug bool, svcCr
 	s.TransformRules, err = transform.GetTransformRules(db)
 	if err != nil {
 		s.logger.Errorf("could not get transform rules: %s\n", err.Error())
-		os.Exit(1)
+		db.Close()
+		return s, err
 	}
 
 	s.logger.Infof("transform functions %d\n", len(s.TransformFunctions))
@@ -82,7 +116,8 @@ func NewExtractServer(fileName, schemeValue, tableName string, debug bool, svcCr
 	s.WatchDirectory, err = watch.GetWatchDirectories(db)
 	if err != nil {
 		s.logger.Errorf("could not get watch directories: %s\n", err.Error())
-		os.Exit(1)
+		db.Close()
+		return s, err
 	}
 
 	db.Close()
@@ -95,23 +130,21 @@ func NewExtractServer(fileName, schemeValue, tableName string, debug bool, svcCr
 	creds, err := credentials.NewClientTLSFromFile(svcCreds.ServiceCrt, "")
 	if err != nil {
 		s.logger.Errorf("could not process the credentials: %s\n", err.Error())
-		os.Exit(1)
+		return s, err
 	}
 
 	conn, err := grpc.Dial(url, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		s.logger.Errorf("did not connect: %s\n", err.Error())
-		return s
+		return s, err
 	}
 	defer conn.Close()
 	loaderclient := pbloader.NewLoaderClient(conn)
 
-	ctx := context.Background()
-
 	_, err2 := loaderclient.FileProcessed(ctx, &pbloader.FileProcessedRequest{Filename: fileName})
 	if err2 != nil {
 		s.logger.Errorf("error in FileProcessed %s\n", err2.Error())
-		return s
+		return s, err2
 	}
 
 	s.logger.Debug("NewExtractServer called processing started...")
@@ -122,6 +155,48 @@ func NewExtractServer(fileName, schemeValue, tableName string, debug bool, svcCr
 		if err != nil {
 			s.logger.Errorf("error in finnhub processing %s\n", err.Error())
 		}
+	case config.WebSocketScheme:
+		s.logger.Info("extract is processing a websocket")
+		err = s.ExtractWebSocket(ctx)
+		if err != nil {
+			s.logger.Errorf("error in websocket processing %s\n", err.Error())
+		}
+	case config.HTTPPollScheme:
+		s.logger.Info("extract is polling an http source")
+		err = s.ExtractHTTPPoll(ctx)
+		if err != nil {
+			s.logger.Errorf("error in http-poll processing %s\n", err.Error())
+		}
+	case config.SQLScheme:
+		s.logger.Info("extract is reading a sql source")
+		err = s.ExtractSQL(ctx)
+		if err != nil {
+			s.logger.Errorf("error in sql processing %s\n", err.Error())
+		}
+	case config.CDCScheme:
+		s.logger.Info("extract is reading a cdc source")
+		err = s.ExtractCDC(ctx)
+		if err != nil {
+			s.logger.Errorf("error in cdc processing %s\n", err.Error())
+		}
+	case config.TailScheme:
+		s.logger.Info("extract is following a tail directory")
+		err = s.ExtractTail(ctx)
+		if err != nil {
+			s.logger.Errorf("error in tail processing %s\n", err.Error())
+		}
+	case config.MQTTScheme:
+		s.logger.Info("extract is subscribing to an mqtt source")
+		err = s.ExtractMQTT(ctx)
+		if err != nil {
+			s.logger.Errorf("error in mqtt processing %s\n", err.Error())
+		}
+	case config.KafkaScheme:
+		s.logger.Info("extract is consuming a kafka source")
+		err = s.ExtractKafka(ctx)
+		if err != nil {
+			s.logger.Errorf("error in kafka processing %s\n", err.Error())
+		}
 	case config.XMLScheme:
 		s.logger.Info("Info: extract is processing a xml file")
 		err = s.ExtractXML(ctx)
@@ -154,19 +229,22 @@ func NewExtractServer(fileName, schemeValue, tableName string, debug bool, svcCr
 		}
 	default:
 		s.logger.Errorf("invalid datasource scheme value %s\n", schemeValue)
-		os.Exit(1)
+		return s, fmt.Errorf("invalid datasource scheme value %s", schemeValue)
 	}
 
+	// sockets, polled sources and followed files are not disposed
+	// of, a failed file is left for a retry and churro-watch
+	// quarantines it once the last attempt failed
 	switch schemeValue {
-	case config.XLSXScheme:
-	case config.CSVScheme:
-	case config.JSONPathScheme:
-	case config.JSONScheme:
-	case config.XMLScheme:
-		s.renameFile(fileName)
+	case config.FinnHubScheme, config.WebSocketScheme, config.HTTPPollScheme, config.SQLScheme, config.CDCScheme, config.TailScheme, config.MQTTScheme, config.KafkaScheme:
+	default:
+		if err == nil {
+			s.fileLoaded()
+			s.disposeFile(fileName)
+		}
 	}
 
-	return s
+	return s, err
 }
 
 // Ping implements the Ping interface and simply responds by returning
@@ -177,11 +255,73 @@ func (s *Server) Ping(ctx context.Context, size *pb.PingRequest) (hat *pb.PingRe
 	}, nil
 }
 
-func (s *Server) renameFile(path string) {
-	newPath := path + ".churro-processed"
-	err := os.Rename(path, newPath)
+// fileLoaded marks the dataprov of the extracted file loaded, along
+// with the version of the remote object it was downloaded from
+func (s *Server) fileLoaded() {
+	if s.dataprovId == "" {
+		return
+	}
+	err := dataprov.SetLoaded(s.dataprovId, s.SourceVersion, s.Pi, s.DBCreds)
+	if err != nil {
+		s.logger.Errorf("error marking dataprov %s loaded %s\n", s.dataprovId, err.Error())
+	}
+}
+
+// disposeFile applies the watch directory disposition policy to
+// the processed file, an object store download is churro's own
+// copy so it is removed
+func (s *Server) disposeFile(path string) {
+	if strings.HasPrefix(s.SourcePath, watch.ObjectPathPrefix) {
+		err := os.Remove(path)
+		if err != nil {
+			s.logger.Errorf("error removing download %s %s\n", path, err.Error())
+		}
+		return
+	}
+
+	dir := watch.WatchDirectory{Path: filepath.Dir(path)}
+	for _, d := range s.WatchDirectory {
+		if d.Name == s.WatchDirName {
+			dir = d
+			break
+		}
+	}
+
+	newPath, err := watch.DisposeFile(dir, path, false, time.Now())
+	if err != nil {
+		s.logger.Errorf("error in disposing of file %s %s\n", path, err.Error())
+		return
+	}
+	s.logger.Infof("extract disposed of processed file %s new path %s\n", path, newPath)
+}
+
+// registerFile registers the data provenance of the file being
+// extracted along with the hash of its content, which is only taken
+// here since the file is complete by the time it is extracted.
+// Under the version duplicate policy the file is recorded as the
+// next version of the content it duplicates.
+func (s *Server) registerFile(dp *dataprov.DataProvenance) error {
+	hash, size, err := dataprov.HashFile(dp.Path)
 	if err != nil {
-		s.logger.Errorf("error in renaming file %s\n", err.Error())
+		return err
+	}
+	dp.Hash = hash
+	dp.Size = size
+	if s.Duplicate == watch.DuplicateVersion {
+		prev, found, err := dataprov.FindByHash(dp.Hash, s.Pi, s.DBCreds)
+		if err != nil {
+			return err
+		}
+		if found {
+			dp.Version = prev.Version + 1
+			dp.PreviousId = prev.Id
+			s.logger.Infof("%s is version %d of %s\n", dp.Path, dp.Version, prev.Path)
+		}
+	}
+	dp.Source = s.SourcePath
+	err = dataprov.Register(dp, s.Pi, s.DBCreds, s.logger)
+	if err == nil {
+		s.dataprovId = dp.Id
 	}
-	s.logger.Infof("extract is renaming processed file %s\n", newPath)
+	return err
 }
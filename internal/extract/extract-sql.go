@@ -0,0 +1,293 @@
+package extract
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/churrodata"
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
+	"gitlab.com/churro-group/churro/internal/loader"
+	"gitlab.com/churro-group/churro/internal/watch"
+	pb "gitlab.com/churro-group/churro/rpc/loader"
+)
+
+const (
+	DEFAULT_SQL_INTERVAL = 300
+	DEFAULT_SQL_DRIVER   = "postgres"
+
+	// sqlConnectionKey is the key of the connection string in a
+	// sql source's connection secret
+	sqlConnectionKey = "connection"
+
+	// sqlRowsPerPush is the number of rows sent in each loader push,
+	// a push grows past it to keep rows sharing a mark together
+	sqlRowsPerPush = 500
+
+	// sqlTimeLayout formats timestamp watermarks so that postgres
+	// and sqlite both compare them as times
+	sqlTimeLayout = "2006-01-02 15:04:05.999999999-07:00"
+)
+
+// Extract from a sql source on its interval until ctx is cancelled,
+// or once when it has a schedule, each run reads the rows past the
+// source's high-water mark, is registered as a dataprov and streams
+// the rows to the loader, the mark only moves past rows the loader
+// wrote
+func (s *Server) ExtractSQL(ctx context.Context) (err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	src, err := s.getSQLSource()
+	if err != nil {
+		return err
+	}
+
+	connection, err := watch.GetSecretValue(src.ConnectionSecret, sqlConnectionKey)
+	if err != nil {
+		return fmt.Errorf("could not read connection secret of sql source %s %v", src.Name, err)
+	}
+	driver := src.Driver
+	if driver == "" {
+		driver = DEFAULT_SQL_DRIVER
+	}
+	srcDB, err := sql.Open(driver, connection)
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+
+	adminDB, err := sql.Open("postgres", s.AdminDBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource))
+	if err != nil {
+		return fmt.Errorf("could not open the admin database %v", err)
+	}
+	defer adminDB.Close()
+
+	conn, loaderclient, err := s.dialLoaderClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	interval := src.IntervalSeconds
+	if interval <= 0 {
+		interval = DEFAULT_SQL_INTERVAL
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		err = s.runSQLSource(ctx, loaderclient, srcDB, adminDB, src)
+		if err != nil {
+			s.logger.Errorf("error reading sql source %s %s\n", src.Name, err.Error())
+		}
+
+		// a scheduled source is read once per run of its schedule
+		if src.Schedule != "" {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// runSQLSource reads the new rows of a source once and advances its
+// high-water mark
+func (s *Server) runSQLSource(ctx context.Context, loaderclient pb.LoaderClient, srcDB, adminDB *sql.DB, src v1alpha1.SQLSource) error {
+	mark, err := watch.GetSourceWatermark(src.Name, adminDB)
+	if err != nil {
+		return fmt.Errorf("could not read watermark %v", err)
+	}
+
+	dp := dataprov.DataProvenance{}
+	dp.Name = src.Name
+	dp.Path = "sql/" + src.Name
+	err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+	if err != nil {
+		return fmt.Errorf("can not register data prov %v %v", dp, err)
+	}
+	s.logger.Info("dp info ", zap.String("dp", fmt.Sprintf("%+v", dp)))
+
+	tableChecked := false
+	watermark, err := readSQLSource(ctx, srcDB, src, mark.Watermark, func(columns []string, rows [][]string) error {
+		types := make([]string, len(columns))
+		for c := range types {
+			types[c] = "TEXT"
+		}
+		if !tableChecked {
+			err := s.tableCheck(columns, types)
+			if err != nil {
+				return err
+			}
+			tableChecked = true
+		}
+
+		jsonStruct := churrodata.JsonPathFormat{}
+		jsonStruct.Path = dp.Path
+		jsonStruct.Dataprov = dp.Id
+		jsonStruct.Tablename = s.TableName
+		jsonStruct.PipelineName = s.Pi.Name
+		jsonStruct.ColumnNames = columns
+		jsonStruct.ColumnTypes = types
+		jsonStruct.Records = make([]churrodata.JsonPathRow, 0, len(rows))
+		for _, r := range rows {
+			jsonStruct.Records = append(jsonStruct.Records, churrodata.JsonPathRow{Cols: r})
+		}
+		someBytes, _ := json.Marshal(jsonStruct)
+		return s.pushConfirmed(ctx, loaderclient, loader.LoaderMessage{Metadata: someBytes, DataFormat: config.JSONPathScheme})
+	})
+
+	// rows written by the loader before an error are not read again
+	if watermark != mark.Watermark {
+		mark.Watermark = watermark
+		saveErr := mark.Upsert(adminDB)
+		if saveErr != nil && err == nil {
+			err = fmt.Errorf("could not save watermark %v", saveErr)
+		}
+	}
+	return err
+}
+
+// getSQLSource finds the pipeline sql source being extracted
+func (s *Server) getSQLSource() (v1alpha1.SQLSource, error) {
+	for _, src := range s.Pi.Spec.SQLSources {
+		if src.Name == s.WatchDirName {
+			return src, nil
+		}
+	}
+	return v1alpha1.SQLSource{}, fmt.Errorf("sql source %s is not defined in pipeline %s", s.WatchDirName, s.Pi.Name)
+}
+
+// sqlSourceQuery builds the query of a source, rows are ordered by
+// the incremental column and limited to those past watermark
+func sqlSourceQuery(src v1alpha1.SQLSource, watermark string) (string, error) {
+	if !columnNameRegex.MatchString(src.IncrementalColumn) {
+		return "", fmt.Errorf("%s is not a valid incremental column", src.IncrementalColumn)
+	}
+
+	var from string
+	switch {
+	case src.Query != "":
+		from = "(" + strings.TrimSuffix(strings.TrimSpace(src.Query), ";") + ") AS churro_source"
+	case src.Table != "":
+		for _, part := range strings.Split(src.Table, ".") {
+			if !columnNameRegex.MatchString(part) {
+				return "", fmt.Errorf("%s is not a valid table name", src.Table)
+			}
+		}
+		from = src.Table
+	default:
+		return "", fmt.Errorf("sql source %s needs a query or a table", src.Name)
+	}
+
+	query := "SELECT * FROM " + from
+	if watermark != "" {
+		query += " WHERE " + src.IncrementalColumn + " > $1"
+	}
+	return query + " ORDER BY " + src.IncrementalColumn, nil
+}
+
+// readSQLSource runs the source query and passes the rows to handle
+// in batches, it returns the high-water mark of the rows handled.
+// Rows sharing a mark are never split across batches so every row
+// at the returned mark was handled and reading past it skips none
+func readSQLSource(ctx context.Context, db *sql.DB, src v1alpha1.SQLSource, watermark string, handle func(columns []string, rows [][]string) error) (string, error) {
+	query, err := sqlSourceQuery(src, watermark)
+	if err != nil {
+		return watermark, err
+	}
+
+	args := make([]interface{}, 0, 1)
+	if watermark != "" {
+		args = append(args, watermark)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return watermark, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return watermark, err
+	}
+	markCol := -1
+	for i, c := range columns {
+		columns[i] = strings.ToLower(c)
+		if !columnNameRegex.MatchString(columns[i]) {
+			return watermark, fmt.Errorf("%s is not a valid column name", c)
+		}
+		if columns[i] == strings.ToLower(src.IncrementalColumn) {
+			markCol = i
+		}
+	}
+	if markCol < 0 {
+		return watermark, fmt.Errorf("incremental column %s is not in the result", src.IncrementalColumn)
+	}
+
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	batch := make([][]string, 0, sqlRowsPerPush)
+	batchMark := watermark
+	for rows.Next() {
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			return watermark, err
+		}
+		record := make([]string, len(values))
+		for i, v := range values {
+			record[i] = sqlValueString(v)
+		}
+
+		if len(batch) >= sqlRowsPerPush && record[markCol] != batchMark {
+			err = handle(columns, batch)
+			if err != nil {
+				return watermark, err
+			}
+			watermark = batchMark
+			batch = make([][]string, 0, sqlRowsPerPush)
+		}
+		batch = append(batch, record)
+		batchMark = record[markCol]
+	}
+	if err = rows.Err(); err != nil {
+		return watermark, err
+	}
+	if len(batch) > 0 {
+		err = handle(columns, batch)
+		if err != nil {
+			return watermark, err
+		}
+		watermark = batchMark
+	}
+	return watermark, nil
+}
+
+func sqlValueString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(t)
+	case time.Time:
+		return t.Format(sqlTimeLayout)
+	default:
+		return fmt.Sprint(t)
+	}
+}
@@ -0,0 +1,151 @@
+package extract
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+)
+
+func TestReadSQLSource(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("create table orders (id integer, item text, note text)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("insert into orders values (1, 'apple', null), (2, 'pear', 'ripe'), (3, 'plum', '')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := v1alpha1.SQLSource{Name: "orders", Table: "orders", IncrementalColumn: "id"}
+
+	var got [][]string
+	handle := func(columns []string, rows [][]string) error {
+		if len(columns) != 3 || columns[1] != "item" {
+			t.Errorf("unexpected columns %v", columns)
+		}
+		got = append(got, rows...)
+		return nil
+	}
+
+	mark, err := readSQLSource(context.Background(), db, src, "", handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mark != "3" || len(got) != 3 {
+		t.Fatalf("expected 3 rows and mark 3, got %d rows and mark %s", len(got), mark)
+	}
+	if got[0][2] != "" || got[1][2] != "ripe" {
+		t.Errorf("unexpected rows %v", got)
+	}
+
+	_, err = db.Exec("insert into orders values (4, 'fig', null)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	mark, err = readSQLSource(context.Background(), db, src, mark, handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mark != "4" || len(got) != 1 || got[0][1] != "fig" {
+		t.Fatalf("expected only the new row, got %v mark %s", got, mark)
+	}
+
+	// nothing new leaves the mark alone
+	got = nil
+	mark, err = readSQLSource(context.Background(), db, src, mark, handle)
+	if err != nil || mark != "4" || len(got) != 0 {
+		t.Fatalf("expected no rows, got %v mark %s err %v", got, mark, err)
+	}
+}
+
+func TestReadSQLSourceBatchMark(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("create table events (id integer, seq integer)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the rows with id sqlRowsPerPush straddle the first batch
+	for i := 1; i <= sqlRowsPerPush+3; i++ {
+		id := i
+		if i > sqlRowsPerPush {
+			id = sqlRowsPerPush
+		}
+		if i == sqlRowsPerPush+3 {
+			id = sqlRowsPerPush + 1
+		}
+		_, err = db.Exec("insert into events values ($1, $2)", id, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src := v1alpha1.SQLSource{Name: "events", Table: "events", IncrementalColumn: "id"}
+
+	var batches []int
+	failed := errors.New("loader failed")
+	mark, err := readSQLSource(context.Background(), db, src, "", func(columns []string, rows [][]string) error {
+		batches = append(batches, len(rows))
+		if len(batches) == 2 {
+			return failed
+		}
+		return nil
+	})
+	if err != failed {
+		t.Fatalf("expected the handle error, got %v", err)
+	}
+	if len(batches) != 2 || batches[0] != sqlRowsPerPush+2 {
+		t.Fatalf("expected the rows sharing a mark in one batch, got %v", batches)
+	}
+	if mark != strconv.Itoa(sqlRowsPerPush) {
+		t.Fatalf("expected mark %d, got %s", sqlRowsPerPush, mark)
+	}
+
+	var got [][]string
+	_, err = readSQLSource(context.Background(), db, src, mark, func(columns []string, rows [][]string) error {
+		got = append(got, rows...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0][0] != strconv.Itoa(sqlRowsPerPush+1) {
+		t.Fatalf("expected only the row past the mark, got %v", got)
+	}
+}
+
+func TestSQLSourceQuery(t *testing.T) {
+	q, err := sqlSourceQuery(v1alpha1.SQLSource{Query: "select * from t;", IncrementalColumn: "ts"}, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != "SELECT * FROM (select * from t) AS churro_source WHERE ts > $1 ORDER BY ts" {
+		t.Errorf("unexpected query %s", q)
+	}
+
+	_, err = sqlSourceQuery(v1alpha1.SQLSource{Table: "t; drop table x", IncrementalColumn: "ts"}, "")
+	if err == nil {
+		t.Error("expected an invalid table name to fail")
+	}
+	_, err = sqlSourceQuery(v1alpha1.SQLSource{Table: "t", IncrementalColumn: "ts desc"}, "")
+	if err == nil {
+		t.Error("expected an invalid incremental column to fail")
+	}
+}
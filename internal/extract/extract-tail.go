@@ -0,0 +1,319 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/internal/churrodata"
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
+	"gitlab.com/churro-group/churro/internal/loader"
+	"gitlab.com/churro-group/churro/internal/transform"
+	"gitlab.com/churro-group/churro/internal/watch"
+	pb "gitlab.com/churro-group/churro/rpc/loader"
+)
+
+const (
+	// tailPollInterval is how often followed files are checked for
+	// new lines
+	tailPollInterval = time.Second
+
+	// tailMaxRead bounds what is read from a file in one poll, a
+	// line longer than this is split
+	tailMaxRead = 4 << 20
+)
+
+// Extract the new lines of the files in a tail mode watch directory
+// until ctx is cancelled, like tail -F files are followed across
+// rotation and truncation and the offset of each file is kept in the
+// admin database once the loader wrote its lines so a restart resumes
+// where it stopped
+func (s *Server) ExtractTail(ctx context.Context) (err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	adminDB, err := sql.Open("postgres", s.AdminDBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource))
+	if err != nil {
+		return fmt.Errorf("could not open the admin database %v", err)
+	}
+	defer adminDB.Close()
+
+	dir, err := s.getTailDirectory(adminDB)
+	if err != nil {
+		return err
+	}
+	fileRegex, err := regexp.Compile(dir.Regex)
+	if err != nil {
+		return fmt.Errorf("invalid regex %s %v", dir.Regex, err)
+	}
+	parser, err := newLineParser(dir)
+	if err != nil {
+		return err
+	}
+
+	jsonStruct := churrodata.JsonPathFormat{}
+	jsonStruct.Tablename = s.TableName
+	jsonStruct.PipelineName = s.Pi.Name
+	jsonStruct.ColumnNames = parser.columns
+	jsonStruct.ColumnTypes = make([]string, len(parser.columns))
+	for c := range jsonStruct.ColumnTypes {
+		jsonStruct.ColumnTypes[c] = "TEXT"
+	}
+
+	err = s.tableCheck(jsonStruct.ColumnNames, jsonStruct.ColumnTypes)
+	if err != nil {
+		return err
+	}
+
+	offsets, err := watch.GetTailOffsets(dir.Id, adminDB)
+	if err != nil {
+		return fmt.Errorf("could not read tail offsets %v", err)
+	}
+
+	conn, loaderclient, err := s.dialLoaderClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// each followed file is registered as a dataprov the first time
+	// it has lines in this run
+	dps := make(map[string]string)
+
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+
+	for {
+		files, listErr := ioutil.ReadDir(dir.Path)
+		if listErr != nil {
+			s.logger.Errorf("error listing %s %s\n", dir.Path, listErr.Error())
+		}
+
+		// offsets are looked up in the state before this poll so
+		// a renamed file keeps its offset
+		known := make(map[string]watch.TailOffset, len(offsets))
+		for k, v := range offsets {
+			known[k] = v
+		}
+
+		listed := make(map[string]bool, len(files))
+		for _, fi := range files {
+			path := filepath.Join(dir.Path, fi.Name())
+			if fi.IsDir() || !fileRegex.MatchString(path) {
+				continue
+			}
+			listed[path] = true
+
+			lines, off, err := tailFile(path, known)
+			if err != nil {
+				s.logger.Errorf("error reading %s %s\n", path, err.Error())
+				continue
+			}
+
+			if len(lines) > 0 {
+				if dps[path] == "" {
+					dp := dataprov.DataProvenance{}
+					dp.Name = fi.Name()
+					dp.Path = path
+					err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+					if err != nil {
+						s.logger.Errorf("can not register data prov %s %s\n", path, err.Error())
+						continue
+					}
+					s.logger.Info("dp info ", zap.String("dp", fmt.Sprintf("%+v", dp)))
+					dps[path] = dp.Id
+				}
+				jsonStruct.Path = path
+				jsonStruct.Dataprov = dps[path]
+				err = s.pushLines(ctx, loaderclient, jsonStruct, parser, lines)
+				if err != nil {
+					// the offset is kept so the lines are read again
+					s.logger.Errorf("error loading %s %s\n", path, err.Error())
+					continue
+				}
+			}
+
+			if off != offsets[path] {
+				off.WatchDirectoryId = dir.Id
+				err = off.Upsert(adminDB)
+				if err != nil {
+					s.logger.Errorf("error saving offset of %s %s\n", path, err.Error())
+				}
+				offsets[path] = off
+			}
+		}
+
+		// the offsets of files that are gone are dropped so a new
+		// file reusing an inode is not read from a stale offset
+		if listErr == nil {
+			s.pruneTailOffsets(adminDB, offsets, listed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneTailOffsets removes the offsets of the files no longer listed
+func (s *Server) pruneTailOffsets(db *sql.DB, offsets map[string]watch.TailOffset, listed map[string]bool) {
+	for path, off := range offsets {
+		if listed[path] {
+			continue
+		}
+		err := off.Delete(db)
+		if err != nil {
+			s.logger.Errorf("error removing offset of %s %s\n", path, err.Error())
+			continue
+		}
+		delete(offsets, path)
+	}
+}
+
+// pushLines parses lines into records and sends them to the loader,
+// it returns once they are written, lines the parser does not match
+// are skipped
+func (s *Server) pushLines(ctx context.Context, loaderclient pb.LoaderClient, jsonStruct churrodata.JsonPathFormat, parser lineParser, lines []string) error {
+	jsonStruct.Records = make([]churrodata.JsonPathRow, 0, RecordsPerPush)
+	push := func() error {
+		if len(jsonStruct.Records) == 0 {
+			return nil
+		}
+		someBytes, _ := json.Marshal(jsonStruct)
+		jsonStruct.Records = make([]churrodata.JsonPathRow, 0, RecordsPerPush)
+		return s.pushConfirmed(ctx, loaderclient, loader.LoaderMessage{Metadata: someBytes, DataFormat: config.JSONPathScheme})
+	}
+
+	skipped := 0
+	for _, line := range lines {
+		record, err := parser.parse(line)
+		if err != nil {
+			skipped++
+			continue
+		}
+		err = transform.RunRules(config.TailScheme, jsonStruct.ColumnNames, record, s.TransformRules, s.TransformFunctions, s.logger)
+		if err != nil {
+			s.logger.Error("error in runrules", zap.Error(err))
+		}
+		jsonStruct.Records = append(jsonStruct.Records, churrodata.JsonPathRow{Cols: record})
+		if len(jsonStruct.Records) >= RecordsPerPush {
+			err = push()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if skipped > 0 {
+		s.logger.Infof("skipped %d lines of %s that did not parse\n", skipped, jsonStruct.Path)
+	}
+	return push()
+}
+
+// getTailDirectory finds the watch directory being followed along
+// with its extract rules
+func (s *Server) getTailDirectory(db *sql.DB) (watch.WatchDirectory, error) {
+	dirs, err := watch.GetWatchDirectories(db)
+	if err != nil {
+		return watch.WatchDirectory{}, err
+	}
+	for _, dir := range dirs {
+		if dir.Name == s.WatchDirName && dir.WatchMode == watch.WatchModeTail {
+			return watch.GetWatchDirectory(dir.Id, db)
+		}
+	}
+	return watch.WatchDirectory{}, fmt.Errorf("watch directory %s is not defined", s.WatchDirName)
+}
+
+// tailFile reads the complete lines added to a file since its offset
+// in known, a file with a new inode is read from the offset of the
+// path it was renamed from or else from the start, and a file smaller
+// than its offset was truncated and is read from the start
+func tailFile(path string, known map[string]watch.TailOffset) (lines []string, off watch.TailOffset, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, off, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, off, err
+	}
+	inode := fileInode(fi)
+
+	off, ok := known[path]
+	if !ok || off.Inode != inode {
+		off = watch.TailOffset{}
+		for _, o := range known {
+			if o.Inode == inode {
+				off = o
+				break
+			}
+		}
+	}
+	off.Path = path
+	off.Inode = inode
+	if fi.Size() < off.Offset {
+		off.Offset = 0
+	}
+	if fi.Size() == off.Offset {
+		return nil, off, nil
+	}
+
+	_, err = f.Seek(off.Offset, io.SeekStart)
+	if err != nil {
+		return nil, off, err
+	}
+	size := fi.Size() - off.Offset
+	if size > tailMaxRead {
+		size = tailMaxRead
+	}
+	buf := make([]byte, size)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, off, err
+	}
+	data := buf[:n]
+
+	// a partial last line is read once it is complete
+	end := bytes.LastIndexByte(data, '\n') + 1
+	if end == 0 {
+		if n < tailMaxRead {
+			return nil, off, nil
+		}
+		end = n
+	}
+
+	for _, line := range strings.Split(string(data[:end]), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	off.Offset += int64(end)
+	return lines, off, nil
+}
+
+func fileInode(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
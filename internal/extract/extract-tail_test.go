@@ -0,0 +1,133 @@
+package extract
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/churro-group/churro/internal/watch"
+)
+
+func TestTailFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	appendTo := func(p, text string) {
+		f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(text)
+		f.Close()
+	}
+	offsets := make(map[string]watch.TailOffset)
+	read := func(p string) []string {
+		lines, off, err := tailFile(p, offsets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets[p] = off
+		return lines
+	}
+	expect := func(got []string, want ...string) {
+		t.Helper()
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("got %q want %q", got, want)
+		}
+	}
+
+	appendTo(path, "one\ntwo\nthr")
+	expect(read(path), "one", "two")
+
+	// the partial line is read once it is complete
+	appendTo(path, "ee\r\n")
+	expect(read(path), "three")
+	expect(read(path))
+
+	// truncation starts over
+	os.Truncate(path, 0)
+	appendTo(path, "four\n")
+	expect(read(path), "four")
+
+	// a rotated file keeps its offset under its new name and the
+	// new file is read from the start
+	appendTo(path, "five\n")
+	rotated := path + ".1"
+	os.Rename(path, rotated)
+	appendTo(path, "six\n")
+	known := make(map[string]watch.TailOffset)
+	for k, v := range offsets {
+		known[k] = v
+	}
+	lines, off, err := tailFile(path, known)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(lines, "six")
+	lines, rotatedOff, err := tailFile(rotated, known)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(lines, "five")
+	if off.Offset != 4 || rotatedOff.Offset != 10 {
+		t.Errorf("unexpected offsets %d %d", off.Offset, rotatedOff.Offset)
+	}
+}
+
+func TestLineParser(t *testing.T) {
+	rules := map[string]watch.ExtractRule{
+		"1": {ColumnName: "level", RuleSource: "lvl"},
+		"2": {ColumnName: "msg", RuleSource: ""},
+	}
+
+	tests := []struct {
+		name    string
+		dir     watch.WatchDirectory
+		line    string
+		columns []string
+		want    []string
+	}{
+		{"Regex", watch.WatchDirectory{LineParser: watch.LineParserRegex, LinePattern: `^(?P<level>\w+) (?P<msg>.*)$`},
+			"INFO started", []string{"level", "msg"}, []string{"INFO", "started"}},
+		{"JSON", watch.WatchDirectory{LineParser: watch.LineParserJSON, ExtractRules: map[string]watch.ExtractRule{
+			"1": {ColumnName: "level", RuleSource: "$.level"},
+			"2": {ColumnName: "msg", RuleSource: "$.msg"},
+		}}, `{"level":"warn","msg":"disk low"}`, []string{"level", "msg"}, []string{"warn", "disk low"}},
+		{"Logfmt", watch.WatchDirectory{LineParser: watch.LineParserLogfmt, ExtractRules: rules},
+			`ts=1 lvl=error msg="a \"quoted\" message" debug`, []string{"level", "msg"}, []string{"error", `a "quoted" message`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.dir.WatchMode = watch.WatchModeTail
+			p, err := newLineParser(tt.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(p.columns, ",") != strings.Join(tt.columns, ",") {
+				t.Errorf("got columns %v want %v", p.columns, tt.columns)
+			}
+			got, err := p.parse(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+
+	p, _ := newLineParser(watch.WatchDirectory{WatchMode: watch.WatchModeTail, LineParser: watch.LineParserRegex, LinePattern: `^(?P<level>\w+):`})
+	if _, err := p.parse("no colon"); err != errNoMatch {
+		t.Errorf("expected no match, got %v", err)
+	}
+	_, err := newLineParser(watch.WatchDirectory{WatchMode: watch.WatchModeTail, LineParser: watch.LineParserRegex, LinePattern: `^(\w+)`})
+	if err == nil {
+		t.Error("expected a pattern without named groups to fail")
+	}
+}
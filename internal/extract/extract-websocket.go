@@ -0,0 +1,272 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ohler55/ojg/jp"
+	"github.com/ohler55/ojg/oj"
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/churrodata"
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
+	"gitlab.com/churro-group/churro/internal/loader"
+	"gitlab.com/churro-group/churro/internal/transform"
+)
+
+// socketFlushInterval bounds how long received socket records wait
+// for a batch to fill before they are pushed
+var socketFlushInterval = 5 * time.Second
+
+// Extract from a websocket described by a WatchSocket until the
+// socket closes or ctx is cancelled, each message is mapped to
+// columns using the socket's JSONPath extract rules
+func (s *Server) ExtractWebSocket(ctx context.Context) (err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	socket, err := s.getWatchSocket()
+	if err != nil {
+		return err
+	}
+	if len(socket.ExtractRules) == 0 {
+		return fmt.Errorf("socket %s has no extract rules", socket.Name)
+	}
+
+	dp := dataprov.DataProvenance{}
+	dp.Name = socket.Name
+	dp.Path = socket.Path
+	err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+	if err != nil {
+		return fmt.Errorf("can not register data prov %v %v", dp, err)
+	}
+	s.logger.Info("dp info ", zap.String("dp", fmt.Sprintf("%+v", dp)))
+
+	jsonStruct := churrodata.JsonPathFormat{}
+	jsonStruct.Path = socket.Path
+	jsonStruct.Dataprov = dp.Id
+	jsonStruct.Tablename = s.TableName
+	jsonStruct.PipelineName = s.Pi.Name
+	jsonStruct.ColumnNames = make([]string, 0)
+	jsonStruct.ColumnTypes = make([]string, 0)
+	for _, r := range socket.ExtractRules {
+		jsonStruct.ColumnNames = append(jsonStruct.ColumnNames, r.ColumnName)
+		jsonStruct.ColumnTypes = append(jsonStruct.ColumnTypes, "TEXT")
+	}
+
+	err = s.tableCheck(jsonStruct.ColumnNames, jsonStruct.ColumnTypes)
+	if err != nil {
+		return err
+	}
+
+	stop := s.startPushing(config.JSONPathScheme)
+	defer stop()
+
+	jsonStruct.Records = make([]churrodata.JsonPathRow, 0, RecordsPerPush)
+	push := func() {
+		if len(jsonStruct.Records) == 0 {
+			return
+		}
+		// back-pressure check
+		if atomic.LoadInt32(&backPressure) == 1 {
+			s.logger.Info("sleeping due to backpressure...")
+			time.Sleep(time.Second * time.Duration(sleepTime))
+		}
+		someBytes, _ := json.Marshal(jsonStruct)
+		s.Queue <- loader.LoaderMessage{Metadata: someBytes, DataFormat: config.JSONPathScheme}
+		jsonStruct.Records = make([]churrodata.JsonPathRow, 0, RecordsPerPush)
+	}
+	// the records received last are pushed however the stream ends
+	defer push()
+
+	received := make(chan [][]string)
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- streamSocket(ctx, socket, func(records [][]string) {
+			received <- records
+		})
+	}()
+
+	flush := time.NewTicker(socketFlushInterval)
+	defer flush.Stop()
+
+	for {
+		select {
+		case err := <-streamErr:
+			return err
+		case <-flush.C:
+			push()
+		case records := <-received:
+			for _, record := range records {
+				err := transform.RunRules(config.WebSocketScheme, jsonStruct.ColumnNames, record, s.TransformRules, s.TransformFunctions, s.logger)
+				if err != nil {
+					s.logger.Error("error in runrules", zap.Error(err))
+				}
+				jsonStruct.Records = append(jsonStruct.Records, churrodata.JsonPathRow{Cols: record})
+				if len(jsonStruct.Records) >= RecordsPerPush {
+					push()
+				}
+			}
+		}
+	}
+}
+
+// getWatchSocket finds the pipeline socket being extracted, the
+// watch directory name holds the socket name for socket work
+func (s *Server) getWatchSocket() (v1alpha1.WatchSocket, error) {
+	for _, socket := range s.Pi.Spec.WatchSockets {
+		if socket.Name == s.WatchDirName {
+			return socket, nil
+		}
+	}
+	return v1alpha1.WatchSocket{}, fmt.Errorf("socket %s is not defined in pipeline %s", s.WatchDirName, s.Pi.Name)
+}
+
+// streamSocket connects to the socket, sends its subscribe
+// messages and passes the records of each message to handle
+func streamSocket(ctx context.Context, socket v1alpha1.WatchSocket, handle func(records [][]string)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rules, err := compileSocketRules(socket.RecordPath, socket.ExtractRules)
+	if err != nil {
+		return err
+	}
+	msgs, err := subscribeMessages(socket)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	for k, v := range socket.Headers {
+		header.Set(k, v)
+	}
+
+	w, _, err := websocket.DefaultDialer.DialContext(ctx, socket.Path, header)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// unblock the read below when the extract is stopped
+	go func() {
+		<-ctx.Done()
+		w.Close()
+	}()
+
+	for _, msg := range msgs {
+		err = w.WriteMessage(websocket.TextMessage, []byte(msg))
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		_, msg, err := w.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		records, err := rules.records(msg)
+		if err != nil {
+			// a message that is not JSON, such as a heartbeat,
+			// does not end the stream
+			continue
+		}
+		if len(records) > 0 {
+			handle(records)
+		}
+	}
+}
+
+// subscribeMessages renders the socket's subscribe template once
+// for each item
+func subscribeMessages(socket v1alpha1.WatchSocket) ([]string, error) {
+	msgs := make([]string, 0)
+	if socket.Subscribe == "" {
+		return msgs, nil
+	}
+
+	tmpl, err := template.New(socket.Name).Parse(socket.Subscribe)
+	if err != nil {
+		return msgs, fmt.Errorf("invalid subscribe template %v", err)
+	}
+
+	for _, item := range socket.Items {
+		var b bytes.Buffer
+		err = tmpl.Execute(&b, item)
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, b.String())
+	}
+	return msgs, nil
+}
+
+// socketRules are the compiled JSONPaths of a socket
+type socketRules struct {
+	record jp.Expr
+	cols   []jp.Expr
+}
+
+func compileSocketRules(recordPath string, extractRules []v1alpha1.SocketRule) (r socketRules, err error) {
+	if recordPath != "" {
+		r.record, err = jp.ParseString(recordPath)
+		if err != nil {
+			return r, fmt.Errorf("invalid record path %s %v", recordPath, err)
+		}
+	}
+	for _, rule := range extractRules {
+		x, err := jp.ParseString(rule.RuleSource)
+		if err != nil {
+			return r, fmt.Errorf("invalid rule for column %s %v", rule.ColumnName, err)
+		}
+		r.cols = append(r.cols, x)
+	}
+	return r, nil
+}
+
+// records applies the rules to each record in a message, a rule
+// without a match leaves its column empty
+func (r socketRules) records(msg []byte) ([][]string, error) {
+	obj, err := oj.Parse(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []interface{}{obj}
+	if r.record != nil {
+		items = r.record.Get(obj)
+	}
+
+	records := make([][]string, 0, len(items))
+	for _, item := range items {
+		record := make([]string, len(r.cols))
+		for i, x := range r.cols {
+			found := x.Get(item)
+			if len(found) == 0 {
+				continue
+			}
+			if v, ok := found[0].(string); ok {
+				record[i] = v
+			} else {
+				record[i] = oj.JSON(found[0])
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,107 @@
+package extract
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+)
+
+func TestStreamSocket(t *testing.T) {
+	subscribed := make(chan string, 4)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for i := 0; i < 2; i++ {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			subscribed <- string(msg)
+		}
+		c.WriteMessage(websocket.TextMessage, []byte(`ping`))
+		c.WriteMessage(websocket.TextMessage, []byte(`{"type":"trade","data":[{"s":"AAPL","p":101.5},{"s":"AMZN"}]}`))
+		c.ReadMessage()
+	}))
+	defer srv.Close()
+
+	socket := v1alpha1.WatchSocket{
+		Name:       "trades",
+		Path:       "ws" + strings.TrimPrefix(srv.URL, "http"),
+		Headers:    map[string]string{"X-Token": "secret"},
+		Subscribe:  `{"type":"subscribe","symbol":"{{.}}"}`,
+		Items:      []string{"AAPL", "AMZN"},
+		RecordPath: "$.data[*]",
+		ExtractRules: []v1alpha1.SocketRule{
+			{ColumnName: "symbol", RuleSource: "$.s"},
+			{ColumnName: "price", RuleSource: "$.p"},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan [][]string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- streamSocket(ctx, socket, func(records [][]string) {
+			got <- records
+		})
+	}()
+
+	for _, want := range []string{`{"type":"subscribe","symbol":"AAPL"}`, `{"type":"subscribe","symbol":"AMZN"}`} {
+		select {
+		case msg := <-subscribed:
+			if msg != want {
+				t.Fatalf("expected subscribe %s, got %s", want, msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for subscribe")
+		}
+	}
+
+	select {
+	case records := <-got:
+		if len(records) != 2 {
+			t.Fatalf("expected 2 records, got %v", records)
+		}
+		if records[0][0] != "AAPL" || records[0][1] != "101.5" {
+			t.Fatalf("unexpected first record %v", records[0])
+		}
+		if records[1][0] != "AMZN" || records[1][1] != "" {
+			t.Fatalf("unexpected second record %v", records[1])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for records")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected the stream to stop on cancel, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not stop")
+	}
+}
+
+func TestCompileSocketRules(t *testing.T) {
+	socket := v1alpha1.WatchSocket{
+		ExtractRules: []v1alpha1.SocketRule{{ColumnName: "bad", RuleSource: "$.["}},
+	}
+	if _, err := compileSocketRules(socket.RecordPath, socket.ExtractRules); err == nil {
+		t.Fatal("expected an invalid rule to be rejected")
+	}
+}
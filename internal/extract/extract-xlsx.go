@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"github.com/360EntSecGroup-Skylar/excelize/v2"
 	"go.uber.org/zap"
-	"os"
-	"time"
 
 	"gitlab.com/churro-group/churro/internal/churrodata"
 	"gitlab.com/churro-group/churro/internal/config"
@@ -35,10 +33,10 @@ func (s *Server) ExtractXLS(ctx context.Context) (err error) {
 	dp := dataprov.DataProvenance{}
 	dp.Name = s.FileName
 	dp.Path = s.FileName
-	err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+	err = s.registerFile(&dp)
 	if err != nil {
 		s.logger.Error("can not register data prov")
-		os.Exit(1)
+		return err
 	}
 	s.logger.Info("dp info", zap.String("name", dp.Name), zap.String("path", dp.Path))
 
@@ -49,9 +47,11 @@ func (s *Server) ExtractXLS(ctx context.Context) (err error) {
 		return err
 	}
 
-	go s.pushToLoader(ctx, config.XLSXScheme)
-
-	time.Sleep(time.Second * time.Duration(sleepTime))
+	conn, loaderclient, err := s.dialLoaderClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
 
 	xlsStruct := churrodata.XLSFormat{}
 	xlsStruct.Path = s.FileName
@@ -60,18 +60,21 @@ func (s *Server) ExtractXLS(ctx context.Context) (err error) {
 	xlsStruct.ColumnNames = make([]string, 0)
 	xlsStruct.ColumnTypes = make([]string, 0)
 
+	// each batch waits for the loader to write it so the file is
+	// only disposed of once every row was loaded
+	push := func() error {
+		xlsBytes, _ := json.Marshal(xlsStruct)
+		msg := loader.LoaderMessage{}
+		msg.Metadata = xlsBytes
+		msg.DataFormat = config.XLSXScheme
+		return s.pushConfirmed(ctx, loaderclient, msg)
+	}
+
 	firstRow := true
-	// for now, only a single row per Queue message
+	// rows are pushed in batches of FileRecordsPerPush
 	xlsStruct.Records = make([]churrodata.XLSRow, 0)
 
 	for r := 0; r < len(rows); r++ {
-		// back-pressure check
-		if backPressure == 1 {
-			fmt.Printf("sleeping due to backpressure...")
-			time.Sleep(time.Second * time.Duration(sleepTime))
-			continue
-		}
-
 		record := rows[r]
 
 		// process the xls header which we expect to be there
@@ -92,6 +95,7 @@ func (s *Server) ExtractXLS(ctx context.Context) (err error) {
 				return err
 			}
 			xlsStruct.Tablename = s.TableName
+			xlsStruct.Load = s.watchDirLoad()
 		} else {
 			// TODO apply transforms to XLS data
 			/**
@@ -106,19 +110,13 @@ func (s *Server) ExtractXLS(ctx context.Context) (err error) {
 			r := getXLSRow(record)
 			xlsStruct.Records = append(xlsStruct.Records, r)
 			s.logger.Debug("xls record read")
-			if s.Queue == nil {
-				s.logger.Debug("Info: queue is nil")
-			}
-			s.logger.Debug("queue len", zap.Int("queue len", len(s.Queue)))
-
-			if len(xlsStruct.Records) >= RecordsPerPush {
-				s.logger.Info("pushing to Queue")
-				//convert xlsStruct into []byte
-				xlsBytes, _ := json.Marshal(xlsStruct)
-				msg := loader.LoaderMessage{}
-				msg.Metadata = xlsBytes
-				msg.DataFormat = config.XLSXScheme
-				s.Queue <- msg
+
+			if len(xlsStruct.Records) >= FileRecordsPerPush {
+				s.logger.Info("pushing to loader")
+				err := push()
+				if err != nil {
+					return err
+				}
 				xlsStruct.Records = make([]churrodata.XLSRow, 0)
 			}
 		}
@@ -126,17 +124,15 @@ func (s *Server) ExtractXLS(ctx context.Context) (err error) {
 	}
 
 	if len(xlsStruct.Records) > 0 {
-		xlsBytes, _ := json.Marshal(xlsStruct)
-		msg := loader.LoaderMessage{}
-		msg.Metadata = xlsBytes
-		msg.DataFormat = config.XLSXScheme
-		s.Queue <- msg
+		err = push()
+		if err != nil {
+			return err
+		}
 	}
 
-	s.logger.Info("end of xlsx file reached, cancelling pushes...")
-	time.Sleep(time.Second * 10)
+	s.logger.Info("end of xlsx file reached")
 
-	return err
+	return nil
 }
 
 func getXLSRow(record []string) churrodata.XLSRow {
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"time"
 
 	"gitlab.com/churro-group/churro/internal/churrodata"
 	"gitlab.com/churro-group/churro/internal/config"
@@ -43,16 +42,18 @@ func (s *Server) ExtractXML(ctx context.Context) (err error) {
 	dp := dataprov.DataProvenance{}
 	dp.Name = s.FileName
 	dp.Path = s.FileName
-	err = dataprov.Register(&dp, s.Pi, s.DBCreds, s.logger)
+	err = s.registerFile(&dp)
 	if err != nil {
 		s.logger.Error("can not register data prov")
-		os.Exit(1)
+		return err
 	}
 	s.logger.Infof("dp info %s %s\n", dp.Name, dp.Path)
 
-	go s.pushToLoader(ctx, config.XMLScheme)
-
-	time.Sleep(time.Second * time.Duration(sleepTime))
+	conn, loaderclient, err := s.dialLoaderClient()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
 
 	rules := getXMLRules(s.WatchDirectory)
 
@@ -62,6 +63,7 @@ func (s *Server) ExtractXML(ctx context.Context) (err error) {
 	xmlStruct.Dataprov = dp.Id
 	xmlStruct.PipelineName = s.Pi.Name
 	xmlStruct.Tablename = s.TableName
+	xmlStruct.Load = s.watchDirLoad()
 
 	recLen := len(xmlStruct.Records)
 	s.logger.Infof("xml records to process %d\n", recLen)
@@ -71,6 +73,12 @@ func (s *Server) ExtractXML(ctx context.Context) (err error) {
 		return err
 	}
 
+	// only the rules of this watch directory filter its rows
+	filter, err := newRowFilter(xmlStruct.ColumnNames, s.watchDirRules())
+	if err != nil {
+		return err
+	}
+
 	s.logger.Infof("transform rules %s\n", fmt.Sprintf("%+v", s.TransformRules))
 
 	// partStruct holds a portion of the overall xmlStruct records
@@ -80,11 +88,21 @@ func (s *Server) ExtractXML(ctx context.Context) (err error) {
 
 	s.logger.Infof("partStruct col len %d\n", len(partStruct.ColumnNames))
 
+	// each batch waits for the loader to write it so the file is
+	// only disposed of once every record was loaded
+	push := func() error {
+		xmlBytes, _ := json.Marshal(partStruct)
+		msg := loader.LoaderMessage{}
+		msg.Metadata = xmlBytes
+		msg.DataFormat = config.XMLScheme
+		return s.pushConfirmed(ctx, loaderclient, msg)
+	}
+
 	recordsProcessed := 0
 	for i := 0; i < recLen; i++ {
-		if backPressure == 1 {
-			fmt.Printf("sleeping due to backpressure...")
-			time.Sleep(time.Second * time.Duration(sleepTime))
+		if !filter.keep(xmlStruct.Records[i].Cols) {
+			partStruct.Skipped++
+			continue
 		}
 
 		s.logger.Infof("before transform %s\n", fmt.Sprintf("%v", xmlStruct.Records[i].Cols))
@@ -94,40 +112,32 @@ func (s *Server) ExtractXML(ctx context.Context) (err error) {
 		}
 		s.logger.Info("after transform %s\n", fmt.Sprintf("%+v", xmlStruct.Records[i].Cols))
 
-		if s.Queue == nil {
-			s.logger.Debug("Info: queue is nil")
-		}
-		s.logger.Debug("queue len %d\n", len(s.Queue))
-
 		recordsProcessed++
 
 		partStruct.Records = append(partStruct.Records, xmlStruct.Records[i])
-		if recordsProcessed >= RecordsPerPush {
-			s.logger.Info("pushing to Queue")
-			//convert partStruct into []byte
-			xmlBytes, _ := json.Marshal(partStruct)
-			msg := loader.LoaderMessage{}
-			msg.Metadata = xmlBytes
-			msg.DataFormat = "xml"
-			s.Queue <- msg
+		if recordsProcessed >= FileRecordsPerPush {
+			s.logger.Info("pushing to loader")
+			err := push()
+			if err != nil {
+				return err
+			}
 			recordsProcessed = 0
 			partStruct.Records = make([]churrodata.XMLRow, 0)
+			partStruct.Skipped = 0
 		}
 
 	}
 
-	if recordsProcessed > 0 {
-		xmlBytes, _ := json.Marshal(partStruct)
-		msg := loader.LoaderMessage{}
-		msg.Metadata = xmlBytes
-		msg.DataFormat = "xml"
-		s.Queue <- msg
+	if recordsProcessed > 0 || partStruct.Skipped > 0 {
+		err = push()
+		if err != nil {
+			return err
+		}
 	}
 
-	s.logger.Info("end of XML file reached, cancelling pushes...")
-	time.Sleep(time.Second * 5)
+	s.logger.Info("end of XML file reached")
 
-	return err
+	return nil
 }
 
 func getColumn(rule compiledXMLRule, root *xmlpath.Node) (cols []string) {
@@ -0,0 +1,115 @@
+package extract
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"strings"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/config"
+	pb "gitlab.com/churro-group/churro/rpc/ingest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DEFAULT_INGEST_GRPC_PORT = ":8090"
+)
+
+// WriteRecords implements the Ingest service, each batch is loaded
+// in turn and acked when the client closes the stream, batches are
+// not read while the loader reports backpressure
+func (i *Ingester) WriteRecords(stream pb.Ingest_WriteRecordsServer) error {
+	ctx := stream.Context()
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if auth := md.Get("authorization"); len(auth) > 0 {
+			token = strings.TrimPrefix(auth[0], "Bearer ")
+		}
+	}
+
+	resp := &pb.WriteRecordsResponse{}
+	authorized := make(map[string]bool)
+
+	for {
+		err := i.waitBackPressure(ctx)
+		if err != nil {
+			return status.Errorf(codes.Canceled, err.Error())
+		}
+
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(resp)
+		}
+		if err != nil {
+			return err
+		}
+
+		source, ok := i.sources[req.Source]
+		if !ok {
+			return status.Errorf(codes.NotFound, "unknown ingest source %s", req.Source)
+		}
+		if !authorized[req.Source] {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(source.token)) != 1 {
+				return status.Errorf(codes.Unauthenticated, "invalid token for ingest source %s", req.Source)
+			}
+			authorized[req.Source] = true
+		}
+
+		ack := &pb.BatchAck{BatchId: req.BatchId}
+		resp.Acks = append(resp.Acks, ack)
+
+		tableName, err := batchTable(source.src, req.Table)
+		if err == nil {
+			var records [][]string
+			records, err = batchRecords(req)
+			if err == nil {
+				ack.Dataprov, err = i.load(ctx, config.IngestScheme, source.src.Name, IngestPath+source.src.Name, tableName, req.Columns, records)
+			}
+		}
+		if err != nil {
+			i.logger.Errorf("error in ingest batch %s %s\n", req.BatchId, err.Error())
+			ack.Error = err.Error()
+			continue
+		}
+		ack.Records = int32(len(req.Rows))
+	}
+}
+
+// batchTable returns the table a batch is loaded into, a source only
+// writes to its own table and the tables it lists
+func batchTable(src v1alpha1.IngestSource, table string) (string, error) {
+	if table == "" || table == src.Tablename {
+		return src.Tablename, nil
+	}
+	for _, t := range src.Tables {
+		if t == table {
+			return table, nil
+		}
+	}
+	return "", fmt.Errorf("ingest source %s can not write to table %s", src.Name, table)
+}
+
+// batchRecords checks the batch columns and returns its rows
+func batchRecords(req *pb.WriteRecordsRequest) ([][]string, error) {
+	if len(req.Columns) == 0 {
+		return nil, fmt.Errorf("batch has no columns")
+	}
+	for _, c := range req.Columns {
+		if !columnNameRegex.MatchString(c) {
+			return nil, fmt.Errorf("%s is not a valid column name", c)
+		}
+	}
+
+	records := make([][]string, 0, len(req.Rows))
+	for n, row := range req.Rows {
+		if len(row.Values) != len(req.Columns) {
+			return nil, fmt.Errorf("row %d has %d values for %d columns", n, len(row.Values), len(req.Columns))
+		}
+		records = append(records, row.Values)
+	}
+	return records, nil
+}
@@ -0,0 +1,114 @@
+package extract
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
+	pb "gitlab.com/churro-group/churro/rpc/ingest"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type fakeWriteStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	reqs []*pb.WriteRecordsRequest
+	resp *pb.WriteRecordsResponse
+}
+
+func (f *fakeWriteStream) Context() context.Context {
+	return f.ctx
+}
+
+func (f *fakeWriteStream) Recv() (*pb.WriteRecordsRequest, error) {
+	if len(f.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := f.reqs[0]
+	f.reqs = f.reqs[1:]
+	return req, nil
+}
+
+func (f *fakeWriteStream) SendAndClose(resp *pb.WriteRecordsResponse) error {
+	f.resp = resp
+	return nil
+}
+
+func TestWriteRecords(t *testing.T) {
+	pi := v1alpha1.Pipeline{}
+	pi.Spec.IngestSources = []v1alpha1.IngestSource{{Name: "app", Tablename: "events", Tables: []string{"other"}}}
+
+	loader := &fakeLoader{}
+	i, err := NewIngester(pi, config.DBCredentials{}, map[string]string{"app": "secret"}, loader, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.register = func(dp *dataprov.DataProvenance) error {
+		dp.Id = "dp1"
+		return nil
+	}
+	i.tableCheck = func(tableName string, columnNames, columnTypes []string) error {
+		return nil
+	}
+
+	batch := func(id, table string, cols []string, rows ...[]string) *pb.WriteRecordsRequest {
+		req := &pb.WriteRecordsRequest{Source: "app", BatchId: id, Table: table, Columns: cols}
+		for _, r := range rows {
+			req.Rows = append(req.Rows, &pb.Row{Values: r})
+		}
+		return req
+	}
+
+	t.Run("Acks", func(t *testing.T) {
+		stream := &fakeWriteStream{
+			ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer secret")),
+			reqs: []*pb.WriteRecordsRequest{
+				batch("b1", "", []string{"name", "count"}, []string{"a", "1"}, []string{"b", "2"}),
+				batch("b2", "other", []string{"name"}, []string{"c", "3"}),
+				batch("b3", "other", []string{"name"}, []string{"d"}),
+				batch("b4", "accounts", []string{"name"}, []string{"e"}),
+			},
+		}
+		err := i.WriteRecords(stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		acks := stream.resp.Acks
+		if len(acks) != 4 {
+			t.Fatalf("expected 4 acks, got %d", len(acks))
+		}
+		if acks[0].Error != "" || acks[0].Dataprov != "dp1" || acks[0].Records != 2 {
+			t.Fatalf("unexpected ack %+v", acks[0])
+		}
+		if acks[1].Error == "" || acks[1].Records != 0 {
+			t.Fatalf("expected a row with too many values to fail its batch, got %+v", acks[1])
+		}
+		if acks[2].Error != "" || acks[2].Records != 1 {
+			t.Fatalf("unexpected ack %+v", acks[2])
+		}
+		if acks[3].Error == "" || acks[3].Records != 0 {
+			t.Fatalf("expected a table the source does not list to be refused, got %+v", acks[3])
+		}
+		if len(loader.pushed) != 2 || loader.pushed[0].Tablename != "events" || loader.pushed[1].Tablename != "other" {
+			t.Fatalf("unexpected pushes %+v", loader.pushed)
+		}
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		stream := &fakeWriteStream{
+			ctx:  metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer wrong")),
+			reqs: []*pb.WriteRecordsRequest{batch("b1", "", []string{"name"}, []string{"a"})},
+		}
+		err := i.WriteRecords(stream)
+		if status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("expected Unauthenticated, got %v", err)
+		}
+	})
+}
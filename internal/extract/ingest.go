@@ -0,0 +1,361 @@
+package extract
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/churrodata"
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
+	"gitlab.com/churro-group/churro/internal/loader"
+	"gitlab.com/churro-group/churro/internal/transform"
+	"gitlab.com/churro-group/churro/internal/watch"
+	pbloader "gitlab.com/churro-group/churro/rpc/loader"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	DEFAULT_INGEST_PORT = ":8089"
+
+	// IngestPath prefixes the source name in ingest urls
+	IngestPath = "/ingest/"
+
+	// ingestTokenKey is the key of the bearer token in a source's
+	// token secret
+	ingestTokenKey = "token"
+
+	// maxIngestBody bounds the size of a single request body
+	maxIngestBody = 32 << 20
+)
+
+var columnNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type ingestSource struct {
+	src   v1alpha1.IngestSource
+	token string
+	rules socketRules
+}
+
+// Ingester accepts records written to a pipeline's ingest sources
+// and pushes them to the loader, as an http.Handler it takes JSON,
+// NDJSON and CSV bodies and tells callers to retry with a 429 while
+// the loader reports backpressure, it also implements the Ingest
+// gRPC service
+type Ingester struct {
+	logger       *zap.SugaredLogger
+	Pi           v1alpha1.Pipeline
+	DBCreds      config.DBCredentials
+	loader       pbloader.LoaderClient
+	sources      map[string]ingestSource
+	backPressure int32
+	mu           sync.Mutex
+	checked      map[string]bool
+
+	// transform rules with the ingest scheme run on every record
+	TransformFunctions []transform.TransformFunction
+	TransformRules     []transform.TransformRule
+
+	// register and tableCheck are replaced in tests
+	register   func(dp *dataprov.DataProvenance) error
+	tableCheck func(tableName string, columnNames, columnTypes []string) error
+}
+
+// NewIngester creates an ingest handler for the pipeline's ingest
+// sources, tokens holds the bearer token of each source by name
+func NewIngester(pipeline v1alpha1.Pipeline, dbCreds config.DBCredentials, tokens map[string]string, loaderClient pbloader.LoaderClient, l *zap.SugaredLogger) (*Ingester, error) {
+	i := &Ingester{
+		logger:  l,
+		Pi:      pipeline,
+		DBCreds: dbCreds,
+		loader:  loaderClient,
+		sources: make(map[string]ingestSource),
+		checked: make(map[string]bool),
+	}
+	i.register = func(dp *dataprov.DataProvenance) error {
+		return dataprov.Register(dp, i.Pi, i.DBCreds, i.logger)
+	}
+	i.tableCheck = func(tableName string, columnNames, columnTypes []string) error {
+		s := Server{Pi: i.Pi, DBCreds: i.DBCreds, TableName: tableName, logger: i.logger}
+		return s.tableCheck(columnNames, columnTypes)
+	}
+
+	for _, src := range pipeline.Spec.IngestSources {
+		if tokens[src.Name] == "" {
+			return nil, fmt.Errorf("ingest source %s has no token", src.Name)
+		}
+		for _, r := range src.ExtractRules {
+			if !columnNameRegex.MatchString(r.ColumnName) {
+				return nil, fmt.Errorf("ingest source %s column %s is not a valid column name", src.Name, r.ColumnName)
+			}
+		}
+		rules, err := compileSocketRules(src.RecordPath, src.ExtractRules)
+		if err != nil {
+			return nil, fmt.Errorf("ingest source %s %v", src.Name, err)
+		}
+		i.sources[src.Name] = ingestSource{src: src, token: tokens[src.Name], rules: rules}
+	}
+
+	return i, nil
+}
+
+// LoadTransforms reads the pipeline's transform rules and
+// functions so they are applied to ingested records
+func (i *Ingester) LoadTransforms() (err error) {
+	db, err := sql.Open("postgres", i.DBCreds.GetDBConnectString(i.Pi.Spec.DataSource))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	i.TransformFunctions, err = transform.GetTransformFunctions(db)
+	if err != nil {
+		return err
+	}
+	i.TransformRules, err = transform.GetTransformRules(db)
+	return err
+}
+
+// GetIngestTokens reads the bearer token of each ingest source
+// from its secret in the pipeline namespace
+func GetIngestTokens(pipeline v1alpha1.Pipeline) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, src := range pipeline.Spec.IngestSources {
+		token, err := watch.GetSecretValue(src.TokenSecret, ingestTokenKey)
+		if err != nil {
+			return tokens, fmt.Errorf("could not read token secret of ingest source %s %v", src.Name, err)
+		}
+		tokens[src.Name] = token
+	}
+	return tokens, nil
+}
+
+func (i *Ingester) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, IngestPath)
+	source, ok := i.sources[name]
+	if !ok {
+		http.Error(w, "unknown ingest source", http.StatusNotFound)
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(source.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	if i.underBackPressure(r.Context()) {
+		w.Header().Set("Retry-After", strconv.Itoa(sleepTime))
+		http.Error(w, "loader is under backpressure", http.StatusTooManyRequests)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxIngestBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	columns, records, err := source.parse(mediaType, body)
+	if err == errUnsupportedMedia {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dpId, err := i.load(r.Context(), config.IngestScheme, name, IngestPath+name, source.src.Tablename, columns, records)
+	if err != nil {
+		i.logger.Errorf("error ingesting to %s %s\n", name, err.Error())
+		http.Error(w, "could not load records", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"dataprov": dpId, "records": len(records)})
+}
+
+// underBackPressure reports the loader's last known backpressure,
+// the loader is pinged while it is set so it clears without pushes
+func (i *Ingester) underBackPressure(ctx context.Context) bool {
+	if atomic.LoadInt32(&i.backPressure) == 0 {
+		return false
+	}
+	resp, err := i.loader.Ping(ctx, &pbloader.PingRequest{})
+	if err != nil {
+		return true
+	}
+	atomic.StoreInt32(&i.backPressure, resp.Backpressure)
+	return resp.Backpressure == 1
+}
+
+// waitBackPressure blocks until the loader is no longer under
+// backpressure or ctx is done
+func (i *Ingester) waitBackPressure(ctx context.Context) error {
+	for i.underBackPressure(ctx) {
+		i.logger.Info("ingest sleeping due to backpressure...")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second * time.Duration(sleepTime)):
+		}
+	}
+	return nil
+}
+
+// load registers the request as a dataprov named for the source and
+// pushes its records to the loader, transform rules of scheme run on
+// each record first
+func (i *Ingester) load(ctx context.Context, scheme, name, path, tableName string, columns []string, records [][]string) (string, error) {
+	if !columnNameRegex.MatchString(tableName) {
+		return "", fmt.Errorf("%s is not a valid table name", tableName)
+	}
+
+	for _, record := range records {
+		err := transform.RunRules(scheme, columns, record, i.TransformRules, i.TransformFunctions, i.logger)
+		if err != nil {
+			i.logger.Errorf("error in runrules %s\n", err.Error())
+		}
+	}
+
+	dp := dataprov.DataProvenance{}
+	dp.Name = name
+	dp.Path = path
+	err := i.register(&dp)
+	if err != nil {
+		return "", err
+	}
+
+	types := make([]string, len(columns))
+	for c := range types {
+		types[c] = "TEXT"
+	}
+	key := tableName + ":" + strings.Join(columns, ",")
+	i.mu.Lock()
+	checked := i.checked[key]
+	i.mu.Unlock()
+	if !checked {
+		err = i.tableCheck(tableName, columns, types)
+		if err != nil {
+			return "", err
+		}
+		i.mu.Lock()
+		i.checked[key] = true
+		i.mu.Unlock()
+	}
+
+	jsonStruct := churrodata.JsonPathFormat{}
+	jsonStruct.Path = dp.Path
+	jsonStruct.Dataprov = dp.Id
+	jsonStruct.Tablename = tableName
+	jsonStruct.PipelineName = i.Pi.Name
+	jsonStruct.ColumnNames = columns
+	jsonStruct.ColumnTypes = types
+	jsonStruct.Records = make([]churrodata.JsonPathRow, 0, len(records))
+	for _, r := range records {
+		jsonStruct.Records = append(jsonStruct.Records, churrodata.JsonPathRow{Cols: r})
+	}
+
+	// the loader answers once the records are written so an ack
+	// means the records were loaded and a write error is returned
+	someBytes, _ := json.Marshal(jsonStruct)
+	ctx = metadata.AppendToOutgoingContext(ctx, loader.ConfirmKey, "true")
+	resp, err := i.loader.Push(ctx, &pbloader.PushRequest{DataFormat: config.JSONPathScheme, MessageCompressed: snappy.Encode(nil, someBytes)})
+	if err != nil {
+		return "", err
+	}
+	atomic.StoreInt32(&i.backPressure, resp.Backpressure)
+
+	return dp.Id, nil
+}
+
+var errUnsupportedMedia = fmt.Errorf("content type must be application/json, application/x-ndjson or text/csv")
+
+// parse returns the columns and records of a request body
+func (s ingestSource) parse(mediaType string, body []byte) (columns []string, records [][]string, err error) {
+	switch mediaType {
+	case "application/json":
+		if len(s.src.ExtractRules) == 0 {
+			return nil, nil, fmt.Errorf("ingest source %s has no extract rules for json", s.src.Name)
+		}
+		records, err = s.rules.records(body)
+		return s.columns(), records, err
+	case "application/x-ndjson", "application/ndjson":
+		if len(s.src.ExtractRules) == 0 {
+			return nil, nil, fmt.Errorf("ingest source %s has no extract rules for json", s.src.Name)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 64*1024), maxIngestBody)
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			r, err := s.rules.records(scanner.Bytes())
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d %v", line, err)
+			}
+			records = append(records, r...)
+		}
+		return s.columns(), records, scanner.Err()
+	case "text/csv":
+		reader := csv.NewReader(bytes.NewReader(body))
+		columns, err = reader.Read()
+		if err != nil {
+			return nil, nil, fmt.Errorf("csv header %v", err)
+		}
+		for _, c := range columns {
+			if !columnNameRegex.MatchString(c) {
+				return nil, nil, fmt.Errorf("csv column %s is not a valid column name", c)
+			}
+		}
+		for {
+			r, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			records = append(records, r)
+		}
+		return columns, records, nil
+	}
+	return nil, nil, errUnsupportedMedia
+}
+
+func (s ingestSource) columns() []string {
+	cols := make([]string, 0, len(s.src.ExtractRules))
+	for _, r := range s.src.ExtractRules {
+		cols = append(cols, r.ColumnName)
+	}
+	return cols
+}
@@ -0,0 +1,142 @@
+package extract
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/churrodata"
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
+	"gitlab.com/churro-group/churro/internal/loader"
+	pbloader "gitlab.com/churro-group/churro/rpc/loader"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type fakeLoader struct {
+	pbloader.LoaderClient
+	backpressure int32
+	pushed       []churrodata.JsonPathFormat
+}
+
+func (f *fakeLoader) Ping(ctx context.Context, in *pbloader.PingRequest, opts ...grpc.CallOption) (*pbloader.PingResponse, error) {
+	return &pbloader.PingResponse{Backpressure: f.backpressure}, nil
+}
+
+func (f *fakeLoader) Push(ctx context.Context, in *pbloader.PushRequest, opts ...grpc.CallOption) (*pbloader.PushResponse, error) {
+	// ingested records are acknowledged only once written
+	if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get(loader.ConfirmKey)) == 0 {
+		return nil, fmt.Errorf("push is not confirmed")
+	}
+	b, err := snappy.Decode(nil, in.MessageCompressed)
+	if err != nil {
+		return nil, err
+	}
+	var msg churrodata.JsonPathFormat
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return nil, err
+	}
+	f.pushed = append(f.pushed, msg)
+	return &pbloader.PushResponse{Backpressure: f.backpressure}, nil
+}
+
+func TestIngester(t *testing.T) {
+	pi := v1alpha1.Pipeline{}
+	pi.Name = "pipeline1"
+	pi.Spec.IngestSources = []v1alpha1.IngestSource{{
+		Name:       "orders",
+		Tablename:  "orders",
+		RecordPath: "$.orders[*]",
+		ExtractRules: []v1alpha1.SocketRule{
+			{ColumnName: "id", RuleSource: "$.id"},
+			{ColumnName: "amount", RuleSource: "$.amount"},
+		},
+	}}
+
+	loader := &fakeLoader{}
+	i, err := NewIngester(pi, config.DBCredentials{}, map[string]string{"orders": "secret"}, loader, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.register = func(dp *dataprov.DataProvenance) error {
+		dp.Id = "dp1"
+		return nil
+	}
+	tables := 0
+	i.tableCheck = func(tableName string, columnNames, columnTypes []string) error {
+		tables++
+		return nil
+	}
+
+	post := func(token, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, IngestPath+"orders", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		i.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		contentType string
+		body        string
+		status      int
+		records     int
+	}{
+		{"BadToken", "wrong", "application/json", `{}`, http.StatusUnauthorized, 0},
+		{"JSON", "secret", "application/json", `{"orders":[{"id":"1","amount":5},{"id":"2"}]}`, http.StatusAccepted, 2},
+		{"NDJSON", "secret", "application/x-ndjson", "{\"orders\":[{\"id\":\"3\"}]}\n\n{\"orders\":[{\"id\":\"4\"}]}\n", http.StatusAccepted, 2},
+		{"CSV", "secret", "text/csv; charset=utf-8", "id,amount\n5,10\n6,11\n", http.StatusAccepted, 2},
+		{"BadCSVColumn", "secret", "text/csv", "id,amount; drop table x\n5,10\n", http.StatusBadRequest, 0},
+		{"Unsupported", "secret", "application/xml", "<orders/>", http.StatusUnsupportedMediaType, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pushed := len(loader.pushed)
+			rec := post(tt.token, tt.contentType, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("expected %d, got %d %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.records == 0 {
+				if len(loader.pushed) != pushed {
+					t.Fatal("nothing should have been pushed")
+				}
+				return
+			}
+			msg := loader.pushed[len(loader.pushed)-1]
+			if len(msg.Records) != tt.records || msg.Dataprov != "dp1" {
+				t.Fatalf("unexpected push %+v", msg)
+			}
+		})
+	}
+	if tables != 1 {
+		t.Fatalf("expected the table to be checked once per column set, got %d", tables)
+	}
+
+	t.Run("BackPressure", func(t *testing.T) {
+		loader.backpressure = 1
+		rec := post("secret", "text/csv", "id\n7\n")
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected the push that reports backpressure to succeed, got %d", rec.Code)
+		}
+		rec = post("secret", "text/csv", "id\n8\n")
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("expected 429 with Retry-After, got %d", rec.Code)
+		}
+		loader.backpressure = 0
+		rec = post("secret", "text/csv", "id\n9\n")
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected backpressure to clear, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package extract
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/watch"
+)
+
+var errNoMatch = fmt.Errorf("line does not match")
+
+// lineParser splits the lines of a followed file into columns
+type lineParser struct {
+	columns []string
+	parse   func(line string) ([]string, error)
+}
+
+// newLineParser builds the parser of a tail mode watch directory, a
+// regex parser's columns are its named groups while json and logfmt
+// take theirs from the directory's extract rules
+func newLineParser(dir watch.WatchDirectory) (p lineParser, err error) {
+	err = watch.ValidLineParser(dir)
+	if err != nil {
+		return p, err
+	}
+
+	if dir.LineParser == watch.LineParserRegex {
+		r, _ := regexp.Compile(dir.LinePattern)
+		groups := make([]int, 0)
+		for i, name := range r.SubexpNames() {
+			if name == "" {
+				continue
+			}
+			if !columnNameRegex.MatchString(name) {
+				return p, fmt.Errorf("group %s is not a valid column name", name)
+			}
+			p.columns = append(p.columns, strings.ToLower(name))
+			groups = append(groups, i)
+		}
+		p.parse = func(line string) ([]string, error) {
+			m := r.FindStringSubmatch(line)
+			if m == nil {
+				return nil, errNoMatch
+			}
+			record := make([]string, len(groups))
+			for i, g := range groups {
+				record[i] = m[g]
+			}
+			return record, nil
+		}
+		return p, nil
+	}
+
+	rules := make([]watch.ExtractRule, 0, len(dir.ExtractRules))
+	for _, r := range dir.ExtractRules {
+		rules = append(rules, r)
+	}
+	if len(rules) == 0 {
+		return p, fmt.Errorf("%s line parser needs extract rules", dir.LineParser)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ColumnName < rules[j].ColumnName })
+	for _, r := range rules {
+		if !columnNameRegex.MatchString(r.ColumnName) {
+			return p, fmt.Errorf("%s is not a valid column name", r.ColumnName)
+		}
+		p.columns = append(p.columns, r.ColumnName)
+	}
+
+	switch dir.LineParser {
+	case watch.LineParserJSON:
+		socketRules := make([]v1alpha1.SocketRule, 0, len(rules))
+		for _, r := range rules {
+			socketRules = append(socketRules, v1alpha1.SocketRule{ColumnName: r.ColumnName, RuleSource: r.RuleSource})
+		}
+		compiled, err := compileSocketRules("", socketRules)
+		if err != nil {
+			return p, err
+		}
+		p.parse = func(line string) ([]string, error) {
+			records, err := compiled.records([]byte(line))
+			if err != nil {
+				return nil, err
+			}
+			return records[0], nil
+		}
+	case watch.LineParserLogfmt:
+		// the rule source is the logfmt key, the column name when
+		// it is empty
+		keys := make([]string, 0, len(rules))
+		for _, r := range rules {
+			key := r.RuleSource
+			if key == "" {
+				key = r.ColumnName
+			}
+			keys = append(keys, key)
+		}
+		p.parse = func(line string) ([]string, error) {
+			values := parseLogfmt(line)
+			if len(values) == 0 {
+				return nil, errNoMatch
+			}
+			record := make([]string, len(keys))
+			for i, k := range keys {
+				record[i] = values[k]
+			}
+			return record, nil
+		}
+	}
+	return p, nil
+}
+
+// parseLogfmt parses key=value pairs, values may be double quoted and
+// a key without a value is true
+func parseLogfmt(line string) map[string]string {
+	values := make(map[string]string)
+	i := 0
+	for i < len(line) {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			i++
+			continue
+		}
+		if i >= len(line) || line[i] == ' ' {
+			values[key] = "true"
+			continue
+		}
+
+		// skip the =
+		i++
+		if i < len(line) && line[i] == '"' {
+			var b strings.Builder
+			for i++; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(line[i])
+					}
+					continue
+				}
+				b.WriteByte(line[i])
+			}
+			// skip the closing quote
+			i++
+			values[key] = b.String()
+			continue
+		}
+		start = i
+		for i < len(line) && line[i] != ' ' {
+			i++
+		}
+		values[key] = line[start:i]
+	}
+	return values
+}
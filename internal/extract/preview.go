@@ -0,0 +1,316 @@
+package extract
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohler55/ojg/oj"
+	"go.uber.org/zap"
+	"gopkg.in/xmlpath.v2"
+
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/transform"
+	"gitlab.com/churro-group/churro/internal/watch"
+)
+
+const (
+	DEFAULT_PREVIEW_ROWS = 20
+	MAX_PREVIEW_ROWS     = 1000
+	// MAX_PREVIEW_BYTES bounds the sample sent for a preview, well
+	// under the grpc message limit
+	MAX_PREVIEW_BYTES = 1 << 20
+)
+
+// PreviewHead reads the head of a sample file for a preview, a
+// sample larger than MAX_PREVIEW_BYTES is cut after its last whole
+// line and truncated is set
+func PreviewHead(r io.Reader) (content []byte, truncated bool, err error) {
+	content, err = ioutil.ReadAll(io.LimitReader(r, MAX_PREVIEW_BYTES+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(content) <= MAX_PREVIEW_BYTES {
+		return content, false, nil
+	}
+	content = content[:MAX_PREVIEW_BYTES]
+	if i := bytes.LastIndexByte(content, '\n'); i >= 0 {
+		content = content[:i+1]
+	}
+	return content, true, nil
+}
+
+// PreviewNeedsWholeFile reports whether a watch directory only
+// previews a complete sample, its documents can not be cut into lines
+func PreviewNeedsWholeFile(dir watch.WatchDirectory) bool {
+	return dir.WatchMode != watch.WatchModeTail && dir.Scheme != config.CSVScheme
+}
+
+// Preview is the outcome of a dry run extraction of a sample file
+type Preview struct {
+	Scheme      string   `json:"scheme"`
+	ColumnNames []string `json:"columnnames"`
+	// ColumnTypes are inferred from the transformed values, the
+	// loader still creates TEXT columns
+	ColumnTypes []string     `json:"columntypes"`
+	Rows        []PreviewRow `json:"rows"`
+	// Skipped counts the rows left out by extract rule filters
+	Skipped int `json:"skipped"`
+}
+
+// PreviewRow is one extracted row, Values hold the transformed
+// values and Error why the row could not be extracted or transformed
+type PreviewRow struct {
+	Extracted []string `json:"extracted"`
+	Values    []string `json:"values"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// PreviewExtract extracts the first rows of a sample file of a watch
+// directory in memory and transforms them as the extractor would,
+// nothing is registered in dataprov or written to a database
+func PreviewExtract(dir watch.WatchDirectory, content []byte, maxRows int, rules []transform.TransformRule, functions []transform.TransformFunction, l *zap.SugaredLogger) (p Preview, err error) {
+	if maxRows <= 0 {
+		maxRows = DEFAULT_PREVIEW_ROWS
+	}
+	if maxRows > MAX_PREVIEW_ROWS {
+		maxRows = MAX_PREVIEW_ROWS
+	}
+
+	// the xml and jsonpath rule helpers panic on invalid rules
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid extract rules %v", r)
+		}
+	}()
+
+	p.Scheme = dir.Scheme
+	var records [][]string
+	var rowErrors []error
+	transformScheme := dir.Scheme
+
+	switch {
+	case dir.WatchMode == watch.WatchModeTail:
+		transformScheme = config.TailScheme
+		p.ColumnNames, records, rowErrors, err = previewLines(dir, content, maxRows)
+	case dir.Scheme == config.CSVScheme:
+		p.ColumnNames, records, rowErrors, err = previewCSV(content, maxRows)
+	case dir.Scheme == config.XMLScheme:
+		root, err := xmlpath.Parse(bytes.NewReader(content))
+		if err != nil {
+			return p, err
+		}
+		format := getXMLFormat(getXMLRules([]watch.WatchDirectory{dir}), root)
+		p.ColumnNames = format.ColumnNames
+		for _, r := range format.Records {
+			records = append(records, r.Cols)
+		}
+	case dir.Scheme == config.JSONPathScheme:
+		// the jsonpath extractor does not run transforms
+		transformScheme = ""
+		p.ColumnNames, records, err = previewJSONPath(dir, content)
+	default:
+		return p, fmt.Errorf("preview is not supported for scheme %s", dir.Scheme)
+	}
+	if err != nil {
+		return p, err
+	}
+	if rowErrors == nil {
+		rowErrors = make([]error, len(records))
+	}
+
+	filterRules := make([]watch.ExtractRule, 0)
+	if dir.WatchMode != watch.WatchModeTail {
+		for _, r := range dir.ExtractRules {
+			filterRules = append(filterRules, r)
+		}
+	}
+	filter, err := newRowFilter(p.ColumnNames, filterRules)
+	if err != nil {
+		return p, err
+	}
+
+	p.Rows = make([]PreviewRow, 0)
+	for i, record := range records {
+		if len(p.Rows) >= maxRows {
+			break
+		}
+		row := PreviewRow{Extracted: record}
+		if rowErrors[i] != nil {
+			row.Error = rowErrors[i].Error()
+			p.Rows = append(p.Rows, row)
+			continue
+		}
+		if !filter.keep(record) {
+			p.Skipped++
+			continue
+		}
+		row.Values = make([]string, len(record))
+		copy(row.Values, record)
+		if transformScheme != "" {
+			err := previewTransform(transformScheme, p.ColumnNames, row.Values, rules, functions, l)
+			if err != nil {
+				row.Error = err.Error()
+			}
+		}
+		p.Rows = append(p.Rows, row)
+	}
+
+	p.ColumnTypes = inferColumnTypes(len(p.ColumnNames), p.Rows)
+	return p, nil
+}
+
+// previewCSV reads the header and the rows of a csv sample, more
+// rows than shown are read so that filtered rows can be replaced
+func previewCSV(content []byte, maxRows int) (columns []string, records [][]string, rowErrors []error, err error) {
+	r := csv.NewReader(bytes.NewReader(content))
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not read the csv header %v", err)
+	}
+	for _, h := range header {
+		columns = append(columns, strings.Trim(h, "\t \n"))
+	}
+
+	for len(records) < maxRows*10 {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err == nil && len(record) != len(columns) {
+			err = fmt.Errorf("row has %d columns, the header has %d", len(record), len(columns))
+		}
+		records = append(records, record)
+		rowErrors = append(rowErrors, err)
+	}
+	return columns, records, rowErrors, nil
+}
+
+// previewLines parses the lines of a tail mode sample
+func previewLines(dir watch.WatchDirectory, content []byte, maxRows int) (columns []string, records [][]string, rowErrors []error, err error) {
+	parser, err := newLineParser(dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() && len(records) < maxRows {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		record, err := parser.parse(line)
+		if err != nil {
+			record = []string{line}
+		}
+		records = append(records, record)
+		rowErrors = append(rowErrors, err)
+	}
+	return parser.columns, records, rowErrors, scanner.Err()
+}
+
+// previewJSONPath applies the jsonpath extract rules to a sample
+func previewJSONPath(dir watch.WatchDirectory, content []byte) (columns []string, records [][]string, err error) {
+	obj, err := oj.ParseString(string(content))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not parse the json sample %v", err)
+	}
+
+	columns, _, rules := getRules(dir.Name, []watch.WatchDirectory{dir})
+	allCols := make([][]string, 0, len(rules))
+	rows := 0
+	for _, r := range rules {
+		cols, err := getColumns(obj, r.RuleSource)
+		if err != nil {
+			return nil, nil, fmt.Errorf("extract rule %s %v", r.ColumnName, err)
+		}
+		allCols = append(allCols, cols)
+		rows = len(cols)
+	}
+
+	for row := 0; row < rows; row++ {
+		record := make([]string, 0, len(allCols))
+		for c := range allCols {
+			if row >= len(allCols[c]) {
+				return nil, nil, fmt.Errorf("extract rule %s returned %d values, expected %d", rules[c].ColumnName, len(allCols[c]), rows)
+			}
+			record = append(record, allCols[c][row])
+		}
+		records = append(records, record)
+	}
+	return columns, records, nil
+}
+
+// previewTransform runs the transform rules on a row, a transform
+// function that panics is reported as the row's error
+func previewTransform(scheme string, cols []string, record []string, rules []transform.TransformRule, functions []transform.TransformFunction, l *zap.SugaredLogger) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("transform failed %v", r)
+		}
+	}()
+	return transform.RunRules(scheme, cols, record, rules, functions, l)
+}
+
+// inferColumnTypes picks the narrowest of INT, FLOAT, BOOL, TIMESTAMP
+// and TEXT holding every non empty value of a column
+func inferColumnTypes(columns int, rows []PreviewRow) []string {
+	types := make([]string, columns)
+	for c := range types {
+		candidates := map[string]bool{"INT": true, "FLOAT": true, "BOOL": true, "TIMESTAMP": true}
+		seen := false
+		for _, row := range rows {
+			if row.Error != "" || c >= len(row.Values) {
+				continue
+			}
+			v := strings.TrimSpace(row.Values[c])
+			if v == "" {
+				continue
+			}
+			seen = true
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				candidates["INT"] = false
+			}
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				candidates["FLOAT"] = false
+			}
+			if _, err := strconv.ParseBool(v); err != nil {
+				candidates["BOOL"] = false
+			}
+			if !isTimestamp(v) {
+				candidates["TIMESTAMP"] = false
+			}
+		}
+
+		types[c] = "TEXT"
+		if !seen {
+			continue
+		}
+		for _, t := range []string{"INT", "FLOAT", "BOOL", "TIMESTAMP"} {
+			if candidates[t] {
+				types[c] = t
+				break
+			}
+		}
+	}
+	return types
+}
+
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+func isTimestamp(v string) bool {
+	for _, layout := range timestampLayouts {
+		if _, err := time.Parse(layout, v); err == nil {
+			return true
+		}
+	}
+	return false
+}
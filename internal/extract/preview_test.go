@@ -0,0 +1,117 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/transform"
+	"gitlab.com/churro-group/churro/internal/watch"
+)
+
+func TestPreviewExtract(t *testing.T) {
+	functions := []transform.TransformFunction{
+		{Name: "upper", Source: "import \"strings\"\nfunc Upper(s string) string { return strings.ToUpper(s) }"},
+		{Name: "broken", Source: "func Broken(s string) string { var m map[string]string; m[s] = s; return s }"},
+	}
+	rules := []transform.TransformRule{
+		{Name: "upper", Path: "state", Scheme: config.CSVScheme, TransformFunctionName: "Upper"},
+		{Name: "broken", Path: "note", Scheme: config.CSVScheme, TransformFunctionName: "Broken"},
+	}
+	l := zap.NewNop().Sugar()
+
+	t.Run("CSV", func(t *testing.T) {
+		dir := watch.WatchDirectory{Name: "orders", Scheme: config.CSVScheme, ExtractRules: map[string]watch.ExtractRule{
+			"1": {ColumnName: "amount", MatchValues: ">=10"},
+		}}
+		sample := "state,amount,placed\nny,12,2020-06-01\nca,5,2020-06-02\ntx,10.5\nwa,30,2020-06-03\nor,40,2020-06-04\n"
+		p, err := PreviewExtract(dir, []byte(sample), 2, rules[:1], functions, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(p.ColumnNames, ",") != "state,amount,placed" || strings.Join(p.ColumnTypes, ",") != "TEXT,INT,TIMESTAMP" {
+			t.Errorf("unexpected columns %v %v", p.ColumnNames, p.ColumnTypes)
+		}
+		if len(p.Rows) != 2 || p.Skipped != 1 {
+			t.Fatalf("unexpected rows %+v skipped %d", p.Rows, p.Skipped)
+		}
+		if p.Rows[0].Values[0] != "NY" || p.Rows[0].Extracted[0] != "ny" || p.Rows[0].Error != "" {
+			t.Errorf("unexpected first row %+v", p.Rows[0])
+		}
+		if p.Rows[1].Error == "" {
+			t.Errorf("expected a short row to fail %+v", p.Rows[1])
+		}
+	})
+
+	t.Run("TransformError", func(t *testing.T) {
+		dir := watch.WatchDirectory{Name: "notes", Scheme: config.CSVScheme}
+		p, err := PreviewExtract(dir, []byte("note\nhello\n"), 0, rules, functions, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Rows) != 1 || p.Rows[0].Error == "" {
+			t.Errorf("expected the transform to fail %+v", p.Rows)
+		}
+	})
+
+	t.Run("XML", func(t *testing.T) {
+		dir := watch.WatchDirectory{Name: "people", Scheme: config.XMLScheme, ExtractRules: map[string]watch.ExtractRule{
+			"1": {ColumnName: "name", RuleSource: "/people/person/name"},
+		}}
+		p, err := PreviewExtract(dir, []byte("<people><person><name>ann</name></person><person><name>bob</name></person></people>"), 0, nil, nil, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Rows) != 2 || p.Rows[1].Values[0] != "bob" || p.ColumnTypes[0] != "TEXT" {
+			t.Errorf("unexpected preview %+v", p)
+		}
+	})
+
+	t.Run("JSONPath", func(t *testing.T) {
+		dir := watch.WatchDirectory{Name: "flags", Scheme: config.JSONPathScheme, ExtractRules: map[string]watch.ExtractRule{
+			"1": {ColumnName: "flag", RuleSource: "$.items[*].flag", MatchValues: "true"},
+		}}
+		p, err := PreviewExtract(dir, []byte(`{"items":[{"flag":"true"},{"flag":"false"},{"flag":"true"}]}`), 0, nil, nil, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Rows) != 2 || p.Skipped != 1 || p.ColumnTypes[0] != "BOOL" {
+			t.Errorf("unexpected preview %+v", p)
+		}
+	})
+
+	t.Run("Tail", func(t *testing.T) {
+		dir := watch.WatchDirectory{Name: "access", Scheme: config.CSVScheme, WatchMode: watch.WatchModeTail, LineParser: watch.LineParserRegex, LinePattern: `^(?P<status>\d+) (?P<path>\S+)$`}
+		p, err := PreviewExtract(dir, []byte("200 /a\nnot a request\n404 /b\n"), 0, nil, nil, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Rows) != 3 || p.Rows[1].Error == "" || p.Rows[2].Values[1] != "/b" || p.ColumnTypes[0] != "INT" {
+			t.Errorf("unexpected preview %+v", p)
+		}
+	})
+
+	if _, err := PreviewExtract(watch.WatchDirectory{Scheme: config.XLSXScheme}, []byte("x"), 0, nil, nil, l); err == nil {
+		t.Error("expected an unsupported scheme to fail")
+	}
+}
+
+func TestPreviewHead(t *testing.T) {
+	small := "a,b\n1,2\n"
+	content, truncated, err := PreviewHead(strings.NewReader(small))
+	if err != nil || truncated || string(content) != small {
+		t.Errorf("unexpected head %q %t %v", content, truncated, err)
+	}
+
+	line := strings.Repeat("x", 99) + "\n"
+	large := strings.Repeat(line, MAX_PREVIEW_BYTES/len(line)+10)
+	content, truncated, err = PreviewHead(strings.NewReader(large))
+	if err != nil || !truncated {
+		t.Fatalf("expected a truncated head %t %v", truncated, err)
+	}
+	if len(content) > MAX_PREVIEW_BYTES || len(content)%len(line) != 0 {
+		t.Errorf("head of %d bytes is not cut after a whole line", len(content))
+	}
+}
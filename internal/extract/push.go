@@ -4,30 +4,39 @@ import (
 	"context"
 	"fmt"
 	"go.uber.org/zap"
+	"sync/atomic"
 
 	"github.com/golang/snappy"
+	"gitlab.com/churro-group/churro/internal/loader"
 	pb "gitlab.com/churro-group/churro/rpc/loader"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
-	"os"
+	"google.golang.org/grpc/metadata"
+	"time"
 )
 
 const (
 	RecordsPerPush = 10
+
+	// FileRecordsPerPush is the batch size of the file extractors,
+	// each of their pushes waits for the loader to commit it so a
+	// batch has to be large for the round trip to be worth it
+	FileRecordsPerPush = 500
+
+	// pushDrainTimeout bounds pushing the messages still queued
+	// once an extraction stops
+	pushDrainTimeout = 10 * time.Second
 )
 
 func (s *Server) pushToLoader(ctx context.Context, scheme string) {
 
-	url := fmt.Sprintf("%s:%d", s.Pi.Spec.LoaderConfig.Location.Host, s.Pi.Spec.LoaderConfig.Location.Port)
-	s.logger.Debug("loader target url", zap.String("url", url))
-
 	creds, err := credentials.NewClientTLSFromFile(s.ServiceCreds.ServiceCrt, "")
 	if err != nil {
 		s.logger.Error("could not process the credentials", zap.Error(err))
-		os.Exit(1)
+		return
 	}
 
-	conn, err := grpc.Dial(url, grpc.WithTransportCredentials(creds))
+	conn, err := s.dialLoader(creds)
 	if err != nil {
 		s.logger.Error("did not connect:", zap.Error(err))
 		return
@@ -35,27 +44,117 @@ func (s *Server) pushToLoader(ctx context.Context, scheme string) {
 	defer conn.Close()
 	loaderclient := pb.NewLoaderClient(conn)
 
+	push := func(ctx context.Context, elem loader.LoaderMessage) {
+		s.logger.Debug("extract pushing to loader")
+		err := s.waitForLoader(ctx, loaderclient)
+		if err != nil {
+			s.logger.Error("error waiting for the loader", zap.Error(err))
+			return
+		}
+		encoded := snappy.Encode(nil, elem.Metadata)
+		pushResponse, err := loaderclient.Push(ctx, &pb.PushRequest{DataFormat: scheme, MessageCompressed: encoded})
+		if err != nil {
+			s.logger.Error("error in push", zap.Error(err))
+			return
+		}
+		s.logger.Debug("pushResponse ", zap.Int32("backpressure", pushResponse.Backpressure))
+		atomic.StoreInt32(&backPressure, pushResponse.Backpressure)
+	}
+
 	for {
 		select {
 		case elem := <-s.Queue:
-			s.logger.Debug("extract pushing to loader")
-			encoded := snappy.Encode(nil, elem.Metadata)
-			pushResponse, err := loaderclient.Push(ctx, &pb.PushRequest{DataFormat: scheme, MessageCompressed: encoded})
-			if err != nil {
-				s.logger.Error("error in push", zap.Error(err))
-			} else {
-				s.logger.Debug("pushResponse ", zap.Int32("backpressure", pushResponse.Backpressure))
-				if pushResponse.Backpressure == 1 {
-					backPressure = 1
-				} else {
-					backPressure = 0
-				}
-			}
+			push(ctx, elem)
 		case <-ctx.Done():
 			s.logger.Info("done received in pushToLoader")
-			return
+			// push what was queued before the extraction stopped
+			drainCtx, cancel := context.WithTimeout(context.Background(), pushDrainTimeout)
+			defer cancel()
+			for {
+				select {
+				case elem := <-s.Queue:
+					push(drainCtx, elem)
+				default:
+					return
+				}
+			}
+		}
+	}
+
+}
+
+// startPushing pushes queued messages to the loader until the
+// returned stop is called, messages queued before stop are still
+// pushed so an extraction can flush its last records on the way out
+func (s *Server) startPushing(scheme string) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.pushToLoader(ctx, scheme)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
 
+// waitForLoader sleeps while the loader reports backpressure, the
+// loader is pinged after each sleep since only a response clears
+// the backpressure flag
+func (s *Server) waitForLoader(ctx context.Context, loaderclient pb.LoaderClient) error {
+	for atomic.LoadInt32(&backPressure) == 1 {
+		s.logger.Info("sleeping due to backpressure...")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second * time.Duration(sleepTime)):
+		}
+		resp, err := loaderclient.Ping(ctx, &pb.PingRequest{})
+		if err != nil {
+			return err
 		}
+		atomic.StoreInt32(&backPressure, resp.Backpressure)
+	}
+	return nil
+}
+
+// dialLoader connects to the pipeline loader
+func (s *Server) dialLoader(creds credentials.TransportCredentials) (*grpc.ClientConn, error) {
+	url := fmt.Sprintf("%s:%d", s.Pi.Spec.LoaderConfig.Location.Host, s.Pi.Spec.LoaderConfig.Location.Port)
+	s.logger.Debug("loader target url", zap.String("url", url))
+	return grpc.Dial(url, grpc.WithTransportCredentials(creds))
+}
+
+// dialLoaderClient connects to the loader for pushConfirmed, the
+// caller closes the connection
+func (s *Server) dialLoaderClient() (*grpc.ClientConn, pb.LoaderClient, error) {
+	creds, err := credentials.NewClientTLSFromFile(s.ServiceCreds.ServiceCrt, "")
+	if err != nil {
+		return nil, nil, err
 	}
+	conn, err := s.dialLoader(creds)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, pb.NewLoaderClient(conn), nil
+}
 
+// pushConfirmed sends a message to the loader and waits for the
+// loader to write it to the database, unlike pushToLoader the caller
+// learns of a failure and may record its progress once it returns
+func (s *Server) pushConfirmed(ctx context.Context, loaderclient pb.LoaderClient, msg loader.LoaderMessage) error {
+	err := s.waitForLoader(ctx, loaderclient)
+	if err != nil {
+		return err
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, loader.ConfirmKey, "true")
+	encoded := snappy.Encode(nil, msg.Metadata)
+	pushResponse, err := loaderclient.Push(ctx, &pb.PushRequest{DataFormat: msg.DataFormat, MessageCompressed: encoded})
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&backPressure, pushResponse.Backpressure)
+	return nil
 }
@@ -0,0 +1,66 @@
+package extract
+
+import (
+	"fmt"
+
+	"gitlab.com/churro-group/churro/internal/watch"
+)
+
+// rowFilter skips the extracted rows whose values fail the
+// MatchValues of their column's extract rule
+type rowFilter struct {
+	columns  []int
+	matchers []watch.ValueMatcher
+}
+
+// newRowFilter compiles the MatchValues of rules against the
+// extracted columns, a rule naming a column that is not extracted
+// is an error since it could never match
+func newRowFilter(columnNames []string, rules []watch.ExtractRule) (f rowFilter, err error) {
+	for _, r := range rules {
+		m, err := watch.CompileMatchValues(r.MatchValues)
+		if err != nil {
+			return f, fmt.Errorf("extract rule %s %v", r.ColumnName, err)
+		}
+		if m == nil {
+			continue
+		}
+		col := -1
+		for i, name := range columnNames {
+			if name == r.ColumnName {
+				col = i
+				break
+			}
+		}
+		if col < 0 {
+			return f, fmt.Errorf("extract rule %s filters a column that is not extracted", r.ColumnName)
+		}
+		f.columns = append(f.columns, col)
+		f.matchers = append(f.matchers, m)
+	}
+	return f, nil
+}
+
+// keep reports whether a row passes every filter
+func (f rowFilter) keep(record []string) bool {
+	for i, col := range f.columns {
+		if col >= len(record) || !f.matchers[i](record[col]) {
+			return false
+		}
+	}
+	return true
+}
+
+// watchDirRules returns the extract rules of the watch directory
+// being extracted
+func (s *Server) watchDirRules() []watch.ExtractRule {
+	rules := make([]watch.ExtractRule, 0)
+	for _, d := range s.WatchDirectory {
+		if d.Name == s.WatchDirName {
+			for _, r := range d.ExtractRules {
+				rules = append(rules, r)
+			}
+		}
+	}
+	return rules
+}
@@ -0,0 +1,42 @@
+package extract
+
+import (
+	"testing"
+
+	"gitlab.com/churro-group/churro/internal/watch"
+)
+
+func TestRowFilter(t *testing.T) {
+	columns := []string{"state", "amount", "note"}
+	rules := []watch.ExtractRule{
+		{ColumnName: "state", MatchValues: "NY,CA"},
+		{ColumnName: "amount", MatchValues: ">100"},
+		{ColumnName: "note"},
+	}
+	f, err := newRowFilter(columns, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		record []string
+		keep   bool
+	}{
+		{[]string{"NY", "150", ""}, true},
+		{[]string{"CA", "100", ""}, false},
+		{[]string{"WA", "500", ""}, false},
+		{[]string{"NY"}, false},
+	}
+	for _, tt := range tests {
+		if got := f.keep(tt.record); got != tt.keep {
+			t.Errorf("keep %v = %t", tt.record, got)
+		}
+	}
+
+	if _, err := newRowFilter(columns, []watch.ExtractRule{{ColumnName: "zip", MatchValues: "10001"}}); err == nil {
+		t.Error("expected a filter on a missing column to fail")
+	}
+	if _, err := newRowFilter(columns, []watch.ExtractRule{{ColumnName: "state", MatchValues: "~("}}); err == nil {
+		t.Error("expected an invalid regex to fail")
+	}
+}
@@ -0,0 +1,452 @@
+package extract
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/config"
+)
+
+const (
+	DEFAULT_METRICS_PORT = ":2112"
+
+	// syslogQueueSize bounds the parsed messages waiting for a batch,
+	// udp messages are dropped while it is full
+	syslogQueueSize = 10000
+
+	syslogBatchSize     = 500
+	syslogFlushInterval = time.Second
+
+	// syslogMaxMessage bounds a single message
+	syslogMaxMessage = 64 * 1024
+
+	// reasons a message is dropped
+	dropQueueFull = "queue_full"
+	dropOversize  = "oversize"
+	dropLoadError = "load_error"
+)
+
+var syslogColumns = []string{"facility", "severity", "timestamp", "hostname", "appname", "procid", "msgid", "structureddata", "message"}
+
+var syslogFacilities = []string{"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron", "local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"}
+
+var syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+var syslogReceivedMetric = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "churro_syslog_received_messages_total",
+	Help: "the total number of syslog messages received",
+}, []string{"pipeline", "source"})
+
+var syslogDroppedMetric = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "churro_syslog_dropped_messages_total",
+	Help: "the total number of syslog messages dropped before loading",
+}, []string{"pipeline", "source", "reason"})
+
+// SyslogListener receives the messages of a syslog source over UDP,
+// TCP and optionally TLS, parses them into columns and loads them in
+// batches through an Ingester
+type SyslogListener struct {
+	logger   *zap.SugaredLogger
+	src      v1alpha1.SyslogSource
+	ingester *Ingester
+	svcCreds config.ServiceCredentials
+	queue    chan []string
+}
+
+// NewSyslogListener creates a listener for a syslog source
+func NewSyslogListener(src v1alpha1.SyslogSource, ingester *Ingester, svcCreds config.ServiceCredentials, l *zap.SugaredLogger) (*SyslogListener, error) {
+	if !columnNameRegex.MatchString(src.Tablename) {
+		return nil, fmt.Errorf("syslog source %s table %s is not a valid table name", src.Name, src.Tablename)
+	}
+	if src.Port <= 0 {
+		return nil, fmt.Errorf("syslog source %s needs a port", src.Name)
+	}
+	return &SyslogListener{
+		logger:   l,
+		src:      src,
+		ingester: ingester,
+		svcCreds: svcCreds,
+		queue:    make(chan []string, syslogQueueSize),
+	}, nil
+}
+
+// Serve listens until ctx is cancelled or a listener fails
+func (s *SyslogListener) Serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	addr := fmt.Sprintf(":%d", s.src.Port)
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer udp.Close()
+
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer tcp.Close()
+
+	listeners := []net.Listener{tcp}
+	if s.src.TLSPort > 0 {
+		cert, err := tls.LoadX509KeyPair(s.svcCreds.ServiceCrt, s.svcCreds.ServiceKey)
+		if err != nil {
+			return fmt.Errorf("could not process the credentials %v", err)
+		}
+		l, err := tls.Listen("tcp", fmt.Sprintf(":%d", s.src.TLSPort), &tls.Config{Certificates: []tls.Certificate{cert}})
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		listeners = append(listeners, l)
+	}
+
+	return s.serve(ctx, udp, listeners...)
+}
+
+func (s *SyslogListener) serve(ctx context.Context, udp net.PacketConn, listeners ...net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.batch(ctx)
+	}()
+
+	errs := make(chan error, len(listeners)+1)
+	go func() {
+		errs <- s.readPackets(ctx, udp)
+	}()
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errs <- s.accept(ctx, l)
+		}(l)
+	}
+
+	// unblock the reads when the listener is stopped
+	go func() {
+		<-ctx.Done()
+		udp.Close()
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-errs:
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}
+	cancel()
+	wg.Wait()
+	return err
+}
+
+func (s *SyslogListener) readPackets(ctx context.Context, conn net.PacketConn) error {
+	buf := make([]byte, syslogMaxMessage)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		msg := bytes.TrimRight(buf[:n], "\r\n\x00")
+		if len(msg) == 0 {
+			continue
+		}
+		s.enqueue(ctx, parseSyslog(msg, time.Now()), false)
+	}
+}
+
+func (s *SyslogListener) accept(ctx context.Context, l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			err := s.readStream(ctx, conn)
+			if err != nil && err != io.EOF && ctx.Err() == nil {
+				s.logger.Errorf("error reading syslog from %s %s\n", conn.RemoteAddr(), err.Error())
+			}
+		}()
+	}
+}
+
+// readStream reads the messages of a connection, the sender's writes
+// block while the queue is full
+func (s *SyslogListener) readStream(ctx context.Context, conn io.Reader) error {
+	r := bufio.NewReaderSize(conn, syslogMaxMessage)
+	for {
+		msg, err := readSyslogFrame(r)
+		if err == errSyslogOversize {
+			syslogDroppedMetric.WithLabelValues(s.ingester.Pi.Name, s.src.Name, dropOversize).Inc()
+		}
+		if err != nil {
+			return err
+		}
+		if len(msg) == 0 {
+			continue
+		}
+		if !s.enqueue(ctx, parseSyslog(msg, time.Now()), true) {
+			return ctx.Err()
+		}
+	}
+}
+
+// enqueue queues a parsed message for the next batch, when wait is
+// false a message that does not fit is dropped
+func (s *SyslogListener) enqueue(ctx context.Context, record []string, wait bool) bool {
+	syslogReceivedMetric.WithLabelValues(s.ingester.Pi.Name, s.src.Name).Inc()
+	if wait {
+		select {
+		case s.queue <- record:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	select {
+	case s.queue <- record:
+		return true
+	default:
+		syslogDroppedMetric.WithLabelValues(s.ingester.Pi.Name, s.src.Name, dropQueueFull).Inc()
+		return false
+	}
+}
+
+// batch loads the queued messages once a batch fills or on the flush
+// interval, it waits out loader backpressure before each load
+func (s *SyslogListener) batch(ctx context.Context) {
+	ticker := time.NewTicker(syslogFlushInterval)
+	defer ticker.Stop()
+
+	records := make([][]string, 0, syslogBatchSize)
+	flush := func(ctx context.Context) {
+		if len(records) == 0 {
+			return
+		}
+		err := s.ingester.waitBackPressure(ctx)
+		if err == nil {
+			_, err = s.ingester.load(ctx, config.SyslogScheme, s.src.Name, "syslog/"+s.src.Name, s.src.Tablename, syslogColumns, records)
+		}
+		if err != nil {
+			s.logger.Errorf("error loading syslog source %s %s\n", s.src.Name, err.Error())
+			syslogDroppedMetric.WithLabelValues(s.ingester.Pi.Name, s.src.Name, dropLoadError).Add(float64(len(records)))
+		}
+		records = make([][]string, 0, syslogBatchSize)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// load what was already received before stopping
+			for {
+				select {
+				case r := <-s.queue:
+					records = append(records, r)
+					continue
+				default:
+				}
+				break
+			}
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			flush(flushCtx)
+			cancel()
+			return
+		case r := <-s.queue:
+			records = append(records, r)
+			if len(records) >= syslogBatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+var errSyslogOversize = fmt.Errorf("syslog message is larger than %d bytes", syslogMaxMessage)
+
+// readSyslogFrame reads one message of a stream, framed either by an
+// octet count or by a trailing newline as described in RFC 6587
+func readSyslogFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '0' && first[0] <= '9' {
+		count, err := r.ReadString(' ')
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(count, " "))
+		if err != nil {
+			return nil, fmt.Errorf("invalid octet count %s", count)
+		}
+		if n > syslogMaxMessage {
+			return nil, errSyslogOversize
+		}
+		msg := make([]byte, n)
+		_, err = io.ReadFull(r, msg)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(msg, "\r\n\x00"), nil
+	}
+
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, errSyslogOversize
+	}
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n\x00"), nil
+}
+
+// parseSyslog parses an RFC 5424 or RFC 3164 message into the syslog
+// columns, text that does not parse is kept whole as the message
+func parseSyslog(msg []byte, received time.Time) []string {
+	record := make([]string, len(syslogColumns))
+	rest := string(msg)
+
+	// a message without a priority is user.notice
+	pri := 13
+	if strings.HasPrefix(rest, "<") {
+		if end := strings.IndexByte(rest, '>'); end > 1 && end <= 4 {
+			if p, err := strconv.Atoi(rest[1:end]); err == nil && p < len(syslogFacilities)*8 {
+				pri = p
+				rest = rest[end+1:]
+			}
+		}
+	}
+	record[0] = syslogFacilities[pri/8]
+	record[1] = syslogSeverities[pri%8]
+	record[2] = received.UTC().Format(time.RFC3339Nano)
+
+	if strings.HasPrefix(rest, "1 ") {
+		if parseRFC5424(rest[2:], record) {
+			return record
+		}
+	}
+	parseRFC3164(rest, received, record)
+	return record
+}
+
+// parseRFC5424 parses the fields after the version
+func parseRFC5424(rest string, record []string) bool {
+	fields := strings.SplitN(rest, " ", 6)
+	if len(fields) < 5 {
+		return false
+	}
+	header := make([]string, 5)
+	for i, f := range fields[:5] {
+		if f != "-" {
+			header[i] = f
+		}
+	}
+	if header[0] != "" {
+		record[2] = header[0]
+	}
+	record[3] = header[1]
+	record[4] = header[2]
+	record[5] = header[3]
+	record[6] = header[4]
+
+	if len(fields) < 6 {
+		return true
+	}
+	rest = fields[5]
+
+	sd, msg := splitStructuredData(rest)
+	if sd != "-" {
+		record[7] = sd
+	}
+	record[8] = strings.TrimPrefix(msg, "\ufeff")
+	return true
+}
+
+// splitStructuredData splits the structured data elements from the
+// message that follows them
+func splitStructuredData(rest string) (sd, msg string) {
+	if strings.HasPrefix(rest, "-") {
+		return "-", strings.TrimPrefix(rest[1:], " ")
+	}
+
+	i := 0
+	for i < len(rest) && rest[i] == '[' {
+		inQuote := false
+		for i++; i < len(rest); i++ {
+			c := rest[i]
+			if c == '\\' {
+				i++
+				continue
+			}
+			if c == '"' {
+				inQuote = !inQuote
+			}
+			if c == ']' && !inQuote {
+				i++
+				break
+			}
+		}
+	}
+	if i == 0 {
+		return "", rest
+	}
+	return rest[:i], strings.TrimPrefix(rest[i:], " ")
+}
+
+// parseRFC3164 parses the BSD timestamp, hostname and tag
+func parseRFC3164(rest string, received time.Time, record []string) {
+	const stampLen = len(time.Stamp)
+	if len(rest) > stampLen && rest[stampLen] == ' ' {
+		if t, err := time.Parse(time.Stamp, rest[:stampLen]); err == nil {
+			t = t.AddDate(received.UTC().Year(), 0, 0)
+			// a message from late december arriving in january
+			if t.After(received.UTC().AddDate(0, 1, 0)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			record[2] = t.Format(time.RFC3339Nano)
+			rest = rest[stampLen+1:]
+
+			if sp := strings.IndexByte(rest, ' '); sp > 0 {
+				record[3] = rest[:sp]
+				rest = rest[sp+1:]
+			}
+		}
+	}
+
+	if colon := strings.Index(rest, ": "); colon > 0 && !strings.ContainsAny(rest[:colon], " ") {
+		tag := rest[:colon]
+		if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+			record[5] = tag[open+1 : len(tag)-1]
+			tag = tag[:open]
+		}
+		record[4] = tag
+		rest = rest[colon+2:]
+	}
+	record[8] = rest
+}
@@ -0,0 +1,140 @@
+package extract
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
+	"go.uber.org/zap"
+)
+
+func TestParseSyslog(t *testing.T) {
+	received := time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		msg  string
+		want []string
+	}{
+		{"RFC5424", `<165>1 2003-10-11T22:14:15.003Z host1 evntslog - ID47 [exampleSDID@32473 iut="3" eventID="1011"] An application event`,
+			[]string{"local4", "notice", "2003-10-11T22:14:15.003Z", "host1", "evntslog", "", "ID47", `[exampleSDID@32473 iut="3" eventID="1011"]`, "An application event"}},
+		{"RFC5424NoSD", `<34>1 2003-10-11T22:14:15.003Z host2 su 42 - - 'su root' failed`,
+			[]string{"auth", "crit", "2003-10-11T22:14:15.003Z", "host2", "su", "42", "", "", "'su root' failed"}},
+		{"RFC3164", `<13>Dec 31 23:59:59 router1 sshd[311]: session opened`,
+			[]string{"user", "notice", "2020-12-31T23:59:59Z", "router1", "sshd", "311", "", "", "session opened"}},
+		{"NoPriority", `plain text`,
+			[]string{"user", "notice", "2021-01-02T00:00:00Z", "", "", "", "", "", "plain text"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseSyslog([]byte(tt.msg), received)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("9 <13>first<13>second\n<13>third"))
+	for _, want := range []string{"<13>first", "<13>second", "<13>third"} {
+		msg, err := readSyslogFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(msg) != want {
+			t.Errorf("got %q want %q", msg, want)
+		}
+	}
+	if _, err := readSyslogFrame(r); err == nil {
+		t.Error("expected the end of the stream")
+	}
+
+	r = bufio.NewReader(strings.NewReader("99999999 <13>x"))
+	if _, err := readSyslogFrame(r); err != errSyslogOversize {
+		t.Errorf("expected an oversize error, got %v", err)
+	}
+}
+
+func TestSyslogListener(t *testing.T) {
+	pi := v1alpha1.Pipeline{}
+	pi.Name = "pipeline1"
+	loader := &fakeLoader{}
+	i, err := NewIngester(pi, config.DBCredentials{}, nil, loader, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.register = func(dp *dataprov.DataProvenance) error {
+		dp.Id = "dp1"
+		return nil
+	}
+	i.tableCheck = func(tableName string, columnNames, columnTypes []string) error {
+		return nil
+	}
+
+	l, err := NewSyslogListener(v1alpha1.SyslogSource{Name: "lab", Port: 5514, Tablename: "lab"}, i, config.ServiceCredentials{}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.serve(ctx, udp, tcp)
+	}()
+
+	u, err := net.Dial("udp", udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Write([]byte("<14>1 - host1 app - - - over udp"))
+	u.Close()
+
+	c, err := net.Dial("tcp", tcp.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Write([]byte("<14>Jan  1 00:00:00 host2 app: over tcp\n"))
+	c.Close()
+
+	// wait for both messages to be received, then stop so they
+	// are flushed
+	received := syslogReceivedMetric.WithLabelValues("pipeline1", "lab")
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(received) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	var messages []string
+	for _, p := range loader.pushed {
+		if p.Tablename != "lab" {
+			t.Errorf("unexpected table %s", p.Tablename)
+		}
+		for _, r := range p.Records {
+			messages = append(messages, r.Cols[8])
+		}
+	}
+	got := strings.Join(messages, ",")
+	if got != "over udp,over tcp" && got != "over tcp,over udp" {
+		t.Errorf("unexpected messages %q", messages)
+	}
+}
@@ -3,12 +3,16 @@ package extract
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/internal/churrodata"
 )
 
-// create the table based on column names and column types
+// create the table based on column names and column types, the
+// load mode of the watch directory decides the table's primary key
 func (s Server) tableCheck(columnNames, columnTypes []string) (err error) {
 
 	userid := s.Pi.Spec.DataSource.Username
@@ -24,7 +28,26 @@ func (s Server) tableCheck(columnNames, columnTypes []string) (err error) {
 	}
 	defer db.Close()
 
+	load := s.watchDirLoad()
+	for _, k := range load.KeyColumns {
+		if !hasColumn(columnNames, k) {
+			return fmt.Errorf("key column %s is not a column of %s", k, tableName)
+		}
+	}
+	keys := strings.Join(load.KeyColumns, ", ")
+
+	privs := "insert,select"
 	sqlStr := fmt.Sprintf("CREATE TABLE if not exists %s.%s ( id serial PRIMARY KEY, dataformat text, %s createdtime TIMESTAMP);", dbname, tableName, getTableColumns(columnNames, columnTypes))
+	switch load.LoadMode {
+	case churrodata.LoadUpsert:
+		// rows are upserted on the declared key
+		privs = "insert,select,update"
+		sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.%s ( dataformat text, %s createdtime TIMESTAMP, PRIMARY KEY (%s));", dbname, tableName, getTableColumns(columnNames, columnTypes), keys)
+	case churrodata.LoadReplacePartition:
+		// rows record their file so a later file replaces them
+		privs = "insert,select,delete"
+		sqlStr = fmt.Sprintf("CREATE TABLE if not exists %s.%s ( id serial PRIMARY KEY, dataformat text, %s dataprov STRING, createdtime TIMESTAMP);", dbname, tableName, getTableColumns(columnNames, columnTypes))
+	}
 	s.logger.Info(sqlStr)
 
 	var stmt *sql.Stmt
@@ -39,9 +62,31 @@ func (s Server) tableCheck(columnNames, columnTypes []string) (err error) {
 
 	s.logger.Debug("Table created successfully..", zap.String("table", tableName))
 
+	// a table created before its watch directory's load mode was
+	// set gets what the mode needs added
+	switch load.LoadMode {
+	case churrodata.LoadUpsert:
+		sqlStr = fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s_key_idx ON %s.%s (%s);", tableName, dbname, tableName, keys)
+		_, err = db.Exec(sqlStr)
+		if err != nil {
+			return fmt.Errorf("could not key %s on %s: %v", tableName, keys, err)
+		}
+	case churrodata.LoadReplacePartition:
+		sqlStr = fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN IF NOT EXISTS dataprov STRING;", dbname, tableName)
+		_, err = db.Exec(sqlStr)
+		if err != nil {
+			return err
+		}
+		sqlStr = fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_partition_idx ON %s.%s (%s);", tableName, dbname, tableName, keys)
+		_, err = db.Exec(sqlStr)
+		if err != nil {
+			return err
+		}
+	}
+
 	// grant privs to pipeline database user
 	// grant insert,select on foo.churro,foo.dataprov to foo
-	sqlStr = fmt.Sprintf("grant insert,select on %s.%s to %s;", dbname, tableName, userid)
+	sqlStr = fmt.Sprintf("grant %s on %s.%s to %s;", privs, dbname, tableName, userid)
 	stmt, err = db.Prepare(sqlStr)
 	if err != nil {
 		return err
@@ -55,6 +100,26 @@ func (s Server) tableCheck(columnNames, columnTypes []string) (err error) {
 	return nil
 }
 
+// watchDirLoad returns how rows are loaded into the table of the
+// watch directory being extracted, sources without one append
+func (s Server) watchDirLoad() churrodata.Load {
+	for _, d := range s.WatchDirectory {
+		if d.Name == s.WatchDirName {
+			return d.Load()
+		}
+	}
+	return churrodata.Load{LoadMode: churrodata.LoadAppend}
+}
+
+func hasColumn(columnNames []string, name string) bool {
+	for _, c := range columnNames {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
 func getTableColumns(columnNames, columnTypes []string) string {
 	var result string
 	for i, v := range columnNames {
@@ -63,3 +128,23 @@ func getTableColumns(columnNames, columnTypes []string) string {
 	}
 	return result
 }
+
+// grantDelete lets the pipeline database user delete from the table,
+// which sources that replace rows need
+func (s Server) grantDelete() error {
+	url := s.DBCreds.GetDBConnectString(s.Pi.Spec.DataSource)
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return fmt.Errorf("error connecting to the database: %v", err)
+	}
+	defer db.Close()
+
+	sqlStr := fmt.Sprintf("grant delete on %s.%s to %s;", s.Pi.Spec.DataSource.Database, s.TableName, s.Pi.Spec.DataSource.Username)
+	_, err = db.Exec(sqlStr)
+	if err != nil {
+		return err
+	}
+	s.logger.Debug(sqlStr)
+	return nil
+}
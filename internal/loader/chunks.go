@@ -0,0 +1,56 @@
+package loader
+
+import (
+	"gitlab.com/churro-group/churro/internal/churrodata"
+)
+
+// chunkedFile follows the chunks of a file extracted in parallel
+type chunkedFile struct {
+	path  string
+	count int
+	// rows is the last row of each chunk seen so far, chunk rows
+	// include the rows left out by extract rule filters
+	rows    map[int]int64
+	done    map[int]bool
+	records int64
+	skipped int64
+}
+
+// totalRows is the number of rows read from the file
+func (f *chunkedFile) totalRows() (total int64) {
+	for _, r := range f.rows {
+		total += r
+	}
+	return total
+}
+
+// chunkTracker follows chunked files by the provenance of the whole
+// file, it is only used by the goroutine loading the queue
+type chunkTracker map[string]*chunkedFile
+
+// add counts the records of a chunk message and returns the file
+// once its last chunk is loaded
+func (t chunkTracker) add(msg churrodata.CSVFormat) (*chunkedFile, bool) {
+	c := msg.Chunk
+	f, ok := t[c.FileDataprov]
+	if !ok {
+		f = &chunkedFile{path: msg.Path, count: c.Count, rows: make(map[int]int64), done: make(map[int]bool)}
+		t[c.FileDataprov] = f
+	}
+
+	f.records += int64(len(msg.Records))
+	f.skipped += msg.Skipped
+	last := c.FirstRow - 1 + int64(len(msg.Records)) + msg.Skipped
+	if last > f.rows[c.Index] {
+		f.rows[c.Index] = last
+	}
+	if c.Last {
+		f.done[c.Index] = true
+	}
+
+	if len(f.done) < f.count {
+		return f, false
+	}
+	delete(t, c.FileDataprov)
+	return f, true
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/golang/snappy"
 	_ "github.com/lib/pq"
@@ -20,10 +21,14 @@ import (
 	"gitlab.com/churro-group/churro/internal/stats"
 	pb "gitlab.com/churro-group/churro/rpc/loader"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
 )
 
 const (
 	DEFAULT_PORT = ":8083"
+	// ConfirmKey is the request metadata a client sets to have Push
+	// return only after the message is written to the database
+	ConfirmKey = "churro-confirm"
 )
 
 var filesProcessedMetric prometheus.Counter
@@ -34,6 +39,8 @@ var backPressure int32
 type LoaderMessage struct {
 	Metadata   []byte
 	DataFormat string
+	// done receives the outcome of the write of a confirmed push
+	done chan error
 }
 
 // Server implements the Loader service
@@ -44,6 +51,7 @@ type Server struct {
 	Queue        chan LoaderMessage
 	ServiceCreds config.ServiceCredentials
 	DBCreds      config.DBCredentials
+	chunks       chunkTracker
 }
 
 // NewLoaderServer constructs a loader server based on the passed
@@ -54,6 +62,7 @@ func NewLoaderServer(debug bool, svcCreds config.ServiceCredentials, dbCreds con
 		ServiceCreds: svcCreds,
 		DBCreds:      dbCreds,
 		Pi:           pipeline,
+		chunks:       make(chunkTracker),
 	}
 
 	s.Queue = make(chan LoaderMessage, 32)
@@ -101,15 +110,40 @@ func (s *Server) Push(ctx context.Context, msg *pb.PushRequest) (response *pb.Pu
 	if err != nil {
 		return nil, err
 	}
-	s.Queue <- LoaderMessage{Metadata: decoded, DataFormat: msg.DataFormat}
+	elem := LoaderMessage{Metadata: decoded, DataFormat: msg.DataFormat}
+	if confirmRequested(ctx) {
+		elem.done = make(chan error, 1)
+	}
+	s.Queue <- elem
 
 	backPressure = backpressure.CheckBackpressure(len(s.Queue), s.Config.LoaderConfig.QueueSize, s.Config.LoaderConfig.PctHeadRoom, s.logger)
 
+	if elem.done != nil {
+		select {
+		case err := <-elem.done:
+			if err != nil {
+				return nil, err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
 	return &pb.PushResponse{
 		Backpressure: backPressure,
 	}, nil
 }
 
+// confirmRequested reports whether the client asked Push to wait
+// for the message to be written
+func confirmRequested(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	return len(md.Get(ConfirmKey)) > 0
+}
+
 func (s *Server) pushToDataStore() {
 	//TODO cache the client globally
 	//TODO build the URL from the config
@@ -131,70 +165,100 @@ func (s *Server) pushToDataStore() {
 		s.logger.Infof("loader has dataformat in the queue %s\n", elem.DataFormat)
 		switch elem.DataFormat {
 		case config.CSVScheme:
-			s.processCSV(db, dbname, elem)
+			err = s.processCSV(db, dbname, elem)
 		case config.XLSXScheme:
-			s.processXLS(db, dbname, elem)
+			err = s.processXLS(db, dbname, elem)
 		case config.JSONScheme:
-			s.processJSON(db, s.Pi.Name, elem)
+			err = s.processJSON(db, s.Pi.Name, elem)
 		case config.JSONPathScheme:
-			s.processJSONPath(db, s.Pi.Name, elem)
+			err = s.processJSONPath(db, s.Pi.Name, elem)
 		case config.XMLScheme:
-			s.processXML(db, dbname, elem)
+			err = s.processXML(db, dbname, elem)
 		case config.FinnHubScheme:
-			s.processFinnhubStocks(db, dbname, elem)
+			err = s.processFinnhubStocks(db, dbname, elem)
+		case config.CDCScheme:
+			err = s.processCDC(db, s.Pi.Name, elem)
 		default:
 			s.logger.Errorf("scheme not recoginized %s", elem.DataFormat)
+			err = fmt.Errorf("scheme not recognized %s", elem.DataFormat)
+		}
+		if elem.done != nil {
+			elem.done <- err
 		}
 	}
 }
 
-func (s *Server) processCSV(db *sql.DB, database string, elem LoaderMessage) {
+func (s *Server) processCSV(db *sql.DB, database string, elem LoaderMessage) error {
 
 	//unmarshal elem metadata into CSV message
 	var csvMsg churrodata.CSVFormat
 	err := json.Unmarshal(elem.Metadata, &csvMsg)
 	if err != nil {
 		s.logger.Errorf("error in unmarshal %s", err.Error())
-		return
+		return err
 	}
 
-	for _, r := range csvMsg.Records {
-		csvsql := getInsertStatement(config.CSVScheme, database, csvMsg.Tablename, csvMsg.ColumnNames, r.Cols)
-		s.logger.Infof("csvsql %s", csvsql)
-
-		_, err := db.Query(csvsql)
+	// the rows of a chunked file belong to the whole file
+	fileDataprov := csvMsg.Dataprov
+	if csvMsg.Chunk != nil {
+		fileDataprov = csvMsg.Chunk.FileDataprov
+	}
+	err = inTx(db, func(tx *sql.Tx) error {
+		rl, err := newRowLoader(tx, config.CSVScheme, database, csvMsg.Tablename, csvMsg.Load, csvMsg.ColumnNames, fileDataprov)
 		if err != nil {
-			s.logger.Errorf("error in query %s %s\n", csvsql, err.Error())
-			return
+			return err
+		}
+		for _, r := range csvMsg.Records {
+			csvsql, err := rl.load(r.Cols)
+			s.logger.Infof("csvsql %s", csvsql)
+			if err != nil {
+				return fmt.Errorf("error in query %s %v", csvsql, err)
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Errorf("error in csv load %s\n", err.Error())
+		return err
 	}
 
+	// the stats of a chunked file are kept for the whole file
 	t := stats.PipelineStats{
-		DataprovId: csvMsg.Dataprov,
-		Pipeline:   csvMsg.PipelineName,
-		FileName:   csvMsg.Path,
-		RecordsIn:  int64(len(csvMsg.Records)),
+		DataprovId:     fileDataprov,
+		Pipeline:       csvMsg.PipelineName,
+		FileName:       csvMsg.Path,
+		RecordsIn:      int64(len(csvMsg.Records)),
+		RecordsSkipped: csvMsg.Skipped,
 	}
 
+	// the records are loaded even if their stats are not updated
 	err = stats.Update(db, t, s.logger)
 	if err != nil {
 		s.logger.Errorf("error in stats update %s\n", err.Error())
-		return
 	}
+
+	if csvMsg.Chunk != nil {
+		if f, complete := s.chunks.add(csvMsg); complete {
+			s.logger.Infof("loaded %s from %d chunks, %d rows %d records %d skipped\n", f.path, f.count, f.totalRows(), f.records, f.skipped)
+		}
+	}
+	return nil
 }
 
-func (s *Server) processJSON(db *sql.DB, pipelineName string, elem LoaderMessage) {
+func (s *Server) processJSON(db *sql.DB, pipelineName string, elem LoaderMessage) error {
 	sql := fmt.Sprintf("INSERT into %s.churroformat (dataformat, metadata, createdtime) values ($1, $2, now())", pipelineName)
 	insertStmt, err := db.Prepare(sql)
 	if err != nil {
 		s.logger.Errorf("error in sql prepare %s %s\n", sql, err.Error())
+		return err
 	}
 	defer insertStmt.Close()
 	s.logger.Infof("loader sql %s\n", sql)
 	if _, err := insertStmt.Exec(elem.DataFormat, elem.Metadata); err != nil {
 		s.logger.Errorf("error in insert %s\n", err.Error())
+		return err
 	}
-
+	return nil
 }
 
 // GetStats implements the GetStats rpc interface, and simply returns
@@ -212,7 +276,7 @@ func getInsertStatement(scheme, database, tablename string, cols []string, vals
 	}
 	var c string
 	for _, v := range vals {
-		c = c + fmt.Sprintf("'%s',", v)
+		c = c + fmt.Sprintf("'%s',", strings.Replace(v, "'", "''", -1))
 	}
 
 	csvsql := fmt.Sprintf("insert into %s.%s (dataformat, %s createdtime) values ('%s', %s now())", database, tablename, b, scheme, c)
@@ -228,60 +292,70 @@ func (s *Server) startMetrics() {
 	}
 }
 
-func (s *Server) processXML(db *sql.DB, database string, elem LoaderMessage) {
+func (s *Server) processXML(db *sql.DB, database string, elem LoaderMessage) error {
 
 	//unmarshal elem metadata into XML message
 	var xmlMsg churrodata.XMLFormat
 	err := json.Unmarshal(elem.Metadata, &xmlMsg)
 	if err != nil {
 		s.logger.Errorf("error in processXML %s\n", err.Error())
-		return
+		return err
 	}
 
 	s.logger.Infof("loader is processing XML records %d\n", len(xmlMsg.Records))
 	s.logger.Infof("loader is processing XML columns %s\n", xmlMsg.ColumnNames)
-	for _, r := range xmlMsg.Records {
-		xmlsql := getInsertStatement(config.XMLScheme, database, xmlMsg.Tablename, xmlMsg.ColumnNames, r.Cols)
-		s.logger.Infof("xmlsql %s", xmlsql)
-
-		_, err := db.Query(xmlsql)
+	err = inTx(db, func(tx *sql.Tx) error {
+		rl, err := newRowLoader(tx, config.XMLScheme, database, xmlMsg.Tablename, xmlMsg.Load, xmlMsg.ColumnNames, xmlMsg.Dataprov)
 		if err != nil {
-			s.logger.Errorf("error in query %s\n", err.Error())
-			return
+			return err
 		}
+		for _, r := range xmlMsg.Records {
+			xmlsql, err := rl.load(r.Cols)
+			s.logger.Infof("xmlsql %s", xmlsql)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Errorf("error in xml load %s\n", err.Error())
+		return err
 	}
 
 	t := stats.PipelineStats{
-		DataprovId: xmlMsg.Dataprov,
-		Pipeline:   xmlMsg.PipelineName,
-		FileName:   xmlMsg.Path,
-		RecordsIn:  int64(len(xmlMsg.Records)),
+		DataprovId:     xmlMsg.Dataprov,
+		Pipeline:       xmlMsg.PipelineName,
+		FileName:       xmlMsg.Path,
+		RecordsIn:      int64(len(xmlMsg.Records)),
+		RecordsSkipped: xmlMsg.Skipped,
 	}
 
 	err = stats.Update(db, t, s.logger)
 	if err != nil {
 		s.logger.Errorf("error on stats update %s\n", err.Error())
 	}
+	return nil
 }
 
-func (s *Server) processFinnhubStocks(db *sql.DB, database string, elem LoaderMessage) {
+func (s *Server) processFinnhubStocks(db *sql.DB, database string, elem LoaderMessage) error {
 
 	//unmarshal elem metadata into CSV message
 	var csvMsg churrodata.CSVFormat
 	err := json.Unmarshal(elem.Metadata, &csvMsg)
 	if err != nil {
 		s.logger.Errorf("error on csv unmarshal %s\n", err.Error())
-		return
+		return err
 	}
 
 	for _, r := range csvMsg.Records {
 		csvsql := getInsertStatement(config.FinnHubScheme, database, csvMsg.Tablename, csvMsg.ColumnNames, r.Cols)
 		s.logger.Infof("finnhub-stocks sql %s", csvsql)
 
-		_, err := db.Query(csvsql)
+		_, err := db.Exec(csvsql)
 		if err != nil {
 			s.logger.Errorf("erro in db query %s %s", csvsql, err.Error())
-			return
+			return err
 		}
 	}
 
@@ -296,28 +370,37 @@ func (s *Server) processFinnhubStocks(db *sql.DB, database string, elem LoaderMe
 	if err != nil {
 		s.logger.Errorf("error in stats update %s\n", err.Error())
 	}
+	return nil
 }
 
-func (s *Server) processXLS(db *sql.DB, database string, elem LoaderMessage) {
+func (s *Server) processXLS(db *sql.DB, database string, elem LoaderMessage) error {
 
 	//unmarshal elem metadata into XLS message
 	var xlsMsg churrodata.XLSFormat
 	err := json.Unmarshal(elem.Metadata, &xlsMsg)
 	if err != nil {
 		s.logger.Errorf("error in xls unmarshal %s\n", err.Error())
-		return
+		return err
 	}
 
-	for _, r := range xlsMsg.Records {
-		// use the CSV insert statement for the XLS scheme
-		xlssql := getInsertStatement(config.XLSXScheme, database, xlsMsg.Tablename, xlsMsg.ColumnNames, r.Cols)
-		s.logger.Infof("xlssql %s\n", xlssql)
-
-		_, err := db.Query(xlssql)
+	// use the CSV insert statement for the XLS scheme
+	err = inTx(db, func(tx *sql.Tx) error {
+		rl, err := newRowLoader(tx, config.XLSXScheme, database, xlsMsg.Tablename, xlsMsg.Load, xlsMsg.ColumnNames, xlsMsg.Dataprov)
 		if err != nil {
-			s.logger.Errorf("error in xls query %s\n", err.Error())
-			return
+			return err
 		}
+		for _, r := range xlsMsg.Records {
+			xlssql, err := rl.load(r.Cols)
+			s.logger.Infof("xlssql %s\n", xlssql)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Errorf("error in xls load %s\n", err.Error())
+		return err
 	}
 
 	t := stats.PipelineStats{
@@ -330,51 +413,138 @@ func (s *Server) processXLS(db *sql.DB, database string, elem LoaderMessage) {
 	err = stats.Update(db, t, s.logger)
 	if err != nil {
 		s.logger.Errorf("error in stats update %s\n", err.Error())
-		return
 	}
+	return nil
 }
 
-func (s *Server) processJSONPath(db *sql.DB, database string, elem LoaderMessage) {
+func (s *Server) processJSONPath(db *sql.DB, database string, elem LoaderMessage) error {
 
 	//unmarshal into JsonPathMessage
 	var jsonPathMsg churrodata.JsonPathFormat
 	err := json.Unmarshal(elem.Metadata, &jsonPathMsg)
 	if err != nil {
 		s.logger.Errorf("error in jsonpath unmarshal %s\n", err.Error())
-		return
+		return err
 	}
 
 	s.logger.Infof("jsonPathMsg %+v\n", jsonPathMsg)
 
 	var recordsProcessed int64
 
-	for r := 0; r < len(jsonPathMsg.Records); r++ {
-		record := jsonPathMsg.Records[r]
-		s.logger.Infof("r.Cols %v\n", record.Cols)
-		if len(record.Cols) > 0 {
-			jsonpathsql := getInsertStatement(config.JSONPathScheme, database, jsonPathMsg.Tablename, jsonPathMsg.ColumnNames, record.Cols)
-			s.logger.Info("jsonpathsql %s\n", jsonpathsql)
+	err = inTx(db, func(tx *sql.Tx) error {
+		rl, err := newRowLoader(tx, config.JSONPathScheme, database, jsonPathMsg.Tablename, jsonPathMsg.Load, jsonPathMsg.ColumnNames, jsonPathMsg.Dataprov)
+		if err != nil {
+			return err
+		}
+		for r := 0; r < len(jsonPathMsg.Records); r++ {
+			record := jsonPathMsg.Records[r]
+			s.logger.Infof("r.Cols %v\n", record.Cols)
+			if len(record.Cols) > 0 {
+				jsonpathsql, err := rl.load(record.Cols)
+				s.logger.Info("jsonpathsql %s\n", jsonpathsql)
+				if err != nil {
+					return err
+				}
+				recordsProcessed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Errorf("error in jsonpath load %s\n", err.Error())
+		return err
+	}
+
+	t := stats.PipelineStats{
+		DataprovId:     jsonPathMsg.Dataprov,
+		Pipeline:       jsonPathMsg.PipelineName,
+		FileName:       jsonPathMsg.Path,
+		RecordsIn:      recordsProcessed,
+		RecordsSkipped: jsonPathMsg.Skipped,
+	}
+
+	err = stats.Update(db, t, s.logger)
+	if err != nil {
+		s.logger.Errorf("error in jsonpath stats update %s\n", err.Error())
+	}
+	return nil
+}
+
+// processCDC applies captured changes in one transaction, an upsert
+// replaces the rows matching the change's key columns
+func (s *Server) processCDC(db *sql.DB, database string, elem LoaderMessage) error {
+
+	var cdcMsg churrodata.CDCFormat
+	err := json.Unmarshal(elem.Metadata, &cdcMsg)
+	if err != nil {
+		s.logger.Errorf("error in cdc unmarshal %s\n", err.Error())
+		return err
+	}
 
-			_, err := db.Query(jsonpathsql)
+	keys := make([]int, 0, len(cdcMsg.KeyColumns))
+	where := make([]string, 0, len(cdcMsg.KeyColumns))
+	for _, k := range cdcMsg.KeyColumns {
+		for i, c := range cdcMsg.ColumnNames {
+			if c == k {
+				keys = append(keys, i)
+				where = append(where, fmt.Sprintf("%s = $%d", k, len(keys)))
+			}
+		}
+	}
+	if len(keys) == 0 || len(keys) != len(cdcMsg.KeyColumns) {
+		s.logger.Errorf("cdc key columns %v are not in the columns %v\n", cdcMsg.KeyColumns, cdcMsg.ColumnNames)
+		return fmt.Errorf("cdc key columns %v are not in the columns %v", cdcMsg.KeyColumns, cdcMsg.ColumnNames)
+	}
+	deleteSQL := fmt.Sprintf("delete from %s.%s where %s", database, cdcMsg.Tablename, strings.Join(where, " and "))
+
+	tx, err := db.Begin()
+	if err != nil {
+		s.logger.Errorf("error in cdc begin %s\n", err.Error())
+		return err
+	}
+
+	var recordsProcessed int64
+	for _, change := range cdcMsg.Changes {
+		if len(change.Cols) != len(cdcMsg.ColumnNames) {
+			continue
+		}
+		args := make([]interface{}, 0, len(keys))
+		for _, k := range keys {
+			args = append(args, change.Cols[k])
+		}
+		_, err = tx.Exec(deleteSQL, args...)
+		if err != nil {
+			s.logger.Errorf("error in cdc delete %s\n", err.Error())
+			tx.Rollback()
+			return err
+		}
+		if change.Op == churrodata.CDCUpsert {
+			_, err = tx.Exec(getInsertStatement(config.CDCScheme, database, cdcMsg.Tablename, cdcMsg.ColumnNames, change.Cols))
 			if err != nil {
-				s.logger.Errorf("error in jsonpath query %s\n", err.Error())
-				return
+				s.logger.Errorf("error in cdc insert %s\n", err.Error())
+				tx.Rollback()
+				return err
 			}
-			recordsProcessed++
 		}
+		recordsProcessed++
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		s.logger.Errorf("error in cdc commit %s\n", err.Error())
+		return err
 	}
 
 	t := stats.PipelineStats{
-		DataprovId: jsonPathMsg.Dataprov,
-		Pipeline:   jsonPathMsg.PipelineName,
-		FileName:   jsonPathMsg.Path,
+		DataprovId: cdcMsg.Dataprov,
+		Pipeline:   cdcMsg.PipelineName,
+		FileName:   cdcMsg.Path,
 		RecordsIn:  recordsProcessed,
 	}
 
 	err = stats.Update(db, t, s.logger)
 	if err != nil {
-		s.logger.Errorf("error in jsonpath stats update %s\n", err.Error())
-		return
+		s.logger.Errorf("error in cdc stats update %s\n", err.Error())
 	}
-
+	return nil
 }
@@ -0,0 +1,145 @@
+package loader
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"gitlab.com/churro-group/churro/internal/churrodata"
+)
+
+// execer runs the statements of a rowLoader, a transaction when the
+// records of a message are written together
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// rowLoader writes the records of one message to their table
+// following the message's load mode
+type rowLoader struct {
+	db        execer
+	scheme    string
+	database  string
+	tablename string
+	spec      churrodata.Load
+	cols      []string
+	// dataprov is the provenance of the file the records are from,
+	// replace-partition rows record it to be told from older rows
+	dataprov string
+	keys     []int
+	replaced map[string]bool
+}
+
+func newRowLoader(db execer, scheme, database, tablename string, load churrodata.Load, cols []string, dataprov string) (*rowLoader, error) {
+	l := &rowLoader{
+		db:        db,
+		scheme:    scheme,
+		database:  database,
+		tablename: tablename,
+		spec:      load,
+		cols:      cols,
+		dataprov:  dataprov,
+		replaced:  make(map[string]bool),
+	}
+	if load.LoadMode != churrodata.LoadUpsert && load.LoadMode != churrodata.LoadReplacePartition {
+		return l, nil
+	}
+
+	for _, k := range load.KeyColumns {
+		for i, c := range cols {
+			if c == k {
+				l.keys = append(l.keys, i)
+			}
+		}
+	}
+	if len(l.keys) == 0 || len(l.keys) != len(load.KeyColumns) {
+		return nil, fmt.Errorf("key columns %v are not in the columns %v", load.KeyColumns, cols)
+	}
+	return l, nil
+}
+
+// load writes one record and returns the statement used, under
+// replace-partition the first record of a partition in the message
+// first removes the partition's rows loaded from other files
+func (l *rowLoader) load(vals []string) (string, error) {
+	if l.spec.LoadMode == churrodata.LoadReplacePartition {
+		err := l.replacePartition(vals)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	stmt := getLoadStatement(l.scheme, l.database, l.tablename, l.spec, l.cols, vals, l.dataprov)
+	_, err := l.db.Exec(stmt)
+	return stmt, err
+}
+
+func (l *rowLoader) replacePartition(vals []string) error {
+	if len(vals) != len(l.cols) {
+		return fmt.Errorf("record has %d of the %d columns", len(vals), len(l.cols))
+	}
+
+	where := make([]string, 0, len(l.keys)+1)
+	args := make([]interface{}, 0, len(l.keys)+1)
+	for _, k := range l.keys {
+		args = append(args, vals[k])
+		where = append(where, fmt.Sprintf("%s = $%d", l.cols[k], len(args)))
+	}
+	partition := fmt.Sprintf("%q", args)
+	if l.replaced[partition] {
+		return nil
+	}
+
+	args = append(args, l.dataprov)
+	where = append(where, fmt.Sprintf("dataprov IS DISTINCT FROM $%d", len(args)))
+	_, err := l.db.Exec(fmt.Sprintf("delete from %s.%s where %s", l.database, l.tablename, strings.Join(where, " and ")), args...)
+	if err != nil {
+		return err
+	}
+	l.replaced[partition] = true
+	return nil
+}
+
+// getLoadStatement returns the statement writing a record with the
+// load mode, an upsert updates the row with the same key columns
+func getLoadStatement(scheme, database, tablename string, load churrodata.Load, cols []string, vals []string, dataprov string) string {
+	switch load.LoadMode {
+	case churrodata.LoadUpsert:
+		set := []string{"dataformat = excluded.dataformat"}
+		for _, c := range cols {
+			if !isKeyColumn(c, load.KeyColumns) {
+				set = append(set, fmt.Sprintf("%s = excluded.%s", c, c))
+			}
+		}
+		set = append(set, "createdtime = excluded.createdtime")
+		return fmt.Sprintf("%s on conflict (%s) do update set %s", getInsertStatement(scheme, database, tablename, cols, vals), strings.Join(load.KeyColumns, ", "), strings.Join(set, ", "))
+	case churrodata.LoadReplacePartition:
+		cols = append(append(make([]string, 0, len(cols)+1), cols...), "dataprov")
+		vals = append(append(make([]string, 0, len(vals)+1), vals...), dataprov)
+	}
+	return getInsertStatement(scheme, database, tablename, cols, vals)
+}
+
+func isKeyColumn(c string, keys []string) bool {
+	for _, k := range keys {
+		if k == c {
+			return true
+		}
+	}
+	return false
+}
+
+// inTx runs load in a transaction so the records of a message are
+// written together or not at all
+func inTx(db *sql.DB, load func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = load(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -7,6 +7,7 @@ import (
 	"gitlab.com/churro-group/churro/api/v1alpha1"
 	v1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -30,10 +31,20 @@ func (r PipelineReconciler) processRoles(pipeline v1alpha1.Pipeline) error {
 	// make sure we have a role/cockroachdb
 	needCockroachRole := true
 	for i := 0; i < len(childRoles.Items); i++ {
-		r := childRoles.Items[i]
-		if r.Name == "churro" {
+		role := childRoles.Items[i]
+		if role.Name == "churro" {
 			needChurroRole = false
-		} else if r.Name == "cockroachdb" {
+			// roles created by an earlier churro lack rules
+			// that newer services depend on
+			if !reflect.DeepEqual(role.Rules, churroRoleRules()) {
+				role.Rules = churroRoleRules()
+				if err := r.Update(r.Ctx, &role); err != nil {
+					log.Error(err, "unable to update rbacObject for pipeline", "rbac", role)
+					return err
+				}
+				fmt.Println("updated rbac for pipeline ")
+			}
+		} else if role.Name == "cockroachdb" {
 			needCockroachRole = false
 		}
 	}
@@ -44,39 +55,7 @@ func (r PipelineReconciler) processRoles(pipeline v1alpha1.Pipeline) error {
 		churroRole := rbacv1.Role{}
 		churroRole.Name = "churro"
 		churroRole.Namespace = pipeline.ObjectMeta.Namespace
-		/**
-		  rules:
-		  - apiGroups:
-		    - ""
-		    resources:
-		    - pods
-		    - services
-		    - secrets
-		    verbs:
-		    - create
-		    - get
-		    - list
-		  - apiGroups:
-		    - "churro.project.io"
-		    resources:
-		    - pipelines
-		    verbs:
-		    - get
-		    - list
-		*/
-		churroRole.Rules = make([]rbacv1.PolicyRule, 0)
-		policyRule := rbacv1.PolicyRule{}
-		policyRule.Verbs = []string{"create", "get", "list"}
-		policyRule.APIGroups = []string{""}
-		policyRule.Resources = []string{"pods", "services", "secrets"}
-		churroRole.Rules = append(churroRole.Rules, policyRule)
-
-		policyRule = rbacv1.PolicyRule{}
-		policyRule.Verbs = []string{"get", "list"}
-		policyRule.APIGroups = []string{"churro.project.io"}
-		policyRule.Resources = []string{"pipelines"}
-		churroRole.Rules = append(churroRole.Rules, policyRule)
-
+		churroRole.Rules = churroRoleRules()
 		rolesToCreate = append(rolesToCreate, churroRole)
 	}
 	if needCockroachRole {
@@ -116,6 +95,62 @@ func (r PipelineReconciler) processRoles(pipeline v1alpha1.Pipeline) error {
 	return nil
 }
 
+// churroRoleRules returns the rules of role/churro
+func churroRoleRules() []rbacv1.PolicyRule {
+	/**
+	  rules:
+	  - apiGroups:
+	    - ""
+	    resources:
+	    - pods
+	    - services
+	    - secrets
+	    verbs:
+	    - create
+	    - get
+	    - list
+	  - apiGroups:
+	    - "batch"
+	    resources:
+	    - jobs
+	    verbs:
+	    - create
+	    - get
+	    - list
+	    - watch
+	    - delete
+	    - deletecollection
+	  - apiGroups:
+	    - "churro.project.io"
+	    resources:
+	    - pipelines
+	    verbs:
+	    - get
+	    - list
+	    - update
+	*/
+	rules := make([]rbacv1.PolicyRule, 0)
+	policyRule := rbacv1.PolicyRule{}
+	policyRule.Verbs = []string{"create", "get", "list"}
+	policyRule.APIGroups = []string{""}
+	policyRule.Resources = []string{"pods", "services", "secrets"}
+	rules = append(rules, policyRule)
+
+	policyRule = rbacv1.PolicyRule{}
+	policyRule.Verbs = []string{"create", "get", "list", "watch", "delete", "deletecollection"}
+	policyRule.APIGroups = []string{"batch"}
+	policyRule.Resources = []string{"jobs"}
+	rules = append(rules, policyRule)
+
+	policyRule = rbacv1.PolicyRule{}
+	policyRule.Verbs = []string{"get", "list", "update"}
+	policyRule.APIGroups = []string{"churro.project.io"}
+	policyRule.Resources = []string{"pipelines"}
+	rules = append(rules, policyRule)
+
+	return rules
+}
+
 func (r PipelineReconciler) processServiceAccounts(pipeline v1alpha1.Pipeline) error {
 	var childSAs v1.ServiceAccountList
 	err := r.List(r.Ctx, &childSAs, client.InNamespace(pipeline.ObjectMeta.Namespace), client.MatchingFields{jobOwnerKey: pipeline.ObjectMeta.Name})
@@ -1,6 +1,8 @@
 package operator
 
 import (
+	"fmt"
+
 	"github.com/prometheus/common/log"
 	"gitlab.com/churro-group/churro/api/v1alpha1"
 
@@ -98,7 +100,31 @@ func (r PipelineReconciler) processServices(pipeline v1alpha1.Pipeline) error {
 			Name: "grpc",
 			Port: 8087,
 		}
-		service.Spec.Ports = []v1.ServicePort{sp}
+		// https and grpc endpoints of the pipeline's ingest sources
+		ingest := v1.ServicePort{
+			Name: "ingest",
+			Port: 8089,
+		}
+		ingestGRPC := v1.ServicePort{
+			Name: "ingest-grpc",
+			Port: 8090,
+		}
+		service.Spec.Ports = []v1.ServicePort{sp, ingest, ingestGRPC}
+		// each syslog source listens on udp and tcp and optionally tls
+		for _, src := range pipeline.Spec.SyslogSources {
+			service.Spec.Ports = append(service.Spec.Ports,
+				v1.ServicePort{Name: fmt.Sprintf("udp-%d", src.Port), Port: int32(src.Port), Protocol: v1.ProtocolUDP},
+				v1.ServicePort{Name: fmt.Sprintf("tcp-%d", src.Port), Port: int32(src.Port), Protocol: v1.ProtocolTCP})
+			if src.TLSPort > 0 {
+				service.Spec.Ports = append(service.Spec.Ports, v1.ServicePort{Name: fmt.Sprintf("tls-%d", src.TLSPort), Port: int32(src.TLSPort), Protocol: v1.ProtocolTCP})
+			}
+		}
+		if len(pipeline.Spec.SyslogSources) > 0 || len(pipeline.Spec.KafkaSources) > 0 {
+			service.Spec.Ports = append(service.Spec.Ports, v1.ServicePort{Name: "metrics", Port: 2112})
+		}
+		if len(pipeline.Spec.S3Sources) > 0 {
+			service.Spec.Ports = append(service.Spec.Ports, v1.ServicePort{Name: "objectstore", Port: 8091})
+		}
 		service.Spec.Selector = map[string]string{"app": "churro", "pipeline": pipeline.ObjectMeta.Name, "service": "churro-watch"}
 		/**
 		  apiVersion: v1
@@ -15,6 +15,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -77,6 +78,51 @@ func GetPipeline(logger *zap.SugaredLogger) (v1alpha1.Pipeline, error) {
 	return instance, nil
 }
 
+// UpdatePipeline applies update to the pipeline this pod runs in and
+// saves it, the update is re-applied to a fresh copy on a conflict
+func UpdatePipeline(update func(*v1alpha1.Pipeline)) (v1alpha1.Pipeline, error) {
+
+	instance := v1alpha1.Pipeline{}
+	ns := os.Getenv("CHURRO_NAMESPACE")
+	pipelineName := os.Getenv("CHURRO_PIPELINE")
+	if ns == "" {
+		return instance, errors.New("CHURRO_NAMESPACE not set")
+	}
+	if pipelineName == "" {
+		return instance, errors.New("CHURRO_PIPELINE not set")
+	}
+
+	_, cfg, err := GetKubeClient()
+	if err != nil {
+		return instance, err
+	}
+
+	err = v1alpha1.AddToScheme(clientgoscheme.Scheme)
+	if err != nil {
+		return instance, err
+	}
+
+	k8sClient, err := client.New(cfg, client.Options{Scheme: clientgoscheme.Scheme})
+	if err != nil {
+		return instance, err
+	}
+
+	namespacedName := types.NamespacedName{
+		Namespace: ns,
+		Name:      pipelineName,
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		instance = v1alpha1.Pipeline{}
+		if err := k8sClient.Get(context.TODO(), namespacedName, &instance); err != nil {
+			return err
+		}
+		update(&instance)
+		return k8sClient.Update(context.TODO(), &instance)
+	})
+	return instance, err
+}
+
 var SchemeGroupVersion = schema.GroupVersion{Group: "churro.project.io", Version: "v1alpha1"}
 
 func addKnownTypes(scheme *runtime.Scheme) error {
@@ -183,4 +183,5 @@ func fillCRDefaults(cr *v1alpha1.Pipeline, pipelineName string) {
 	cr.Spec.WatchConfig.Location.Scheme = "http"
 	cr.Spec.WatchConfig.Location.Host = "churro-watch"
 	cr.Spec.WatchConfig.Location.Port = 8087
+	cr.Spec.WatchConfig.MaxConcurrentExtracts = 10
 }
@@ -16,23 +16,26 @@ import (
 )
 
 type PipelineStats struct {
-	Id          int64
-	DataprovId  string
-	Pipeline    string
-	FileName    string
-	RecordsIn   int64
-	LastUpdated time.Time
+	Id         int64
+	DataprovId string
+	Pipeline   string
+	FileName   string
+	RecordsIn  int64
+	// RecordsSkipped counts the rows left out by extract rule
+	// filters
+	RecordsSkipped int64
+	LastUpdated    time.Time
 }
 
 // Update inserts or updates pipeline stats
 func Update(db *sql.DB, data PipelineStats, logger *zap.SugaredLogger) (err error) {
 
-	var recordsIn int64
+	var recordsIn, recordsSkipped int64
 	// get existing records count if a row exists
-	sqlstr := fmt.Sprintf("SELECT records_in from %s.pipeline_stats where file_name = '%s'", data.Pipeline, data.FileName)
+	sqlstr := fmt.Sprintf("SELECT records_in, COALESCE(records_skipped, 0) from %s.pipeline_stats where file_name = '%s'", data.Pipeline, data.FileName)
 	logger.Infof("stats sql query %s\n", sqlstr)
 	row := db.QueryRow(sqlstr)
-	err = row.Scan(&recordsIn)
+	err = row.Scan(&recordsIn, &recordsSkipped)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			logger.Info("no rows in pipeline_stats yet")
@@ -42,15 +45,16 @@ func Update(db *sql.DB, data PipelineStats, logger *zap.SugaredLogger) (err erro
 	}
 
 	recordsIn += data.RecordsIn
+	recordsSkipped += data.RecordsSkipped
 
-	sqlstr = fmt.Sprintf("UPSERT into %s.pipeline_stats (dataprov_id, file_name, records_in, lastupdated ) values ($1, $2, $3, 'now()')", data.Pipeline)
+	sqlstr = fmt.Sprintf("UPSERT into %s.pipeline_stats (dataprov_id, file_name, records_in, records_skipped, lastupdated ) values ($1, $2, $3, $4, 'now()')", data.Pipeline)
 	logger.Infof("stats upsert %s\n", sqlstr)
 	upsertStmt, err := db.Prepare(sqlstr)
 	if err != nil {
 		return err
 	}
 	defer upsertStmt.Close()
-	if _, err := upsertStmt.Exec(data.DataprovId, data.FileName, recordsIn); err != nil {
+	if _, err := upsertStmt.Exec(data.DataprovId, data.FileName, recordsIn, recordsSkipped); err != nil {
 		return err
 	}
 
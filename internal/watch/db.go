@@ -2,6 +2,7 @@ package watch
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -25,19 +26,51 @@ type WatchDirectory struct {
 	Regex        string                 `json:"watchregex"`
 	Tablename    string                 `json:"watchtablename"`
 	ExtractRules map[string]ExtractRule `json:"watchrules"`
-	LastUpdated  time.Time              `json:"lastupdated"`
+	// MaxConcurrent caps the extractions running at once for this
+	// directory, zero means only the pipeline wide cap applies
+	MaxConcurrent int `json:"watchmaxconcurrent"`
+	// Priority orders queued extractions, higher values run first
+	Priority int `json:"watchpriority"`
+	// Disposition is what happens to a file once it is extracted,
+	// one of rename, archive, delete or compress
+	Disposition    string `json:"watchdisposition"`
+	ArchivePath    string `json:"watcharchivepath"`
+	QuarantinePath string `json:"watchquarantinepath"`
+	// RetentionDays is how long archived files are kept, zero
+	// keeps them forever
+	RetentionDays int `json:"watchretentiondays"`
+	// WatchMode selects how new files are detected, notify or poll
+	WatchMode string `json:"watchmode"`
+	// PollInterval is the seconds between listings in poll mode
+	PollInterval int `json:"watchpollinterval"`
+	// LineParser splits the lines of followed files in tail mode
+	// into columns, one of regex, json or logfmt
+	LineParser string `json:"watchlineparser"`
+	// LinePattern is the regex parser's expression, its named
+	// groups are the columns
+	LinePattern string `json:"watchlinepattern"`
+	// DuplicatePolicy is what happens to a file whose content was
+	// already loaded, one of skip, reload or version
+	DuplicatePolicy string `json:"watchduplicatepolicy"`
+	// LoadMode is how rows are written to the table, one of append,
+	// upsert or replace-partition
+	LoadMode string `json:"watchloadmode"`
+	// KeyColumns is a comma separated list of the columns keying a
+	// row in upsert mode, or its partition in replace-partition mode
+	KeyColumns  string    `json:"watchkeycolumns"`
+	LastUpdated time.Time `json:"lastupdated"`
 }
 
 func (a *WatchDirectory) Create(db *sql.DB) error {
 	a.Id = xid.New().String()
-	var INSERT = fmt.Sprintf("INSERT INTO watchdirectory(id, name, path, scheme, regex, tablename, lastupdated) values('%s',$1,$2,$3,$4,$5,now())", a.Id)
+	var INSERT = fmt.Sprintf("INSERT INTO watchdirectory(id, name, path, scheme, regex, tablename, maxconcurrent, priority, disposition, archivepath, quarantinepath, retentiondays, watchmode, pollinterval, lineparser, linepattern, duplicatepolicy, loadmode, keycolumns, lastupdated) values('%s',$1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,now())", a.Id)
 	stmt, err := db.Prepare(INSERT)
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
 
-	_, err = stmt.Exec(a.Name, a.Path, a.Scheme, a.Regex, a.Tablename)
+	_, err = stmt.Exec(a.Name, a.Path, a.Scheme, a.Regex, a.Tablename, a.MaxConcurrent, a.Priority, a.Disposition, a.ArchivePath, a.QuarantinePath, a.RetentionDays, a.WatchMode, a.PollInterval, a.LineParser, a.LinePattern, a.DuplicatePolicy, a.LoadMode, a.KeyColumns)
 	if err != nil {
 		fmt.Println(err)
 		return err
@@ -64,14 +97,14 @@ func (a *WatchDirectory) Delete(db *sql.DB) error {
 }
 
 func (a *WatchDirectory) Update(db *sql.DB) error {
-	var UPDATE = fmt.Sprintf("UPDATE watchdirectory set (tablename, name, path, scheme, regex, lastupdated) = ($1,$2,$3,$4,$5,now()) where id = $6")
+	var UPDATE = fmt.Sprintf("UPDATE watchdirectory set (tablename, name, path, scheme, regex, maxconcurrent, priority, disposition, archivepath, quarantinepath, retentiondays, watchmode, pollinterval, lineparser, linepattern, duplicatepolicy, loadmode, keycolumns, lastupdated) = ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,now()) where id = $19")
 	stmt, err := db.Prepare(UPDATE)
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
 
-	_, err = stmt.Exec(a.Tablename, a.Name, a.Path, a.Scheme, a.Regex, a.Id)
+	_, err = stmt.Exec(a.Tablename, a.Name, a.Path, a.Scheme, a.Regex, a.MaxConcurrent, a.Priority, a.Disposition, a.ArchivePath, a.QuarantinePath, a.RetentionDays, a.WatchMode, a.PollInterval, a.LineParser, a.LinePattern, a.DuplicatePolicy, a.LoadMode, a.KeyColumns, a.Id)
 	if err != nil {
 		fmt.Println(err)
 		return err
@@ -93,8 +126,8 @@ func GetWatchDirectory(id string, db *sql.DB) (a WatchDirectory, err error) {
 	}
 
 	a.Id = id
-	row := db.QueryRow("SELECT tablename, name, path, scheme, regex, lastupdated FROM watchdirectory where id=$1", id)
-	switch err := row.Scan(&a.Tablename, &a.Name, &a.Path, &a.Scheme, &a.Regex, &a.LastUpdated); err {
+	row := db.QueryRow("SELECT tablename, name, path, scheme, regex, maxconcurrent, priority, disposition, archivepath, quarantinepath, retentiondays, watchmode, pollinterval, lineparser, linepattern, duplicatepolicy, loadmode, keycolumns, lastupdated FROM watchdirectory where id=$1", id)
+	switch err := row.Scan(&a.Tablename, &a.Name, &a.Path, &a.Scheme, &a.Regex, &a.MaxConcurrent, &a.Priority, &a.Disposition, &a.ArchivePath, &a.QuarantinePath, &a.RetentionDays, &a.WatchMode, &a.PollInterval, &a.LineParser, &a.LinePattern, &a.DuplicatePolicy, &a.LoadMode, &a.KeyColumns, &a.LastUpdated); err {
 	case sql.ErrNoRows:
 		fmt.Printf("watchdir id was not found\n")
 		return a, err
@@ -109,7 +142,7 @@ func GetWatchDirectory(id string, db *sql.DB) (a WatchDirectory, err error) {
 func GetWatchDirectories(db *sql.DB) (a []WatchDirectory, err error) {
 
 	var rows *sql.Rows
-	rows, err = db.Query("SELECT tablename, id, name, path, scheme, regex, lastupdated FROM watchdirectory")
+	rows, err = db.Query("SELECT tablename, id, name, path, scheme, regex, maxconcurrent, priority, disposition, archivepath, quarantinepath, retentiondays, watchmode, pollinterval, lineparser, linepattern, duplicatepolicy, loadmode, keycolumns, lastupdated FROM watchdirectory")
 	if err != nil {
 		fmt.Printf("watchdir id was not found\n")
 		return a, err
@@ -117,12 +150,26 @@ func GetWatchDirectories(db *sql.DB) (a []WatchDirectory, err error) {
 
 	for rows.Next() {
 		r := WatchDirectory{}
-		err := rows.Scan(&r.Tablename, &r.Id, &r.Name, &r.Path, &r.Scheme, &r.Regex, &r.LastUpdated)
+		err := rows.Scan(&r.Tablename, &r.Id, &r.Name, &r.Path, &r.Scheme, &r.Regex, &r.MaxConcurrent, &r.Priority, &r.Disposition, &r.ArchivePath, &r.QuarantinePath, &r.RetentionDays, &r.WatchMode, &r.PollInterval, &r.LineParser, &r.LinePattern, &r.DuplicatePolicy, &r.LoadMode, &r.KeyColumns, &r.LastUpdated)
 		if err != nil {
+			rows.Close()
 			return a, err
 		}
 		a = append(a, r)
 	}
+	rows.Close()
+
+	// the extractors read the rules of their directory from here
+	for i := range a {
+		rules, err := GetExtractRulesForWatchDir(a[i].Id, db)
+		if err != nil {
+			return a, err
+		}
+		a[i].ExtractRules = make(map[string]ExtractRule)
+		for _, r := range rules {
+			a[i].ExtractRules[r.Id] = r
+		}
+	}
 
 	return a, nil
 }
@@ -204,6 +251,8 @@ func GetExtractRulesForWatchDir(watchDirId string, db *sql.DB) (a []ExtractRule,
 		return a, err
 	}
 
+	defer rows.Close()
+
 	for rows.Next() {
 		r := ExtractRule{}
 		r.WatchDirectoryId = watchDirId
@@ -215,3 +264,594 @@ func GetExtractRulesForWatchDir(watchDirId string, db *sql.DB) (a []ExtractRule,
 	}
 	return a, nil
 }
+
+// ExtractWork is a single pending extraction waiting in the
+// watch service work queue, it is persisted so that a restart
+// of churro-watch does not lose queued files
+type ExtractWork struct {
+	Id               string    `json:"id"`
+	WatchDirectoryId string    `json:"watchdirectoryid"`
+	WatchDirName     string    `json:"watchdirname"`
+	Scheme           string    `json:"scheme"`
+	FilePath         string    `json:"filepath"`
+	Tablename        string    `json:"tablename"`
+	Priority         int       `json:"priority"`
+	CreatedTime      time.Time `json:"createdtime"`
+	// Resume continues an interrupted extraction from its checkpoint
+	Resume bool `json:"resume"`
+	// Duplicate is the policy applied to a file whose content was
+	// already loaded and Decision describes it for the file history
+	Duplicate string `json:"duplicate"`
+	Decision  string `json:"decision"`
+	// SourcePath is the remote path a downloaded file came from and
+	// SourceVersion its version, both are recorded on the dataprov
+	// of the extraction
+	SourcePath    string `json:"sourcepath"`
+	SourceVersion string `json:"sourceversion"`
+	// Streaming work such as a socket source runs until stopped,
+	// it is never queued or persisted
+	Streaming bool `json:"-"`
+}
+
+func (a *ExtractWork) Create(db *sql.DB) error {
+	if a.Id == "" {
+		a.Id = xid.New().String()
+	}
+	a.CreatedTime = time.Now()
+	var INSERT = fmt.Sprintf("INSERT INTO extractqueue(id, watchdirectoryid, watchdirname, scheme, filepath, tablename, priority, createdtime, resume, duplicate, decision, sourcepath, sourceversion) values('%s',$1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)", a.Id)
+	stmt, err := db.Prepare(INSERT)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = stmt.Exec(a.WatchDirectoryId, a.WatchDirName, a.Scheme, a.FilePath, a.Tablename, a.Priority, a.CreatedTime, a.Resume, a.Duplicate, a.Decision, a.SourcePath, a.SourceVersion)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (a *ExtractWork) Delete(db *sql.DB) error {
+	var DELETE = fmt.Sprintf("DELETE FROM extractqueue where id=$1")
+	stmt, err := db.Prepare(DELETE)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = stmt.Exec(a.Id)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetExtractWork returns all the extractions that were queued
+// but not yet started
+func GetExtractWork(db *sql.DB) (a []ExtractWork, err error) {
+
+	var rows *sql.Rows
+	rows, err = db.Query("SELECT id, watchdirectoryid, watchdirname, scheme, filepath, tablename, priority, createdtime, resume, duplicate, decision, sourcepath, sourceversion FROM extractqueue")
+	if err != nil {
+		return a, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := ExtractWork{}
+		err := rows.Scan(&r.Id, &r.WatchDirectoryId, &r.WatchDirName, &r.Scheme, &r.FilePath, &r.Tablename, &r.Priority, &r.CreatedTime, &r.Resume, &r.Duplicate, &r.Decision, &r.SourcePath, &r.SourceVersion)
+		if err != nil {
+			return a, err
+		}
+		a = append(a, r)
+	}
+	return a, nil
+}
+
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+	OutcomeRetried   = "retried"
+	// OutcomeSkipped is a duplicate file that was not extracted
+	OutcomeSkipped = "skipped"
+)
+
+// ExtractOutcome is the final result of the extract job that
+// processed a file, it makes up the file history of a watch
+// directory
+type ExtractOutcome struct {
+	Id               string `json:"id"`
+	WatchDirectoryId string `json:"watchdirectoryid"`
+	FilePath         string `json:"filepath"`
+	Status           string `json:"status"`
+	Attempts         int    `json:"attempts"`
+	// Decision is what was done with a duplicate file
+	Decision    string    `json:"decision,omitempty"`
+	LastUpdated time.Time `json:"lastupdated"`
+	// WorkId is the ExtractWork the outcome is for, it is only
+	// used in memory to match outcomes to the work that started them
+	WorkId string `json:"-"`
+}
+
+func (a *ExtractOutcome) Upsert(db *sql.DB) error {
+	var UPSERT = "UPSERT INTO extractoutcome(id, watchdirectoryid, filepath, status, attempts, decision, lastupdated) values($1,$2,$3,$4,$5,$6,now())"
+	stmt, err := db.Prepare(UPSERT)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = stmt.Exec(a.Id, a.WatchDirectoryId, a.FilePath, a.Status, a.Attempts, a.Decision)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func GetExtractOutcomes(watchDirId string, db *sql.DB) (a []ExtractOutcome, err error) {
+
+	var rows *sql.Rows
+	rows, err = db.Query("SELECT id, filepath, status, attempts, decision, lastupdated FROM extractoutcome where watchdirectoryid=$1", watchDirId)
+	if err != nil {
+		return a, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := ExtractOutcome{}
+		r.WatchDirectoryId = watchDirId
+		err := rows.Scan(&r.Id, &r.FilePath, &r.Status, &r.Attempts, &r.Decision, &r.LastUpdated)
+		if err != nil {
+			return a, err
+		}
+		a = append(a, r)
+	}
+	return a, nil
+}
+
+// FileState is the last seen size and modification time of a file
+// in a polled watch directory
+type FileState struct {
+	WatchDirectoryId string    `json:"watchdirectoryid"`
+	Path             string    `json:"path"`
+	Size             int64     `json:"size"`
+	ModTime          time.Time `json:"modtime"`
+}
+
+// Same reports whether two states describe the same file content
+func (a FileState) Same(b FileState) bool {
+	return a.Size == b.Size && a.ModTime.Equal(b.ModTime)
+}
+
+func (a *FileState) Upsert(db *sql.DB) error {
+	var UPSERT = "UPSERT INTO watchsnapshot(watchdirectoryid, path, size, modtime) values($1,$2,$3,$4)"
+	stmt, err := db.Prepare(UPSERT)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = stmt.Exec(a.WatchDirectoryId, a.Path, a.Size, a.ModTime)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (a *FileState) Delete(db *sql.DB) error {
+	var DELETE = "DELETE FROM watchsnapshot where watchdirectoryid=$1 and path=$2"
+	stmt, err := db.Prepare(DELETE)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = stmt.Exec(a.WatchDirectoryId, a.Path)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetSnapshot returns the persisted file states of a watch
+// directory keyed by path
+func GetSnapshot(watchDirId string, db *sql.DB) (a map[string]FileState, err error) {
+
+	a = make(map[string]FileState)
+
+	var rows *sql.Rows
+	rows, err = db.Query("SELECT path, size, modtime FROM watchsnapshot where watchdirectoryid=$1", watchDirId)
+	if err != nil {
+		return a, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := FileState{}
+		r.WatchDirectoryId = watchDirId
+		err := rows.Scan(&r.Path, &r.Size, &r.ModTime)
+		if err != nil {
+			return a, err
+		}
+		a[r.Path] = r
+	}
+	return a, nil
+}
+
+// SourceWatermark is the greatest watermark value read from an
+// incremental source such as an http or sql source, the next run
+// only asks for newer records
+type SourceWatermark struct {
+	Name        string    `json:"name"`
+	Watermark   string    `json:"watermark"`
+	LastUpdated time.Time `json:"lastupdated"`
+}
+
+func (a *SourceWatermark) Upsert(db *sql.DB) error {
+	var UPSERT = "UPSERT INTO sourcewatermark(name, watermark, lastupdated) values($1,$2,now())"
+	stmt, err := db.Prepare(UPSERT)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = stmt.Exec(a.Name, a.Watermark)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetSourceWatermark returns the watermark of a source, an empty
+// watermark is returned for a source not yet read
+func GetSourceWatermark(name string, db *sql.DB) (a SourceWatermark, err error) {
+	a.Name = name
+	row := db.QueryRow("SELECT watermark, lastupdated FROM sourcewatermark where name=$1", name)
+	switch err := row.Scan(&a.Watermark, &a.LastUpdated); err {
+	case sql.ErrNoRows:
+		return a, nil
+	case nil:
+		return a, nil
+	default:
+		return a, err
+	}
+}
+
+// TailOffset is how far a followed file has been read, Inode tells a
+// rotated file from the one the offset belongs to
+type TailOffset struct {
+	WatchDirectoryId string    `json:"watchdirectoryid"`
+	Path             string    `json:"path"`
+	Inode            uint64    `json:"inode"`
+	Offset           int64     `json:"offset"`
+	LastUpdated      time.Time `json:"lastupdated"`
+}
+
+func (a *TailOffset) Upsert(db *sql.DB) error {
+	var UPSERT = "UPSERT INTO tailoffset(watchdirectoryid, path, inode, byteoffset, lastupdated) values($1,$2,$3,$4,now())"
+	stmt, err := db.Prepare(UPSERT)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = stmt.Exec(a.WatchDirectoryId, a.Path, int64(a.Inode), a.Offset)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (a *TailOffset) Delete(db *sql.DB) error {
+	var DELETE = "DELETE FROM tailoffset where watchdirectoryid=$1 and path=$2"
+	stmt, err := db.Prepare(DELETE)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = stmt.Exec(a.WatchDirectoryId, a.Path)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetTailOffsets returns the offsets of the followed files of a
+// watch directory keyed by path
+func GetTailOffsets(watchDirId string, db *sql.DB) (a map[string]TailOffset, err error) {
+
+	a = make(map[string]TailOffset)
+
+	var rows *sql.Rows
+	rows, err = db.Query("SELECT path, inode, byteoffset, lastupdated FROM tailoffset where watchdirectoryid=$1", watchDirId)
+	if err != nil {
+		return a, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := TailOffset{}
+		r.WatchDirectoryId = watchDirId
+		var inode int64
+		err := rows.Scan(&r.Path, &inode, &r.Offset, &r.LastUpdated)
+		if err != nil {
+			return a, err
+		}
+		r.Inode = uint64(inode)
+		a[r.Path] = r
+	}
+	return a, rows.Err()
+}
+
+// SourceSchedule is the cron schedule of a source with the times of
+// its last and next runs, RunRequested asks for a run at the next
+// scheduler tick even when the schedule is paused
+type SourceSchedule struct {
+	Name         string    `json:"name"`
+	Kind         string    `json:"kind"`
+	Cron         string    `json:"cron"`
+	Paused       bool      `json:"paused"`
+	RunRequested bool      `json:"runrequested"`
+	LastRun      time.Time `json:"lastrun"`
+	NextRun      time.Time `json:"nextrun"`
+	LastStatus   string    `json:"laststatus"`
+	LastUpdated  time.Time `json:"lastupdated"`
+}
+
+func (a *SourceSchedule) Upsert(db *sql.DB) error {
+	var UPSERT = "UPSERT INTO sourceschedule(name, kind, cronexpr, paused, runrequested, lastrun, nextrun, laststatus, lastupdated) values($1,$2,$3,$4,$5,$6,$7,$8,now())"
+	stmt, err := db.Prepare(UPSERT)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = stmt.Exec(a.Name, a.Kind, a.Cron, a.Paused, a.RunRequested, a.LastRun, a.NextRun, a.LastStatus)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// UpdateRun records the start of a run, a pending run request is
+// cleared since the run satisfies it
+func (a *SourceSchedule) UpdateRun(db *sql.DB) error {
+	return updateSchedule(db, "UPDATE sourceschedule SET runrequested=false, lastrun=$1, nextrun=$2, laststatus=$3, lastupdated=now() WHERE name=$4", a.LastRun, a.NextRun, a.LastStatus, a.Name)
+}
+
+// UpdateStatus records how the last run ended
+func (a *SourceSchedule) UpdateStatus(db *sql.DB) error {
+	return updateSchedule(db, "UPDATE sourceschedule SET laststatus=$1, lastupdated=now() WHERE name=$2", a.LastStatus, a.Name)
+}
+
+// UpdatePaused pauses or resumes a schedule
+func (a *SourceSchedule) UpdatePaused(db *sql.DB) error {
+	return updateSchedule(db, "UPDATE sourceschedule SET paused=$1, lastupdated=now() WHERE name=$2", a.Paused, a.Name)
+}
+
+// RequestRun asks the scheduler to run a source at its next tick
+func (a *SourceSchedule) RequestRun(db *sql.DB) error {
+	return updateSchedule(db, "UPDATE sourceschedule SET runrequested=true, lastupdated=now() WHERE name=$1", a.Name)
+}
+
+func updateSchedule(db *sql.DB, update string, args ...interface{}) error {
+	stmt, err := db.Prepare(update)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	result, err := stmt.Exec(args...)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("schedule not found")
+	}
+	return nil
+}
+
+// GetSourceSchedule returns the schedule of a source, found is false
+// for a source that was never scheduled
+func GetSourceSchedule(name string, db *sql.DB) (a SourceSchedule, found bool, err error) {
+	a.Name = name
+	row := db.QueryRow("SELECT kind, cronexpr, paused, runrequested, lastrun, nextrun, laststatus, lastupdated FROM sourceschedule where name=$1", name)
+	switch err := row.Scan(&a.Kind, &a.Cron, &a.Paused, &a.RunRequested, &a.LastRun, &a.NextRun, &a.LastStatus, &a.LastUpdated); err {
+	case sql.ErrNoRows:
+		return a, false, nil
+	case nil:
+		return a, true, nil
+	default:
+		return a, false, err
+	}
+}
+
+// GetSourceSchedules returns the schedules of all scheduled sources
+func GetSourceSchedules(db *sql.DB) (a []SourceSchedule, err error) {
+	a = make([]SourceSchedule, 0)
+
+	rows, err := db.Query("SELECT name, kind, cronexpr, paused, runrequested, lastrun, nextrun, laststatus, lastupdated FROM sourceschedule ORDER BY name")
+	if err != nil {
+		return a, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := SourceSchedule{}
+		err := rows.Scan(&r.Name, &r.Kind, &r.Cron, &r.Paused, &r.RunRequested, &r.LastRun, &r.NextRun, &r.LastStatus, &r.LastUpdated)
+		if err != nil {
+			return a, err
+		}
+		a = append(a, r)
+	}
+	return a, rows.Err()
+}
+
+// ExtractCheckpoint is how far the loader has acknowledged the rows
+// of a file being extracted, it is removed once the file is done so
+// a checkpoint left behind marks an interrupted extraction
+type ExtractCheckpoint struct {
+	Path             string `json:"path"`
+	WatchDirectoryId string `json:"watchdirectoryid"`
+	WatchDirName     string `json:"watchdirname"`
+	Scheme           string `json:"scheme"`
+	Tablename        string `json:"tablename"`
+	Dataprov         string `json:"dataprov"`
+	// Size and ModTime are those of the file when its extraction
+	// started, a file that changed since is not resumed
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modtime"`
+	// Rows is the number of data rows acknowledged by the loader,
+	// filtered rows included
+	Rows int64 `json:"rows"`
+	// ChunkSize and Chunks are set when the file is extracted in
+	// parallel chunks, each chunk keeps its own acknowledged rows
+	ChunkSize   int64             `json:"chunksize"`
+	Chunks      []ChunkCheckpoint `json:"chunks"`
+	Resumes     int               `json:"resumes"`
+	LastUpdated time.Time         `json:"lastupdated"`
+}
+
+// ChunkCheckpoint is how far a chunk of a file has been acknowledged
+type ChunkCheckpoint struct {
+	Dataprov string `json:"dataprov"`
+	Rows     int64  `json:"rows"`
+}
+
+// Matches reports whether the checkpoint was written for the file
+// content described by size and modTime
+func (a ExtractCheckpoint) Matches(size int64, modTime time.Time) bool {
+	return a.Size == size && a.ModTime.Equal(modTime)
+}
+
+func (a *ExtractCheckpoint) Upsert(db *sql.DB) error {
+	chunks, err := json.Marshal(a.Chunks)
+	if err != nil {
+		return err
+	}
+
+	var UPSERT = "UPSERT INTO extractcheckpoint(path, watchdirectoryid, watchdirname, scheme, tablename, dataprov, size, modtime, rowoffset, chunksize, chunks, resumes, lastupdated) values($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,now())"
+	stmt, err := db.Prepare(UPSERT)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = stmt.Exec(a.Path, a.WatchDirectoryId, a.WatchDirName, a.Scheme, a.Tablename, a.Dataprov, a.Size, a.ModTime, a.Rows, a.ChunkSize, string(chunks), a.Resumes)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// MarkResumed counts a relaunch of the interrupted extraction, the
+// checkpoint is not stale again until the relaunch had time to run
+func (a *ExtractCheckpoint) MarkResumed(db *sql.DB) error {
+	stmt, err := db.Prepare("UPDATE extractcheckpoint SET resumes=resumes+1, lastupdated=now() WHERE path=$1")
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = stmt.Exec(a.Path)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (a *ExtractCheckpoint) Delete(db *sql.DB) error {
+	var DELETE = "DELETE FROM extractcheckpoint where path=$1"
+	stmt, err := db.Prepare(DELETE)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	_, err = stmt.Exec(a.Path)
+	if err != nil {
+		fmt.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetExtractCheckpoint returns the checkpoint of a file, found is
+// false when the file has no extraction in progress
+func GetExtractCheckpoint(path string, db *sql.DB) (a ExtractCheckpoint, found bool, err error) {
+	a.Path = path
+	var chunks string
+	row := db.QueryRow("SELECT watchdirectoryid, watchdirname, scheme, tablename, dataprov, size, modtime, rowoffset, chunksize, chunks, resumes, lastupdated FROM extractcheckpoint where path=$1", path)
+	switch err := row.Scan(&a.WatchDirectoryId, &a.WatchDirName, &a.Scheme, &a.Tablename, &a.Dataprov, &a.Size, &a.ModTime, &a.Rows, &a.ChunkSize, &chunks, &a.Resumes, &a.LastUpdated); err {
+	case sql.ErrNoRows:
+		return a, false, nil
+	case nil:
+		return a, true, unmarshalChunks(chunks, &a)
+	default:
+		return a, false, err
+	}
+}
+
+func unmarshalChunks(chunks string, a *ExtractCheckpoint) error {
+	if chunks == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(chunks), &a.Chunks)
+}
+
+// GetExtractCheckpoints returns the checkpoints of all the
+// extractions in progress or interrupted
+func GetExtractCheckpoints(db *sql.DB) (a []ExtractCheckpoint, err error) {
+	a = make([]ExtractCheckpoint, 0)
+
+	rows, err := db.Query("SELECT path, watchdirectoryid, watchdirname, scheme, tablename, dataprov, size, modtime, rowoffset, chunksize, chunks, resumes, lastupdated FROM extractcheckpoint")
+	if err != nil {
+		return a, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := ExtractCheckpoint{}
+		var chunks string
+		err := rows.Scan(&r.Path, &r.WatchDirectoryId, &r.WatchDirName, &r.Scheme, &r.Tablename, &r.Dataprov, &r.Size, &r.ModTime, &r.Rows, &r.ChunkSize, &chunks, &r.Resumes, &r.LastUpdated)
+		if err != nil {
+			return a, err
+		}
+		err = unmarshalChunks(chunks, &r)
+		if err != nil {
+			return a, err
+		}
+		a = append(a, r)
+	}
+	return a, rows.Err()
+}
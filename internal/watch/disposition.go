@@ -0,0 +1,192 @@
+package watch
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DispositionRename appends a suffix to a processed file, it is
+	// the default when a watch directory has no disposition
+	DispositionRename = "rename"
+	// DispositionArchive moves a processed file under the archive
+	// path using a year/month/day layout
+	DispositionArchive = "archive"
+	// DispositionDelete removes a processed file
+	DispositionDelete = "delete"
+	// DispositionCompress gzips a processed file in place, the
+	// compressed file is named with CompressedSuffix
+	DispositionCompress = "compress"
+
+	ProcessedSuffix = ".churro-processed"
+	// CompressedSuffix marks a processed file that was compressed
+	CompressedSuffix = ProcessedSuffix + ".gz"
+	// PartialSuffix marks a file still being downloaded into a
+	// watch directory, it is renamed without it once complete
+	PartialSuffix = ".churro-partial"
+
+	archiveDateLayout = "2006/01/02"
+)
+
+// ArchiveDir returns where processed files of the watch directory
+// are archived
+func (a WatchDirectory) ArchiveDir() string {
+	if a.ArchivePath != "" {
+		return a.ArchivePath
+	}
+	return filepath.Join(a.Path, "archive")
+}
+
+// QuarantineDir returns where files of the watch directory that
+// failed extraction are moved
+func (a WatchDirectory) QuarantineDir() string {
+	if a.QuarantinePath != "" {
+		return a.QuarantinePath
+	}
+	return filepath.Join(a.Path, "quarantine")
+}
+
+// DisposeFile applies the disposition policy of the watch directory
+// to a file once extraction is done, a file whose last extraction
+// attempt failed is moved to the quarantine directory instead.  The
+// new path of the file is returned, it is empty if the file was
+// deleted.
+func DisposeFile(dir WatchDirectory, path string, failed bool, now time.Time) (string, error) {
+	if failed {
+		return moveFile(path, dir.QuarantineDir())
+	}
+
+	switch dir.Disposition {
+	case "", DispositionRename:
+		// a file of the same name may have been processed before
+		newPath := uniqueSuffixed(path, ProcessedSuffix)
+		return newPath, os.Rename(path, newPath)
+	case DispositionArchive:
+		return moveFile(path, filepath.Join(dir.ArchiveDir(), now.Format(archiveDateLayout)))
+	case DispositionDelete:
+		return "", os.Remove(path)
+	case DispositionCompress:
+		return compressFile(path)
+	}
+	return path, fmt.Errorf("%s disposition is not recognized", dir.Disposition)
+}
+
+// Processed reports whether a path is a file churro already
+// disposed of or one still being downloaded, neither is extracted
+func Processed(path string) bool {
+	return strings.HasSuffix(path, ProcessedSuffix) || strings.HasSuffix(path, CompressedSuffix) || strings.HasSuffix(path, PartialSuffix)
+}
+
+// ValidDisposition returns an error if the disposition is not
+// one churro knows how to apply
+func ValidDisposition(disposition string) error {
+	switch disposition {
+	case "", DispositionRename, DispositionArchive, DispositionDelete, DispositionCompress:
+		return nil
+	}
+	return fmt.Errorf("%s disposition is not recognized", disposition)
+}
+
+// PruneArchive removes the archived files of the watch directory
+// that are older than its retention period, the age of a file is
+// taken from the date directory it was archived into
+func PruneArchive(dir WatchDirectory, now time.Time) (removed int, err error) {
+	if dir.RetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := now.AddDate(0, 0, -dir.RetentionDays)
+	root := dir.ArchiveDir()
+
+	days, err := filepath.Glob(filepath.Join(root, "*", "*", "*"))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, day := range days {
+		rel, err := filepath.Rel(root, day)
+		if err != nil {
+			continue
+		}
+		archived, err := time.ParseInLocation(archiveDateLayout, filepath.ToSlash(rel), now.Location())
+		if err != nil {
+			// not one of our date directories
+			continue
+		}
+		if !archived.AddDate(0, 0, 1).Before(cutoff) {
+			continue
+		}
+		err = os.RemoveAll(day)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func moveFile(path, toDir string) (string, error) {
+	err := os.MkdirAll(toDir, os.ModePerm)
+	if err != nil {
+		return path, err
+	}
+	newPath := uniquePath(filepath.Join(toDir, filepath.Base(path)))
+	return newPath, os.Rename(path, newPath)
+}
+
+// uniquePath returns path, or when a file already has that name
+// the first free name numbered before the extension
+func uniquePath(path string) string {
+	return uniqueSuffixed(path, "")
+}
+
+// uniqueSuffixed returns path with suffix appended, numbering path
+// like uniquePath when that name is taken so the suffix stays last
+func uniqueSuffixed(path, suffix string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	newPath := path
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(newPath + suffix); os.IsNotExist(err) {
+			return newPath + suffix
+		}
+		newPath = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+}
+
+// compressFile gzips path and removes it, the original is kept
+// unless the compressed copy was completely written
+func compressFile(path string) (string, error) {
+	newPath := uniqueSuffixed(path, CompressedSuffix)
+
+	in, err := os.Open(path)
+	if err != nil {
+		return path, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(newPath)
+	if err != nil {
+		return path, err
+	}
+
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(path)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(newPath)
+		return path, err
+	}
+
+	return newPath, os.Remove(path)
+}
@@ -0,0 +1,183 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDisposeFile(t *testing.T) {
+	now := time.Date(2020, 11, 20, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		disposition string
+		failed      bool
+		want        func(dir WatchDirectory, path string) string
+	}{
+		{"rename", DispositionRename, false, func(dir WatchDirectory, path string) string {
+			return path + ProcessedSuffix
+		}},
+		{"archive", DispositionArchive, false, func(dir WatchDirectory, path string) string {
+			return filepath.Join(dir.ArchiveDir(), "2020", "11", "20", filepath.Base(path))
+		}},
+		{"delete", DispositionDelete, false, func(dir WatchDirectory, path string) string {
+			return ""
+		}},
+		{"compress", DispositionCompress, false, func(dir WatchDirectory, path string) string {
+			return path + CompressedSuffix
+		}},
+		{"quarantine", DispositionDelete, true, func(dir WatchDirectory, path string) string {
+			return filepath.Join(dir.QuarantineDir(), filepath.Base(path))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "churro-dispose")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			path := filepath.Join(tmp, "some.csv")
+			err = ioutil.WriteFile(path, []byte("a,b\n1,2\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := WatchDirectory{Path: tmp, Disposition: tt.disposition}
+			got, err := DisposeFile(dir, path, tt.failed, now)
+			if err != nil {
+				t.Fatalf("DisposeFile: %v", err)
+			}
+			want := tt.want(dir, path)
+			if got != want {
+				t.Fatalf("got path %s, want %s", got, want)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Fatalf("source file %s still exists", path)
+			}
+			if want != "" {
+				if _, err := os.Stat(want); err != nil {
+					t.Fatalf("disposed file missing: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDisposeFileKeepsExisting(t *testing.T) {
+	now := time.Date(2020, 11, 20, 10, 0, 0, 0, time.UTC)
+	tmp, err := ioutil.TempDir("", "churro-dispose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := WatchDirectory{Path: tmp, Disposition: DispositionArchive}
+	var got []string
+	for i := 0; i < 3; i++ {
+		path := filepath.Join(tmp, "some.csv")
+		err = ioutil.WriteFile(path, []byte("a,b\n1,2\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newPath, err := DisposeFile(dir, path, i == 2, now)
+		if err != nil {
+			t.Fatalf("DisposeFile: %v", err)
+		}
+		got = append(got, newPath)
+	}
+
+	day := filepath.Join(dir.ArchiveDir(), "2020", "11", "20")
+	want := []string{filepath.Join(day, "some.csv"), filepath.Join(day, "some-1.csv"), filepath.Join(dir.QuarantineDir(), "some.csv")}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got path %s, want %s", got[i], want[i])
+		}
+	}
+}
+
+func TestDisposeFileKeepsProcessed(t *testing.T) {
+	now := time.Date(2020, 11, 20, 10, 0, 0, 0, time.UTC)
+
+	for disposition, suffix := range map[string]string{DispositionRename: ProcessedSuffix, DispositionCompress: CompressedSuffix} {
+		tmp, err := ioutil.TempDir("", "churro-dispose")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tmp)
+
+		// a file arriving again under the same name keeps the
+		// earlier processed copy
+		dir := WatchDirectory{Path: tmp, Disposition: disposition}
+		path := filepath.Join(tmp, "some.csv")
+		want := []string{path + suffix, filepath.Join(tmp, "some-1.csv") + suffix}
+		for i := range want {
+			err = ioutil.WriteFile(path, []byte("a,b\n1,2\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DisposeFile(dir, path, false, now)
+			if err != nil {
+				t.Fatalf("DisposeFile: %v", err)
+			}
+			if got != want[i] {
+				t.Errorf("%s got path %s, want %s", disposition, got, want[i])
+			}
+		}
+		for _, p := range want {
+			if _, err := os.Stat(p); err != nil {
+				t.Errorf("%s processed file missing: %v", disposition, err)
+			}
+			if !Processed(p) {
+				t.Errorf("%s is not recognized as processed", p)
+			}
+		}
+	}
+}
+
+func TestProcessed(t *testing.T) {
+	for path, want := range map[string]bool{
+		"data.csv":                        false,
+		"data.csv.gz":                     false,
+		"data.csv" + ProcessedSuffix:      true,
+		"data.csv" + CompressedSuffix:     true,
+		"data.csv" + PartialSuffix:        true,
+		"data" + ProcessedSuffix + ".csv": false,
+	} {
+		if got := Processed(path); got != want {
+			t.Errorf("Processed(%s) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestPruneArchive(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "churro-prune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := WatchDirectory{Path: tmp, RetentionDays: 7}
+	for _, day := range []string{"2020/11/01", "2020/11/19"} {
+		err := os.MkdirAll(filepath.Join(dir.ArchiveDir(), day), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := PruneArchive(dir, time.Date(2020, 11, 20, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("PruneArchive: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 day pruned, got %d", removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir.ArchiveDir(), "2020/11/19")); err != nil {
+		t.Fatalf("recent archive day was pruned: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/xid"
+
+	"gitlab.com/churro-group/churro/internal/dataprov"
+)
+
+var (
+	// stableInterval is how long a new file has to go unchanged
+	// before it is hashed for the duplicate check
+	stableInterval = 2 * time.Second
+)
+
+const (
+	// DuplicateReload loads a file whose content was already loaded
+	// as a new file, it is the default when a watch directory has
+	// no duplicate policy
+	DuplicateReload = "reload"
+	// DuplicateSkip leaves a duplicate file unextracted, the file is
+	// disposed of as if it was processed
+	DuplicateSkip = "skip"
+	// DuplicateVersion loads a duplicate file as the next version of
+	// the content it duplicates
+	DuplicateVersion = "version"
+)
+
+// ValidDuplicatePolicy returns an error if the duplicate policy is
+// not one churro knows how to apply
+func ValidDuplicatePolicy(policy string) error {
+	switch policy {
+	case "", DuplicateReload, DuplicateSkip, DuplicateVersion:
+		return nil
+	}
+	return fmt.Errorf("%s duplicate policy is not recognized", policy)
+}
+
+// duplicateDecision returns the policy applied to a file duplicating
+// the content of prev and how it is described in the file history
+func duplicateDecision(dir WatchDirectory, prev dataprov.DataProvenance) (policy, decision string) {
+	switch dir.DuplicatePolicy {
+	case DuplicateSkip:
+		return DuplicateSkip, fmt.Sprintf("skipped, duplicate of %s", prev.Path)
+	case DuplicateVersion:
+		return DuplicateVersion, fmt.Sprintf("version %d of %s", prev.Version+1, prev.Path)
+	}
+	return DuplicateReload, fmt.Sprintf("reloaded, duplicate of %s", prev.Path)
+}
+
+// findDuplicate returns the provenance of the last file loaded with
+// the content of the file at path, a file whose load failed does not
+// count.  A new file may still be being written so it is only
+// hashed once it is stable.
+func (s *Server) findDuplicate(path string) (dataprov.DataProvenance, bool, error) {
+	err := waitStable(path, stableInterval)
+	if err != nil {
+		return dataprov.DataProvenance{}, false, err
+	}
+	hash, _, err := dataprov.HashFile(path)
+	if err != nil {
+		return dataprov.DataProvenance{}, false, err
+	}
+	return dataprov.FindByHash(hash, s.Pi, s.UserDBCreds)
+}
+
+// waitStable returns once the size and modification time of the
+// file at path are unchanged between two checks interval apart
+func waitStable(path string, interval time.Duration) error {
+	prev, err := statFile(path)
+	if err != nil {
+		return err
+	}
+	for {
+		time.Sleep(interval)
+		current, err := statFile(path)
+		if err != nil {
+			return err
+		}
+		if current.Same(prev) {
+			return nil
+		}
+		prev = current
+	}
+}
+
+func statFile(path string) (FileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileState{}, err
+	}
+	return FileState{Path: path, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// skipDuplicate records a skipped duplicate in the file history and
+// disposes of the file so it is not picked up again
+func (s *Server) skipDuplicate(dir WatchDirectory, path, decision string) {
+	s.logger.Infof("%s %s\n", path, decision)
+
+	if s.queueDB != nil {
+		o := ExtractOutcome{
+			Id:               xid.New().String(),
+			WatchDirectoryId: dir.Id,
+			FilePath:         path,
+			Status:           OutcomeSkipped,
+			Decision:         decision,
+		}
+		err := o.Upsert(s.queueDB)
+		if err != nil {
+			s.logger.Errorf("error recording skipped duplicate %s %s\n", path, err.Error())
+		}
+	}
+
+	newPath, err := DisposeFile(dir, path, false, time.Now())
+	if err != nil {
+		s.logger.Errorf("error in disposing of duplicate %s %s\n", path, err.Error())
+		return
+	}
+	s.logger.Infof("disposed of duplicate %s new path %s\n", path, newPath)
+}
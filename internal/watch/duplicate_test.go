@@ -0,0 +1,78 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/churro-group/churro/internal/dataprov"
+)
+
+func TestDuplicateDecision(t *testing.T) {
+	prev := dataprov.DataProvenance{Path: "/data/orders-1.csv", Version: 2}
+
+	tests := []struct {
+		policy   string
+		want     string
+		decision string
+	}{
+		{"", DuplicateReload, "reloaded, duplicate of /data/orders-1.csv"},
+		{DuplicateReload, DuplicateReload, "reloaded, duplicate of /data/orders-1.csv"},
+		{DuplicateSkip, DuplicateSkip, "skipped, duplicate of /data/orders-1.csv"},
+		{DuplicateVersion, DuplicateVersion, "version 3 of /data/orders-1.csv"},
+	}
+	for _, tt := range tests {
+		policy, decision := duplicateDecision(WatchDirectory{DuplicatePolicy: tt.policy}, prev)
+		if policy != tt.want || decision != tt.decision {
+			t.Errorf("policy %q got %s %q", tt.policy, policy, decision)
+		}
+	}
+
+	for _, p := range []string{"", DuplicateReload, DuplicateSkip, DuplicateVersion} {
+		if err := ValidDuplicatePolicy(p); err != nil {
+			t.Errorf("policy %q %v", p, err)
+		}
+	}
+	if ValidDuplicatePolicy("ignore") == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestWaitStable(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "churro-stable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// a file is not hashed while it is still being written
+	path := filepath.Join(tmp, "orders.csv")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer f.Close()
+		for i := 0; i < 3; i++ {
+			time.Sleep(10 * time.Millisecond)
+			f.WriteString("id,amount\n")
+		}
+	}()
+
+	if err := waitStable(path, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 30 {
+		t.Errorf("file was stable at %d bytes", info.Size())
+	}
+
+	if err := waitStable(filepath.Join(tmp, "missing.csv"), time.Millisecond); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,204 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+
+	"github.com/rs/xid"
+	"gitlab.com/churro-group/churro/internal/config"
+	"go.uber.org/zap"
+)
+
+const (
+	KubeExecutorName    = "kubernetes"
+	RoutineExecutorName = "goroutine"
+	ProcessExecutorName = "process"
+)
+
+// Executor runs extractions on behalf of the watch service, the
+// work queue decides when work is started and the executor
+// decides where it runs
+type Executor interface {
+	// Start begins the extraction without waiting for it to finish
+	Start(w ExtractWork) error
+	// Running returns the unfinished extractions keyed by watch
+	// directory id
+	Running() (map[string]int, error)
+	// RunningWork returns the unfinished extractions, only the
+	// ids, watch directory and file of each work are filled in
+	RunningWork() ([]ExtractWork, error)
+	// Outcomes delivers the final outcome of each extraction
+	Outcomes() <-chan ExtractOutcome
+	// Stop cancels the unfinished extractions of a watch
+	// directory or socket
+	Stop(watchDirId string) error
+}
+
+// ExtractFunc runs a single extraction to completion, it should
+// return early when ctx is cancelled
+type ExtractFunc func(ctx context.Context, w ExtractWork) error
+
+// LocalExecutor runs extractions on the same host as churro-watch
+// with a bounded pool, it lets a pipeline run without kubernetes
+type LocalExecutor struct {
+	logger   *zap.SugaredLogger
+	run      ExtractFunc
+	slots    chan struct{}
+	mu       sync.Mutex
+	running  map[string]int
+	inflight map[string]map[string]localRun
+	outcomes chan ExtractOutcome
+}
+
+// localRun is an extraction started by a LocalExecutor
+type localRun struct {
+	work   ExtractWork
+	cancel context.CancelFunc
+}
+
+// NewLocalExecutor creates an executor that runs at most poolSize
+// extractions at once using run
+func NewLocalExecutor(poolSize int, run ExtractFunc, l *zap.SugaredLogger) *LocalExecutor {
+	if poolSize <= 0 {
+		poolSize = DEFAULT_MAX_EXTRACTS
+	}
+	return &LocalExecutor{
+		logger:   l,
+		run:      run,
+		slots:    make(chan struct{}, poolSize),
+		running:  make(map[string]int),
+		inflight: make(map[string]map[string]localRun),
+		outcomes: make(chan ExtractOutcome, 32),
+	}
+}
+
+// Start runs the work in its own goroutine, streaming work is not
+// counted against the pool since it does not finish
+func (e *LocalExecutor) Start(w ExtractWork) error {
+	if !w.Streaming {
+		select {
+		case e.slots <- struct{}{}:
+		default:
+			return fmt.Errorf("local executor pool is full")
+		}
+	}
+
+	o := ExtractOutcome{
+		Id:               xid.New().String(),
+		WatchDirectoryId: w.WatchDirectoryId,
+		FilePath:         w.FilePath,
+		Status:           OutcomeSucceeded,
+		Attempts:         1,
+		WorkId:           w.Id,
+		Decision:         w.Decision,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	e.mu.Lock()
+	e.running[w.WatchDirectoryId]++
+	if e.inflight[w.WatchDirectoryId] == nil {
+		e.inflight[w.WatchDirectoryId] = make(map[string]localRun)
+	}
+	e.inflight[w.WatchDirectoryId][o.Id] = localRun{work: w, cancel: cancel}
+	e.mu.Unlock()
+
+	go func() {
+		err := e.run(ctx, w)
+		if err != nil {
+			e.logger.Errorf("error in local extract of %s %s\n", w.FilePath, err.Error())
+			o.Status = OutcomeFailed
+		}
+
+		e.mu.Lock()
+		e.running[w.WatchDirectoryId]--
+		delete(e.inflight[w.WatchDirectoryId], o.Id)
+		e.mu.Unlock()
+		cancel()
+		if !w.Streaming {
+			<-e.slots
+		}
+
+		e.outcomes <- o
+	}()
+
+	return nil
+}
+
+// Running returns the extractions this executor has in flight
+func (e *LocalExecutor) Running() (map[string]int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	running := make(map[string]int)
+	for k, v := range e.running {
+		if v > 0 {
+			running[k] = v
+		}
+	}
+	return running, nil
+}
+
+// RunningWork returns the work this executor has in flight
+func (e *LocalExecutor) RunningWork() ([]ExtractWork, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	work := make([]ExtractWork, 0)
+	for _, runs := range e.inflight {
+		for _, r := range runs {
+			work = append(work, r.work)
+		}
+	}
+	return work, nil
+}
+
+// Outcomes delivers the outcome of each finished extraction
+func (e *LocalExecutor) Outcomes() <-chan ExtractOutcome {
+	return e.outcomes
+}
+
+// Stop cancels the extractions of a watch directory or socket,
+// each still delivers its outcome once it returns
+func (e *LocalExecutor) Stop(watchDirId string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range e.inflight[watchDirId] {
+		r.cancel()
+	}
+	return nil
+}
+
+// ProcessExtractFunc returns an ExtractFunc that runs the
+// churro-extract binary at command as a subprocess, passing the
+// work through the same environment variables the extract job uses
+func ProcessExtractFunc(command string, svcCertPath, dbCertPath string) ExtractFunc {
+	return func(ctx context.Context, w ExtractWork) error {
+		cmd := exec.CommandContext(ctx, command,
+			"-servicecert", svcCertPath,
+			"-dbcert", dbCertPath,
+			"-debug", "true")
+		cmd.Env = append(os.Environ(),
+			"CHURRO_FILENAME="+w.FilePath,
+			"CHURRO_SCHEME="+w.Scheme,
+			"CHURRO_WATCHDIR_NAME="+w.WatchDirName,
+			"CHURRO_TABLENAME="+w.Tablename,
+			"CHURRO_RESUME="+strconv.FormatBool(w.Resume),
+			"CHURRO_DUPLICATE="+w.Duplicate,
+			"CHURRO_SOURCE_PATH="+w.SourcePath,
+			"CHURRO_SOURCE_VERSION="+w.SourceVersion)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+}
+
+func validScheme(scheme string) error {
+	switch scheme {
+	case config.FinnHubScheme, config.WebSocketScheme, config.HTTPPollScheme, config.SQLScheme, config.CDCScheme, config.TailScheme, config.MQTTScheme, config.KafkaScheme, config.XMLScheme, config.CSVScheme, config.JSONScheme, config.JSONPathScheme, config.XLSXScheme:
+		return nil
+	}
+	return fmt.Errorf("%s scheme is not recognized", scheme)
+}
@@ -0,0 +1,72 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestLocalExecutor(t *testing.T) {
+	l, _ := zap.NewDevelopment()
+	logger := l.Sugar()
+
+	release := make(chan bool)
+	run := func(ctx context.Context, w ExtractWork) error {
+		<-release
+		if w.FilePath == "bad.csv" {
+			return errors.New("extract failed")
+		}
+		return nil
+	}
+
+	e := NewLocalExecutor(1, run, logger)
+
+	t.Run("PoolIsBounded", func(t *testing.T) {
+		err := e.Start(ExtractWork{WatchDirectoryId: "dir1", FilePath: "good.csv"})
+		if err != nil {
+			t.Fatalf("could not start: %v", err)
+		}
+		err = e.Start(ExtractWork{WatchDirectoryId: "dir1", FilePath: "other.csv"})
+		if err == nil {
+			t.Fatal("expected the pool to be full")
+		}
+		running, _ := e.Running()
+		if running["dir1"] != 1 {
+			t.Fatalf("expected 1 running, got %d", running["dir1"])
+		}
+		release <- true
+		o := waitOutcome(t, e)
+		if o.Status != OutcomeSucceeded {
+			t.Fatalf("expected %s, got %s", OutcomeSucceeded, o.Status)
+		}
+	})
+
+	t.Run("FailureOutcome", func(t *testing.T) {
+		err := e.Start(ExtractWork{WatchDirectoryId: "dir1", FilePath: "bad.csv"})
+		if err != nil {
+			t.Fatalf("could not start: %v", err)
+		}
+		release <- true
+		o := waitOutcome(t, e)
+		if o.Status != OutcomeFailed {
+			t.Fatalf("expected %s, got %s", OutcomeFailed, o.Status)
+		}
+		running, _ := e.Running()
+		if len(running) != 0 {
+			t.Fatalf("expected nothing running, got %v", running)
+		}
+	})
+}
+
+func waitOutcome(t *testing.T, e Executor) ExtractOutcome {
+	select {
+	case o := <-e.Outcomes():
+		return o
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for outcome")
+	}
+	return ExtractOutcome{}
+}
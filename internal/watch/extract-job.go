@@ -0,0 +1,441 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	kwatch "k8s.io/apimachinery/pkg/watch"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DEFAULT_BACKOFF_LIMIT        = 3
+	DEFAULT_DEADLINE_SECONDS     = 3600
+	DEFAULT_TTL_SECONDS_FINISHED = 600
+
+	// filePathAnnotation records the extracted file on the job
+	// since the path is not a valid label value
+	filePathAnnotation = "churro.project.io/filepath"
+	// workIdAnnotation records the ExtractWork the job runs
+	workIdAnnotation = "churro.project.io/workid"
+	// decisionAnnotation records how a duplicate file was handled
+	decisionAnnotation = "churro.project.io/decision"
+)
+
+// KubeExecutor runs each extraction as a Job owned by the
+// pipeline, this is the executor used inside a cluster
+type KubeExecutor struct {
+	logger   *zap.SugaredLogger
+	Pi       v1alpha1.Pipeline
+	outcomes chan ExtractOutcome
+}
+
+// NewKubeExecutor creates a Job based executor and starts
+// following the pipeline's extract jobs for their outcomes
+func NewKubeExecutor(pipeline v1alpha1.Pipeline, l *zap.SugaredLogger) *KubeExecutor {
+	e := &KubeExecutor{
+		logger:   l,
+		Pi:       pipeline,
+		outcomes: make(chan ExtractOutcome, 32),
+	}
+
+	go e.watchExtractJobs()
+
+	return e
+}
+
+// Start creates the extract job for the work
+func (e *KubeExecutor) Start(w ExtractWork) error {
+	ns := os.Getenv("CHURRO_NAMESPACE")
+	pipelineName := os.Getenv("CHURRO_PIPELINE")
+	imageName := "registry.gitlab.com/churro-group/churro/churro-extract"
+	ctx := context.TODO()
+
+	client, err := GetKubeClient("")
+	if err != nil {
+		return err
+	}
+
+	// sockets stream until they are stopped so they are
+	// not bound by the job deadline
+	jobCfg := e.Pi.Spec.WatchConfig.ExtractJob
+	if w.Streaming {
+		jobCfg.ActiveDeadlineSeconds = 0
+	}
+
+	job := getJobDefinition(w.FilePath, w.Tablename, w.Scheme, rand.String(4), ns, imageName, pipelineName, w.WatchDirName, w.WatchDirectoryId, jobCfg)
+	job.OwnerReferences = getOwnerReferences(e.Pi)
+	job.Annotations[workIdAnnotation] = w.Id
+	if w.Resume {
+		container := &job.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env, v1.EnvVar{Name: "CHURRO_RESUME", Value: "true"})
+	}
+	if w.Duplicate != "" {
+		job.Annotations[decisionAnnotation] = w.Decision
+		container := &job.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env, v1.EnvVar{Name: "CHURRO_DUPLICATE", Value: w.Duplicate})
+	}
+	if w.SourcePath != "" {
+		container := &job.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env,
+			v1.EnvVar{Name: "CHURRO_SOURCE_PATH", Value: w.SourcePath},
+			v1.EnvVar{Name: "CHURRO_SOURCE_VERSION", Value: w.SourceVersion})
+	}
+	e.logger.Debugf("creating job %s\n", job.Name)
+
+	_, err = client.BatchV1().Jobs(ns).Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Running returns the number of extract jobs that have not yet
+// finished, keyed by watch directory id
+func (e *KubeExecutor) Running() (map[string]int, error) {
+	running := make(map[string]int)
+
+	client, err := GetKubeClient("")
+	if err != nil {
+		return running, err
+	}
+
+	ns := os.Getenv("CHURRO_NAMESPACE")
+	jobs, err := client.BatchV1().Jobs(ns).List(context.TODO(), metav1.ListOptions{LabelSelector: extractJobSelector()})
+	if err != nil {
+		return running, err
+	}
+
+	for _, job := range jobs.Items {
+		if _, finished := jobOutcome(job); !finished {
+			running[job.Labels["watchdirid"]]++
+		}
+	}
+	return running, nil
+}
+
+// RunningWork returns the work of the extract jobs that have not
+// yet finished as recorded on each job
+func (e *KubeExecutor) RunningWork() ([]ExtractWork, error) {
+	client, err := GetKubeClient("")
+	if err != nil {
+		return nil, err
+	}
+
+	ns := os.Getenv("CHURRO_NAMESPACE")
+	jobs, err := client.BatchV1().Jobs(ns).List(context.TODO(), metav1.ListOptions{LabelSelector: extractJobSelector()})
+	if err != nil {
+		return nil, err
+	}
+
+	work := make([]ExtractWork, 0)
+	for _, job := range jobs.Items {
+		if _, finished := jobOutcome(job); !finished {
+			work = append(work, ExtractWork{
+				Id:               job.Annotations[workIdAnnotation],
+				WatchDirectoryId: job.Labels["watchdirid"],
+				FilePath:         job.Annotations[filePathAnnotation],
+			})
+		}
+	}
+	return work, nil
+}
+
+// Outcomes delivers the outcome of each finished extract job
+func (e *KubeExecutor) Outcomes() <-chan ExtractOutcome {
+	return e.outcomes
+}
+
+// Stop deletes the extract jobs of a watch directory or socket
+// along with their pods
+func (e *KubeExecutor) Stop(watchDirId string) error {
+	client, err := GetKubeClient("")
+	if err != nil {
+		return err
+	}
+
+	ns := os.Getenv("CHURRO_NAMESPACE")
+	propagation := metav1.DeletePropagationBackground
+	selector := extractJobSelector() + ",watchdirid=" + watchDirId
+	return client.BatchV1().Jobs(ns).DeleteCollection(context.TODO(), metav1.DeleteOptions{PropagationPolicy: &propagation}, metav1.ListOptions{LabelSelector: selector})
+}
+
+// getOwnerReferences makes the pipeline the owner of an extract
+// job so that deleting the pipeline also removes its jobs
+func getOwnerReferences(pi v1alpha1.Pipeline) []metav1.OwnerReference {
+	if pi.UID == "" {
+		return nil
+	}
+	controller := true
+	return []metav1.OwnerReference{
+		{
+			APIVersion: v1alpha1.GroupVersion.String(),
+			Kind:       "Pipeline",
+			Name:       pi.Name,
+			UID:        pi.UID,
+			Controller: &controller,
+		},
+	}
+}
+
+// getJobDefinition fills out a Job definition, zero values in
+// jobCfg are replaced with the defaults except for the deadline
+// which is left unset when the caller zeroes it
+func getJobDefinition(filePath, tableName, scheme, suffix, namespace, imageName, pipelineName, watchDirName, watchDirId string, jobCfg v1alpha1.ExtractJobConfig) *batchv1.Job {
+	entrypoint := []string{
+		"/usr/local/bin/churro-extract",
+		"-servicecert",
+		"/servicecerts",
+		"-dbcert",
+		"/dbcerts",
+		"-debug",
+		"true",
+	}
+
+	var mode int32
+	//mode = 0620
+	mode = 256
+
+	backoffLimit := jobCfg.BackoffLimit
+	if backoffLimit <= 0 {
+		backoffLimit = DEFAULT_BACKOFF_LIMIT
+	}
+	ttl := jobCfg.TTLSecondsAfterFinished
+	if ttl <= 0 {
+		ttl = DEFAULT_TTL_SECONDS_FINISHED
+	}
+	var deadline *int64
+	if jobCfg.ActiveDeadlineSeconds > 0 {
+		deadline = &jobCfg.ActiveDeadlineSeconds
+	}
+
+	labels := map[string]string{
+		"app":        "churro",
+		"service":    "churro-extract",
+		"pipeline":   pipelineName,
+		"watchdirid": watchDirId,
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("churro-extract-%s", suffix),
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: map[string]string{filePathAnnotation: filePath},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			ActiveDeadlineSeconds:   deadline,
+			TTLSecondsAfterFinished: &ttl,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: v1.PodSpec{
+					ServiceAccountName: "churro",
+					RestartPolicy:      v1.RestartPolicyNever,
+					Containers: []v1.Container{
+						{
+							Name:            "churro-extract",
+							Image:           imageName,
+							ImagePullPolicy: v1.PullIfNotPresent,
+							Command:         entrypoint,
+							VolumeMounts: []v1.VolumeMount{
+								{
+									MountPath: "/dbcerts",
+									Name:      "db-certs",
+									ReadOnly:  true,
+								},
+								{
+									MountPath: "/servicecerts",
+									Name:      "service-certs",
+									ReadOnly:  true,
+								},
+								{
+									MountPath: "/churro",
+									Name:      "churrodata",
+									ReadOnly:  false,
+								},
+							},
+							Env: []v1.EnvVar{
+								{
+									Name: "CHURRO_NAMESPACE",
+									ValueFrom: &v1.EnvVarSource{
+										FieldRef: &v1.ObjectFieldSelector{
+											FieldPath: "metadata.namespace",
+										},
+									},
+								},
+								{
+									Name:  "CHURRO_PIPELINE",
+									Value: pipelineName,
+								},
+								{
+									Name:  "CHURRO_FILENAME",
+									Value: filePath,
+								},
+								{
+									Name:  "CHURRO_SCHEME",
+									Value: scheme,
+								},
+								{
+									Name:  "CHURRO_WATCHDIR_NAME",
+									Value: watchDirName,
+								},
+								{
+									Name:  "CHURRO_TABLENAME",
+									Value: tableName,
+								},
+							},
+						},
+					},
+					Volumes: []v1.Volume{
+						{
+							Name: "db-certs",
+							VolumeSource: v1.VolumeSource{
+								Secret: &v1.SecretVolumeSource{
+									SecretName:  "cockroachdb.client.root",
+									DefaultMode: &mode,
+								},
+							},
+						},
+						{
+							Name: "service-certs",
+							VolumeSource: v1.VolumeSource{
+								Secret: &v1.SecretVolumeSource{
+									SecretName: "churro.client.root",
+								},
+							},
+						},
+						{
+							Name: "churrodata",
+							VolumeSource: v1.VolumeSource{
+								PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+									ClaimName: "churrodata",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func extractJobSelector() string {
+	return fmt.Sprintf("service=churro-extract,pipeline=%s", os.Getenv("CHURRO_PIPELINE"))
+}
+
+// jobOutcome returns the final outcome of a job and whether the
+// job has finished, a job that succeeded after failed attempts
+// is reported as retried
+func jobOutcome(job batchv1.Job) (string, bool) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != v1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			if job.Status.Failed > 0 {
+				return OutcomeRetried, true
+			}
+			return OutcomeSucceeded, true
+		case batchv1.JobFailed:
+			return OutcomeFailed, true
+		}
+	}
+	return "", false
+}
+
+// watchExtractJobs follows the extract jobs of this pipeline and
+// reports each file's final outcome, the jobs are listed before
+// each watch so that jobs which finished while nothing was
+// watching are still reported, and each job is reported once
+func (e *KubeExecutor) watchExtractJobs() {
+	ns := os.Getenv("CHURRO_NAMESPACE")
+	handled := make(map[types.UID]bool)
+
+	for {
+		client, err := GetKubeClient("")
+		if err != nil {
+			e.logger.Errorf("error getting kube client %s\n", err.Error())
+			time.Sleep(queuePollInterval)
+			continue
+		}
+
+		jobs, err := client.BatchV1().Jobs(ns).List(context.TODO(), metav1.ListOptions{LabelSelector: extractJobSelector()})
+		if err != nil {
+			e.logger.Errorf("error listing extract jobs %s\n", err.Error())
+			time.Sleep(queuePollInterval)
+			continue
+		}
+
+		// forget jobs that have since been removed so the set
+		// does not grow with every job the pipeline runs
+		listed := make(map[types.UID]bool, len(jobs.Items))
+		for i := range jobs.Items {
+			listed[jobs.Items[i].UID] = true
+			e.reportJob(&jobs.Items[i], handled)
+		}
+		for uid := range handled {
+			if !listed[uid] {
+				delete(handled, uid)
+			}
+		}
+
+		w, err := client.BatchV1().Jobs(ns).Watch(context.TODO(), metav1.ListOptions{
+			LabelSelector:   extractJobSelector(),
+			ResourceVersion: jobs.ResourceVersion,
+		})
+		if err != nil {
+			e.logger.Errorf("error watching extract jobs %s\n", err.Error())
+			time.Sleep(queuePollInterval)
+			continue
+		}
+
+		for event := range w.ResultChan() {
+			if event.Type != kwatch.Added && event.Type != kwatch.Modified {
+				continue
+			}
+			job, ok := event.Object.(*batchv1.Job)
+			if !ok {
+				continue
+			}
+			e.reportJob(job, handled)
+		}
+		// the api server closes watches periodically, start another
+		w.Stop()
+	}
+}
+
+// reportJob sends the outcome of a finished job that has not
+// already been reported
+func (e *KubeExecutor) reportJob(job *batchv1.Job, handled map[types.UID]bool) {
+	if handled[job.UID] {
+		return
+	}
+	status, finished := jobOutcome(*job)
+	if !finished {
+		return
+	}
+	handled[job.UID] = true
+	e.outcomes <- ExtractOutcome{
+		Id:               job.Name,
+		WatchDirectoryId: job.Labels["watchdirid"],
+		FilePath:         job.Annotations[filePathAnnotation],
+		Status:           status,
+		Attempts:         int(job.Status.Succeeded + job.Status.Failed),
+		WorkId:           job.Annotations[workIdAnnotation],
+		Decision:         job.Annotations[decisionAnnotation],
+	}
+}
@@ -0,0 +1,70 @@
+package watch
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+)
+
+// scheduleWorkPrefix marks the extract work of a scheduled http or
+// sql source so it is not limited as a watch directory
+const scheduleWorkPrefix = "schedule-"
+
+// copyFileSource copies a static file into its watch directory, the
+// copy is named after the run time so each run is extracted as a
+// new file, it returns the path of the copy
+func copyFileSource(src v1alpha1.FileSource, client *http.Client, now time.Time) (string, error) {
+	if src.Path == "" || src.WatchPath == "" {
+		return "", fmt.Errorf("file source %s needs a path and a watch path", src.Name)
+	}
+
+	var r io.ReadCloser
+	base := filepath.Base(src.Path)
+	if strings.HasPrefix(src.Path, "http://") || strings.HasPrefix(src.Path, "https://") {
+		resp, err := client.Get(src.Path)
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return "", fmt.Errorf("file source %s returned %s", src.Name, resp.Status)
+		}
+		r = resp.Body
+		base = path.Base(resp.Request.URL.Path)
+	} else {
+		f, err := os.Open(src.Path)
+		if err != nil {
+			return "", err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	ext := filepath.Ext(base)
+	name := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(base, ext), now.Format("20060102T150405"), ext)
+	localPath := filepath.Join(src.WatchPath, name)
+
+	// the partial copy is ignored by the watch directory until it is
+	// renamed into place
+	dst, err := os.Create(localPath + PartialSuffix)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(dst, r)
+	closeErr := dst.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return localPath, os.Rename(dst.Name(), localPath)
+}
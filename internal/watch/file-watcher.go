@@ -0,0 +1,132 @@
+package watch
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+const (
+	// WatchModeNotify uses filesystem notifications, it is the
+	// default when a watch directory has no mode
+	WatchModeNotify = "notify"
+	// WatchModePoll lists the directory on an interval, it is for
+	// network filesystems that do not deliver notifications
+	WatchModePoll = "poll"
+	// WatchModeTail follows the growing files of the directory and
+	// extracts each new line
+	WatchModeTail = "tail"
+
+	LineParserRegex  = "regex"
+	LineParserJSON   = "json"
+	LineParserLogfmt = "logfmt"
+)
+
+// FileWatcher reports the paths of files that are created or
+// changed in the watch directories added to it
+type FileWatcher interface {
+	Add(dir WatchDirectory) error
+	Events() <-chan string
+	Close() error
+}
+
+// ValidWatchMode returns an error if the mode is not one churro
+// knows how to watch with
+func ValidWatchMode(mode string) error {
+	switch mode {
+	case "", WatchModeNotify, WatchModePoll, WatchModeTail:
+		return nil
+	}
+	return fmt.Errorf("%s watch mode is not recognized", mode)
+}
+
+// ValidLineParser returns an error if a tail mode directory's line
+// parser can not split lines into columns
+func ValidLineParser(dir WatchDirectory) error {
+	if dir.WatchMode != WatchModeTail {
+		return nil
+	}
+	switch dir.LineParser {
+	case LineParserJSON, LineParserLogfmt:
+		return nil
+	case LineParserRegex:
+		r, err := regexp.Compile(dir.LinePattern)
+		if err != nil {
+			return fmt.Errorf("invalid line pattern %v", err)
+		}
+		for _, name := range r.SubexpNames()[1:] {
+			if name != "" {
+				return nil
+			}
+		}
+		return fmt.Errorf("line pattern %s has no named groups", dir.LinePattern)
+	}
+	return fmt.Errorf("%s line parser is not recognized", dir.LineParser)
+}
+
+// NotifyWatcher is a FileWatcher based on fsnotify
+type NotifyWatcher struct {
+	logger  *zap.SugaredLogger
+	watcher *fsnotify.Watcher
+	events  chan string
+}
+
+// NewNotifyWatcher creates a notification based FileWatcher
+func NewNotifyWatcher(l *zap.SugaredLogger) (*NotifyWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &NotifyWatcher{
+		logger:  l,
+		watcher: watcher,
+		events:  make(chan string, 32),
+	}
+
+	go n.run()
+
+	return n, nil
+}
+
+func (n *NotifyWatcher) run() {
+	defer close(n.events)
+	for {
+		select {
+		case event, ok := <-n.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Write == fsnotify.Write {
+				n.logger.Debugf("modified file: %s\n", event.Name)
+			}
+			if event.Op == fsnotify.Create {
+				n.events <- event.Name
+			}
+		case err, ok := <-n.watcher.Errors:
+			if !ok {
+				return
+			}
+			if err != nil {
+				n.logger.Error(err.Error())
+			}
+		}
+	}
+}
+
+// Add starts watching the directory
+func (n *NotifyWatcher) Add(dir WatchDirectory) error {
+	return n.watcher.Add(dir.Path)
+}
+
+// Events delivers the paths of created files
+func (n *NotifyWatcher) Events() <-chan string {
+	return n.events
+}
+
+// Close stops watching
+func (n *NotifyWatcher) Close() error {
+	return n.watcher.Close()
+}
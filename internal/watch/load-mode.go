@@ -0,0 +1,42 @@
+package watch
+
+import (
+	"fmt"
+	"strings"
+
+	"gitlab.com/churro-group/churro/internal/churrodata"
+)
+
+// Load returns how the rows of the directory's files are written to
+// its table, key columns are only kept for the modes that use them
+func (a WatchDirectory) Load() churrodata.Load {
+	l := churrodata.Load{LoadMode: a.LoadMode}
+	if l.LoadMode == "" {
+		l.LoadMode = churrodata.LoadAppend
+	}
+	if l.LoadMode == churrodata.LoadAppend {
+		return l
+	}
+	for _, k := range strings.Split(a.KeyColumns, ",") {
+		k = strings.TrimSpace(k)
+		if k != "" {
+			l.KeyColumns = append(l.KeyColumns, k)
+		}
+	}
+	return l
+}
+
+// ValidLoadMode returns an error if the load mode is not known or
+// is missing the key columns it needs
+func ValidLoadMode(a WatchDirectory) error {
+	switch a.LoadMode {
+	case "", churrodata.LoadAppend:
+		return nil
+	case churrodata.LoadUpsert, churrodata.LoadReplacePartition:
+		if len(a.Load().KeyColumns) == 0 {
+			return fmt.Errorf("%s load mode requires key columns", a.LoadMode)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s load mode is not recognized", a.LoadMode)
+}
@@ -0,0 +1,32 @@
+package watch
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab.com/churro-group/churro/internal/churrodata"
+)
+
+func TestLoadMode(t *testing.T) {
+	tests := []struct {
+		dir   WatchDirectory
+		valid bool
+		load  churrodata.Load
+	}{
+		{WatchDirectory{}, true, churrodata.Load{LoadMode: churrodata.LoadAppend}},
+		{WatchDirectory{LoadMode: churrodata.LoadAppend, KeyColumns: "id"}, true, churrodata.Load{LoadMode: churrodata.LoadAppend}},
+		{WatchDirectory{LoadMode: churrodata.LoadUpsert, KeyColumns: "region, sku"}, true, churrodata.Load{LoadMode: churrodata.LoadUpsert, KeyColumns: []string{"region", "sku"}}},
+		{WatchDirectory{LoadMode: churrodata.LoadReplacePartition, KeyColumns: "day,"}, true, churrodata.Load{LoadMode: churrodata.LoadReplacePartition, KeyColumns: []string{"day"}}},
+		{WatchDirectory{LoadMode: churrodata.LoadUpsert, KeyColumns: " , "}, false, churrodata.Load{LoadMode: churrodata.LoadUpsert}},
+		{WatchDirectory{LoadMode: "merge", KeyColumns: "id"}, false, churrodata.Load{LoadMode: "merge", KeyColumns: []string{"id"}}},
+	}
+	for _, tt := range tests {
+		err := ValidLoadMode(tt.dir)
+		if (err == nil) != tt.valid {
+			t.Errorf("%+v unexpected validation %v", tt.dir, err)
+		}
+		if l := tt.dir.Load(); !reflect.DeepEqual(l, tt.load) {
+			t.Errorf("%+v unexpected load %+v", tt.dir, l)
+		}
+	}
+}
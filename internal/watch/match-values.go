@@ -0,0 +1,89 @@
+package watch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValueMatcher reports whether an extracted value passes an
+// extract rule's MatchValues filter
+type ValueMatcher func(value string) bool
+
+// comparisons are checked longest first so that >= is not read as >
+var comparisons = []string{">=", "<=", "!=", ">", "<", "="}
+
+// CompileMatchValues compiles the MatchValues of an extract rule, it
+// is one of
+//
+//	a,b,c    the value is one of a comma separated list
+//	~expr    the value matches the regular expression expr
+//	>10      the value compares to a number, or to a string when
+//	         the operand is not a number, using >, >=, <, <=, = or !=
+//
+// an empty MatchValues returns a nil matcher and keeps every row
+func CompileMatchValues(matchValues string) (ValueMatcher, error) {
+	m := strings.TrimSpace(matchValues)
+	if m == "" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(m, "~") {
+		re, err := regexp.Compile(m[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid match values regex %q %v", m[1:], err)
+		}
+		return re.MatchString, nil
+	}
+
+	for _, op := range comparisons {
+		if !strings.HasPrefix(m, op) {
+			continue
+		}
+		operand := strings.TrimSpace(m[len(op):])
+		if operand == "" {
+			return nil, fmt.Errorf("match values %q has no value to compare to", m)
+		}
+		num, numErr := strconv.ParseFloat(operand, 64)
+		return func(value string) bool {
+			var c int
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if numErr == nil && err != nil {
+				// a value that is not a number is unequal to one
+				return op == "!="
+			}
+			switch {
+			case numErr == nil && v < num:
+				c = -1
+			case numErr == nil && v > num:
+				c = 1
+			case numErr == nil:
+				c = 0
+			default:
+				c = strings.Compare(value, operand)
+			}
+			switch op {
+			case ">=":
+				return c >= 0
+			case "<=":
+				return c <= 0
+			case "!=":
+				return c != 0
+			case ">":
+				return c > 0
+			case "<":
+				return c < 0
+			}
+			return c == 0
+		}, nil
+	}
+
+	values := make(map[string]bool)
+	for _, v := range strings.Split(m, ",") {
+		values[strings.TrimSpace(v)] = true
+	}
+	return func(value string) bool {
+		return values[strings.TrimSpace(value)]
+	}, nil
+}
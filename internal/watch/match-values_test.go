@@ -0,0 +1,46 @@
+package watch
+
+import "testing"
+
+func TestCompileMatchValues(t *testing.T) {
+	tests := []struct {
+		matchValues string
+		keep        []string
+		skip        []string
+	}{
+		{"NY, CA,TX", []string{"NY", "CA", " TX "}, []string{"WA", "ny", ""}},
+		{"~^[A-Z]{2}-\\d+$", []string{"NY-1", "CA-42"}, []string{"NY1", "ny-1"}},
+		{">10", []string{"10.5", "11", " 100"}, []string{"10", "9", "abc"}},
+		{">= 10", []string{"10", "10.0"}, []string{"9.99"}},
+		{"<0", []string{"-1"}, []string{"0", "1"}},
+		{"!=closed", []string{"open", ""}, []string{"closed"}},
+		{"=3", []string{"3", "3.00"}, []string{"30"}},
+		// an operand that is not a number compares as a string
+		{"<=2020-06-01", []string{"2020-05-31", "2020-06-01"}, []string{"2020-06-02"}},
+	}
+	for _, tt := range tests {
+		m, err := CompileMatchValues(tt.matchValues)
+		if err != nil {
+			t.Fatalf("%s %v", tt.matchValues, err)
+		}
+		for _, v := range tt.keep {
+			if !m(v) {
+				t.Errorf("%s did not match %q", tt.matchValues, v)
+			}
+		}
+		for _, v := range tt.skip {
+			if m(v) {
+				t.Errorf("%s matched %q", tt.matchValues, v)
+			}
+		}
+	}
+
+	if m, err := CompileMatchValues("  "); m != nil || err != nil {
+		t.Error("expected empty match values to keep every row")
+	}
+	for _, bad := range []string{"~[a-", ">", "<= "} {
+		if _, err := CompileMatchValues(bad); err == nil {
+			t.Errorf("expected %q to fail", bad)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package watch
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/objstore"
+)
+
+const (
+	DEFAULT_OBJECT_STORE_INTERVAL    = 300
+	DEFAULT_OBJECT_STORE_NOTIFY_PORT = ":8091"
+
+	// ObjectStoreNotifyPath prefixes the source name in the urls
+	// that bucket notifications are posted to
+	ObjectStoreNotifyPath = "/objectstore/"
+
+	// the keys of an s3 source's credentials secret
+	objectStoreAccessKey = "accessKeyId"
+	objectStoreSecretKey = "secretAccessKey"
+	objectStoreNotifyKey = "notifyToken"
+
+	defaultObjectStoreDownloadPath = "/churro/objectstore"
+
+	// ObjectPathPrefix starts the dataprov source of an object, the
+	// download of an object is removed once it is loaded
+	ObjectPathPrefix = "s3://"
+)
+
+var objectFileRegex = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// ObjectStoreWatcher polls a bucket and queues the extraction of
+// each object version that was not loaded before, the version is
+// recorded on the dataprov of the extraction once it succeeds
+type ObjectStoreWatcher struct {
+	Source v1alpha1.S3Source
+
+	logger       *zap.SugaredLogger
+	regex        *regexp.Regexp
+	downloadPath string
+	wake         chan struct{}
+
+	// secret reads a key of the credentials secret
+	secret func(name, key string) (string, error)
+	// seen reports the object versions already loaded
+	seen    func(path, etag string) (bool, error)
+	enqueue func(ExtractWork) error
+
+	mu          sync.Mutex
+	client      *objstore.Client
+	notifyToken string
+}
+
+// NewObjectStoreWatcher builds the watcher of an s3 source, the
+// credentials are read when it runs
+func NewObjectStoreWatcher(src v1alpha1.S3Source, enqueue func(ExtractWork) error, seen func(path, etag string) (bool, error), l *zap.SugaredLogger) (*ObjectStoreWatcher, error) {
+	if src.Bucket == "" {
+		return nil, fmt.Errorf("s3 source %s has no bucket", src.Name)
+	}
+	regex, err := regexp.Compile(src.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("s3 source %s regex %v", src.Name, err)
+	}
+
+	downloadPath := src.DownloadPath
+	if downloadPath == "" {
+		downloadPath = filepath.Join(defaultObjectStoreDownloadPath, src.Name)
+	}
+
+	return &ObjectStoreWatcher{
+		Source:       src,
+		logger:       l,
+		regex:        regex,
+		downloadPath: downloadPath,
+		wake:         make(chan struct{}, 1),
+		secret:       GetSecretValue,
+		seen:         seen,
+		enqueue:      enqueue,
+	}, nil
+}
+
+// Run polls the bucket on the source interval, and whenever a
+// notification arrives, until ctx is cancelled
+func (w *ObjectStoreWatcher) Run(ctx context.Context) {
+	interval := w.Source.IntervalSeconds
+	if interval <= 0 {
+		interval = DEFAULT_OBJECT_STORE_INTERVAL
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		err := w.poll(ctx)
+		if err != nil {
+			w.logger.Errorf("error polling s3 source %s %s\n", w.Source.Name, err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// Notify asks for a poll without waiting for the interval
+func (w *ObjectStoreWatcher) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// connect reads the credentials secret once it is available
+func (w *ObjectStoreWatcher) connect() (*objstore.Client, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.client != nil {
+		return w.client, nil
+	}
+
+	accessKey, err := w.secret(w.Source.CredentialsSecret, objectStoreAccessKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not read credentials secret %v", err)
+	}
+	secretKey, err := w.secret(w.Source.CredentialsSecret, objectStoreSecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not read credentials secret %v", err)
+	}
+	w.notifyToken, _ = w.secret(w.Source.CredentialsSecret, objectStoreNotifyKey)
+
+	w.client = &objstore.Client{
+		Endpoint:  w.Source.Endpoint,
+		Region:    w.Source.Region,
+		Bucket:    w.Source.Bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		PathStyle: w.Source.PathStyle,
+	}
+	return w.client, nil
+}
+
+// poll lists the bucket and queues the new object versions
+func (w *ObjectStoreWatcher) poll(ctx context.Context) error {
+	client, err := w.connect()
+	if err != nil {
+		return err
+	}
+
+	objects, err := client.List(ctx, w.Source.Prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range objects {
+		if strings.HasSuffix(o.Key, "/") || !w.regex.MatchString(o.Key) {
+			continue
+		}
+		objectPath := w.objectPath(o.Key)
+		seen, err := w.seen(objectPath, o.ETag)
+		if err != nil {
+			return err
+		}
+		if seen {
+			continue
+		}
+
+		// the download of a version is kept until its extraction
+		// succeeds, one whose last attempt failed is left for the
+		// operator to remove
+		filePath := filepath.Join(w.downloadPath, objectFileName(o))
+		if _, err := os.Stat(filePath); err == nil {
+			continue
+		}
+
+		err = w.download(ctx, client, o, filePath)
+		if err != nil {
+			w.logger.Errorf("error downloading %s %s\n", objectPath, err.Error())
+			continue
+		}
+
+		watchDirName := w.Source.WatchDirectory
+		if watchDirName == "" {
+			watchDirName = w.Source.Name
+		}
+		err = w.enqueue(ExtractWork{
+			WatchDirName:  watchDirName,
+			Scheme:        w.Source.Scheme,
+			FilePath:      filePath,
+			Tablename:     w.Source.Tablename,
+			SourcePath:    objectPath,
+			SourceVersion: o.ETag,
+		})
+		if err != nil {
+			os.Remove(filePath)
+			return err
+		}
+		w.logger.Infof("s3 source %s queued %s etag %s\n", w.Source.Name, objectPath, o.ETag)
+	}
+	return nil
+}
+
+// objectFileName is the name of the download of an object version
+func objectFileName(o objstore.Object) string {
+	return objectFileRegex.ReplaceAllString(o.ETag+"-"+strings.ReplaceAll(o.Key, "/", "_"), "_")
+}
+
+// download writes an object version to filePath, it is renamed into
+// place only once complete
+func (w *ObjectStoreWatcher) download(ctx context.Context, client *objstore.Client, o objstore.Object, filePath string) error {
+	err := os.MkdirAll(w.downloadPath, 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filePath + ".part")
+	if err != nil {
+		return err
+	}
+	err = client.Get(ctx, o.Key, f)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filePath)
+}
+
+// objectPath is the dataprov path of an object
+func (w *ObjectStoreWatcher) objectPath(key string) string {
+	return ObjectPathPrefix + w.Source.Bucket + "/" + key
+}
+
+// authorized checks a notification's bearer token, notifications
+// are refused when the secret holds no token
+func (w *ObjectStoreWatcher) authorized(r *http.Request) bool {
+	w.mu.Lock()
+	token := w.notifyToken
+	w.mu.Unlock()
+
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// ServeObjectStoreNotification receives the bucket notifications of
+// an s3 source, such as MinIO or S3 webhooks, and polls it right away
+func (s *Server) ServeObjectStoreNotification(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w, ok := s.ObjectStores[strings.TrimPrefix(r.URL.Path, ObjectStoreNotifyPath)]
+	if !ok {
+		http.Error(rw, "unknown s3 source", http.StatusNotFound)
+		return
+	}
+	if !w.authorized(r) {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	w.Notify()
+	rw.WriteHeader(http.StatusAccepted)
+}
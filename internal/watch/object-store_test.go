@@ -0,0 +1,142 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+)
+
+func TestObjectStoreWatcher(t *testing.T) {
+	etags := map[string]string{"in/a.csv": "etag-a", "in/b.json": "etag-b"}
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("list-type") == "2" {
+			fmt.Fprint(w, "<ListBucketResult>")
+			for key, etag := range etags {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key><ETag>\"%s\"</ETag></Contents>", key, etag)
+			}
+			fmt.Fprint(w, "<Contents><Key>in/</Key></Contents></ListBucketResult>")
+			return
+		}
+		fmt.Fprint(w, "content of "+strings.TrimPrefix(r.URL.Path, "/bucket/"))
+	}))
+	defer store.Close()
+
+	dir, err := ioutil.TempDir("", "objectstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	loaded := make(map[string]bool)
+	queued := make([]ExtractWork, 0)
+	src := v1alpha1.S3Source{
+		Name:              "bucket1",
+		Endpoint:          store.URL,
+		Bucket:            "bucket",
+		Prefix:            "in/",
+		PathStyle:         true,
+		CredentialsSecret: "creds",
+		Regex:             `\.csv$`,
+		Scheme:            "csv",
+		DownloadPath:      dir,
+		Tablename:         "t1",
+	}
+	w, err := NewObjectStoreWatcher(src,
+		func(work ExtractWork) error {
+			queued = append(queued, work)
+			return nil
+		},
+		func(path, etag string) (bool, error) {
+			return loaded[path+" "+etag], nil
+		},
+		zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.secret = func(name, key string) (string, error) {
+		return key + "-value", nil
+	}
+
+	if err := w.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 || queued[0].Scheme != "csv" || queued[0].Tablename != "t1" || queued[0].WatchDirName != "bucket1" {
+		t.Fatalf("unexpected work %+v", queued)
+	}
+	content, err := ioutil.ReadFile(queued[0].FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "content of in/a.csv" {
+		t.Errorf("unexpected content %q", content)
+	}
+	if queued[0].SourcePath != "s3://bucket/in/a.csv" || queued[0].SourceVersion != "etag-a" {
+		t.Errorf("unexpected source %s %s", queued[0].SourcePath, queued[0].SourceVersion)
+	}
+
+	// a version being extracted is not queued again
+	if err := w.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 {
+		t.Fatalf("pending object queued again %+v", queued)
+	}
+
+	// a loaded version is skipped, a new one is extracted again
+	loaded["s3://bucket/in/a.csv etag-a"] = true
+	os.Remove(queued[0].FilePath)
+	if err := w.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 1 {
+		t.Fatalf("loaded object queued again %+v", queued)
+	}
+	etags["in/a.csv"] = "etag-a2"
+	if err := w.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 2 || queued[1].FilePath == queued[0].FilePath {
+		t.Fatalf("new version not queued %+v", queued)
+	}
+}
+
+func TestObjectStoreNotification(t *testing.T) {
+	w, err := NewObjectStoreWatcher(v1alpha1.S3Source{Name: "bucket1", Bucket: "bucket"}, nil, nil, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.notifyToken = "secret"
+	s := &Server{ObjectStores: map[string]*ObjectStoreWatcher{"bucket1": w}}
+
+	post := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		s.ServeObjectStoreNotification(rec, req)
+		return rec.Code
+	}
+
+	if code := post(ObjectStoreNotifyPath+"other", "secret"); code != http.StatusNotFound {
+		t.Errorf("unknown source got %d", code)
+	}
+	if code := post(ObjectStoreNotifyPath+"bucket1", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("bad token got %d", code)
+	}
+	if code := post(ObjectStoreNotifyPath+"bucket1", "secret"); code != http.StatusAccepted {
+		t.Errorf("notification got %d", code)
+	}
+	select {
+	case <-w.wake:
+	default:
+		t.Error("notification did not wake the watcher")
+	}
+}
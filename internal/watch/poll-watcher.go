@@ -0,0 +1,163 @@
+package watch
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DEFAULT_POLL_INTERVAL is the seconds between directory
+	// listings when a polled watch directory has no interval
+	DEFAULT_POLL_INTERVAL = 30
+)
+
+// PollWatcher is a FileWatcher that lists each directory on an
+// interval, the last seen state of each file is persisted so new
+// and changed files are still detected across restarts
+type PollWatcher struct {
+	logger *zap.SugaredLogger
+	db     *sql.DB
+	events chan string
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewPollWatcher creates a polling FileWatcher, the directory
+// snapshots are kept in db when it is not nil
+func NewPollWatcher(db *sql.DB, l *zap.SugaredLogger) *PollWatcher {
+	return &PollWatcher{
+		logger: l,
+		db:     db,
+		events: make(chan string, 32),
+		done:   make(chan struct{}),
+	}
+}
+
+// Add starts polling the directory
+func (p *PollWatcher) Add(dir WatchDirectory) error {
+	snapshot := make(map[string]FileState)
+	if p.db != nil {
+		var err error
+		snapshot, err = GetSnapshot(dir.Id, p.db)
+		if err != nil {
+			return err
+		}
+	}
+
+	go p.poll(dir, snapshot)
+
+	return nil
+}
+
+// Events delivers the paths of new and changed files
+func (p *PollWatcher) Events() <-chan string {
+	return p.events
+}
+
+// Close stops polling
+func (p *PollWatcher) Close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+func (p *PollWatcher) poll(dir WatchDirectory, snapshot map[string]FileState) {
+	interval := dir.PollInterval
+	if interval <= 0 {
+		interval = DEFAULT_POLL_INTERVAL
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	pending := make(map[string]FileState)
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			current, err := scanDirectory(dir)
+			if err != nil {
+				p.logger.Errorf("error polling %s %s\n", dir.Path, err.Error())
+				continue
+			}
+			for _, path := range p.compare(dir, snapshot, pending, current) {
+				p.events <- path
+			}
+		}
+	}
+}
+
+// compare updates the snapshot with the current listing and
+// returns the files that are new or changed, a file is only
+// reported once it is unchanged between two polls so files that
+// are still being copied in are not picked up early
+func (p *PollWatcher) compare(dir WatchDirectory, snapshot, pending, current map[string]FileState) (ready []string) {
+	for path, st := range current {
+		if known, ok := snapshot[path]; ok && known.Same(st) {
+			delete(pending, path)
+			continue
+		}
+		if prev, ok := pending[path]; !ok || !prev.Same(st) {
+			pending[path] = st
+			continue
+		}
+
+		delete(pending, path)
+		snapshot[path] = st
+		if p.db != nil {
+			err := st.Upsert(p.db)
+			if err != nil {
+				p.logger.Errorf("error saving snapshot of %s %s\n", path, err.Error())
+			}
+		}
+		ready = append(ready, path)
+	}
+
+	for path, st := range snapshot {
+		if _, ok := current[path]; ok {
+			continue
+		}
+		delete(snapshot, path)
+		if p.db != nil {
+			err := st.Delete(p.db)
+			if err != nil {
+				p.logger.Errorf("error removing snapshot of %s %s\n", path, err.Error())
+			}
+		}
+	}
+	for path := range pending {
+		if _, ok := current[path]; !ok {
+			delete(pending, path)
+		}
+	}
+
+	return ready
+}
+
+// scanDirectory lists the regular files of a watch directory
+func scanDirectory(dir WatchDirectory) (map[string]FileState, error) {
+	current := make(map[string]FileState)
+
+	infos, err := ioutil.ReadDir(dir.Path)
+	if err != nil {
+		return current, err
+	}
+
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir.Path, info.Name())
+		current[path] = FileState{
+			WatchDirectoryId: dir.Id,
+			Path:             path,
+			Size:             info.Size(),
+			ModTime:          info.ModTime(),
+		}
+	}
+	return current, nil
+}
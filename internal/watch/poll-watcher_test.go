@@ -0,0 +1,52 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestPollWatcherWaitsForStableFiles(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "churro-poll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := WatchDirectory{Id: "1", Path: tmp, WatchMode: WatchModePoll}
+	p := NewPollWatcher(nil, zap.NewNop().Sugar())
+	snapshot := make(map[string]FileState)
+	pending := make(map[string]FileState)
+
+	path := filepath.Join(tmp, "one.csv")
+	if err := ioutil.WriteFile(path, []byte("a,b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	poll := func() []string {
+		current, err := scanDirectory(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.compare(dir, snapshot, pending, current)
+	}
+
+	if ready := poll(); len(ready) != 0 {
+		t.Fatalf("file reported before it was stable %v", ready)
+	}
+	if ready := poll(); len(ready) != 1 || ready[0] != path {
+		t.Fatalf("expected %s to be reported, got %v", path, ready)
+	}
+	if ready := poll(); len(ready) != 0 {
+		t.Fatalf("unchanged file reported again %v", ready)
+	}
+
+	os.Remove(path)
+	poll()
+	if _, ok := snapshot[path]; ok {
+		t.Fatal("removed file still in snapshot")
+	}
+}
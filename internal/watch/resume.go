@@ -0,0 +1,114 @@
+package watch
+
+import (
+	"os"
+	"time"
+)
+
+const (
+	// DEFAULT_MAX_RESUMES is how many times an interrupted
+	// extraction is relaunched before its checkpoint is dropped
+	DEFAULT_MAX_RESUMES = 3
+)
+
+var (
+	// resumeInterval is how often the checkpoints are checked for
+	// interrupted extractions
+	resumeInterval = time.Minute
+
+	// checkpointStaleAfter is how long a checkpoint goes without
+	// being written before its extraction is taken as interrupted,
+	// it is well above how often a running extraction writes it
+	checkpointStaleAfter = 5 * time.Minute
+)
+
+// interruptedCheckpoints returns the checkpoints of the interrupted
+// extractions to relaunch, a checkpoint is interrupted when it went
+// stale while no extraction of its file is running.
+// Checkpoints of files that changed, are gone or were already
+// resumed DEFAULT_MAX_RESUMES times are abandoned instead.
+func interruptedCheckpoints(checkpoints []ExtractCheckpoint, running map[string]bool, now time.Time) (resume, abandoned []ExtractCheckpoint) {
+	for _, cp := range checkpoints {
+		if now.Sub(cp.LastUpdated) < checkpointStaleAfter || running[cp.Path] {
+			continue
+		}
+
+		info, err := os.Stat(cp.Path)
+		if err != nil || !cp.Matches(info.Size(), info.ModTime()) || cp.Resumes >= DEFAULT_MAX_RESUMES {
+			abandoned = append(abandoned, cp)
+			continue
+		}
+		resume = append(resume, cp)
+	}
+	return resume, abandoned
+}
+
+// resumeWork is the work continuing the extraction of a checkpoint
+func resumeWork(cp ExtractCheckpoint, dirs []WatchDirectory) ExtractWork {
+	w := ExtractWork{
+		WatchDirectoryId: cp.WatchDirectoryId,
+		WatchDirName:     cp.WatchDirName,
+		Scheme:           cp.Scheme,
+		FilePath:         cp.Path,
+		Tablename:        cp.Tablename,
+		Resume:           true,
+	}
+	for _, d := range dirs {
+		if d.Id == cp.WatchDirectoryId {
+			w.Priority = d.Priority
+		}
+	}
+	return w
+}
+
+// startResuming periodically relaunches the extractions that were
+// interrupted, for example by their pod being evicted, from their
+// last checkpoint
+func (s *Server) startResuming() {
+	if s.queueDB == nil {
+		return
+	}
+
+	ticker := time.NewTicker(resumeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		checkpoints, err := GetExtractCheckpoints(s.queueDB)
+		if err != nil {
+			s.logger.Errorf("error getting extract checkpoints %s\n", err.Error())
+			continue
+		}
+		if len(checkpoints) == 0 {
+			continue
+		}
+		work, err := s.Executor.RunningWork()
+		if err != nil {
+			s.logger.Errorf("error getting running extracts %s\n", err.Error())
+			continue
+		}
+		running := make(map[string]bool, len(work))
+		for _, w := range work {
+			running[w.FilePath] = true
+		}
+
+		resume, abandoned := interruptedCheckpoints(checkpoints, running, time.Now())
+		for _, cp := range abandoned {
+			s.logger.Infof("not resuming %s after %d resumes, the file changed or is gone\n", cp.Path, cp.Resumes)
+			err := cp.Delete(s.queueDB)
+			if err != nil {
+				s.logger.Errorf("error removing checkpoint %s %s\n", cp.Path, err.Error())
+			}
+		}
+		for _, cp := range resume {
+			err := s.enqueueExtract(resumeWork(cp, s.WatchDirectories))
+			if err != nil {
+				s.logger.Errorf("error queueing resume of %s %s\n", cp.Path, err.Error())
+				continue
+			}
+			s.logger.Infof("resuming interrupted extract of %s after row %d\n", cp.Path, cp.Rows)
+			err = cp.MarkResumed(s.queueDB)
+			if err != nil {
+				s.logger.Errorf("error marking checkpoint %s %s\n", cp.Path, err.Error())
+			}
+		}
+	}
+}
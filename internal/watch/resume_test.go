@@ -0,0 +1,58 @@
+package watch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInterruptedCheckpoints(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "churro-resume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "orders.csv")
+	ioutil.WriteFile(path, []byte("id\n1\n2\n"), 0644)
+	info, _ := os.Stat(path)
+
+	now := time.Now()
+	stale := now.Add(-2 * checkpointStaleAfter)
+	cp := func(dirId string, updated time.Time, resumes int) ExtractCheckpoint {
+		return ExtractCheckpoint{Path: path, WatchDirectoryId: dirId, Scheme: "csv", Size: info.Size(), ModTime: info.ModTime(), Rows: 1, Resumes: resumes, LastUpdated: updated}
+	}
+	changed := cp("dir1", stale, 0)
+	changed.Size++
+	missing := cp("dir1", stale, 0)
+	missing.Path = filepath.Join(tmp, "missing.csv")
+	// another file of the same directory is still being extracted
+	running := cp("dir1", stale, 0)
+	running.Path = filepath.Join(tmp, "running.csv")
+	ioutil.WriteFile(running.Path, []byte("id\n1\n2\n"), 0644)
+	runningInfo, _ := os.Stat(running.Path)
+	running.ModTime = runningInfo.ModTime()
+
+	checkpoints := []ExtractCheckpoint{
+		cp("dir1", now, 0),
+		running,
+		cp("dir1", stale, 1),
+		cp("dir1", stale, DEFAULT_MAX_RESUMES),
+		changed,
+		missing,
+	}
+	resume, abandoned := interruptedCheckpoints(checkpoints, map[string]bool{running.Path: true}, now)
+	if len(resume) != 1 || resume[0].Resumes != 1 {
+		t.Errorf("unexpected checkpoints to resume %+v", resume)
+	}
+	if len(abandoned) != 3 {
+		t.Errorf("unexpected abandoned checkpoints %+v", abandoned)
+	}
+
+	w := resumeWork(resume[0], []WatchDirectory{{Id: "dir1", Priority: 5}})
+	if !w.Resume || w.FilePath != path || w.Priority != 5 || w.Scheme != "csv" {
+		t.Errorf("unexpected work %+v", w)
+	}
+}
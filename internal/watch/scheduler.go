@@ -0,0 +1,208 @@
+package watch
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+const (
+	ScheduleKindHTTP = "http"
+	ScheduleKindSQL  = "sql"
+	ScheduleKindSFTP = "sftp"
+	ScheduleKindFile = "file"
+
+	ScheduleStatusRunning = "running"
+	ScheduleStatusOK      = "ok"
+)
+
+// schedulerInterval is how often the schedules are checked for due
+// runs, it bounds how long a run now request waits
+var schedulerInterval = 15 * time.Second
+
+// ScheduledSource is a source the scheduler runs on its cron
+// schedule, Run performs a single run of the source
+type ScheduledSource struct {
+	Name     string
+	Kind     string
+	Cron     string
+	Run      func() error
+	schedule cron.Schedule
+}
+
+// ParseSchedule parses a standard five field cron expression, the
+// @hourly, @daily and @every descriptors are also accepted
+func ParseSchedule(expr string) (cron.Schedule, error) {
+	sched, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q %v", expr, err)
+	}
+	return sched, nil
+}
+
+// scheduleStore persists the schedules so the run times survive a
+// restart and so that churro-ctl can pause them or request runs
+type scheduleStore interface {
+	Get(name string) (SourceSchedule, bool, error)
+	Save(a SourceSchedule) error
+	Started(a SourceSchedule) error
+	Finished(a SourceSchedule) error
+}
+
+// dbScheduleStore keeps the schedules in the admin database
+type dbScheduleStore struct {
+	db *sql.DB
+}
+
+func (d dbScheduleStore) Get(name string) (SourceSchedule, bool, error) {
+	return GetSourceSchedule(name, d.db)
+}
+
+func (d dbScheduleStore) Save(a SourceSchedule) error { return a.Upsert(d.db) }
+
+func (d dbScheduleStore) Started(a SourceSchedule) error { return a.UpdateRun(d.db) }
+
+func (d dbScheduleStore) Finished(a SourceSchedule) error { return a.UpdateStatus(d.db) }
+
+// Scheduler runs sources on cron schedules, a run that is still
+// going when the source is due again is not started twice
+type Scheduler struct {
+	logger  *zap.SugaredLogger
+	store   scheduleStore
+	mu      sync.Mutex
+	sources []*ScheduledSource
+	running map[string]bool
+}
+
+// NewScheduler creates a scheduler keeping its schedules in the
+// admin database db
+func NewScheduler(db *sql.DB, l *zap.SugaredLogger) *Scheduler {
+	return &Scheduler{
+		logger:  l,
+		store:   dbScheduleStore{db: db},
+		running: make(map[string]bool),
+	}
+}
+
+// Add schedules a source, it fails on an invalid cron expression
+func (s *Scheduler) Add(src ScheduledSource) error {
+	sched, err := ParseSchedule(src.Cron)
+	if err != nil {
+		return err
+	}
+	src.schedule = sched
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources = append(s.sources, &src)
+	return nil
+}
+
+// Len returns the number of scheduled sources
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sources)
+}
+
+// Run checks the schedules until ctx is cancelled, a run missed
+// while churro-watch was down is made once at startup
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	for {
+		s.tick(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick starts the sources that are due at now
+func (s *Scheduler) tick(now time.Time) {
+	s.mu.Lock()
+	sources := make([]*ScheduledSource, len(s.sources))
+	copy(sources, s.sources)
+	s.mu.Unlock()
+
+	for _, src := range sources {
+		sched, found, err := s.store.Get(src.Name)
+		if err != nil {
+			s.logger.Errorf("error reading schedule of %s %s\n", src.Name, err.Error())
+			continue
+		}
+
+		// a new or changed cron expression starts counting from now,
+		// the pause state and past runs are kept
+		if !found || sched.Cron != src.Cron || sched.Kind != src.Kind {
+			sched.Name = src.Name
+			sched.Kind = src.Kind
+			sched.Cron = src.Cron
+			sched.NextRun = src.schedule.Next(now)
+			err = s.store.Save(sched)
+			if err != nil {
+				s.logger.Errorf("error saving schedule of %s %s\n", src.Name, err.Error())
+				continue
+			}
+		}
+
+		due := sched.RunRequested || (!sched.Paused && !now.Before(sched.NextRun))
+		if !due || !s.begin(src.Name) {
+			continue
+		}
+
+		sched.LastRun = now
+		sched.NextRun = src.schedule.Next(now)
+		sched.LastStatus = ScheduleStatusRunning
+		err = s.store.Started(sched)
+		if err != nil {
+			s.logger.Errorf("error saving schedule of %s %s\n", src.Name, err.Error())
+			s.end(src.Name)
+			continue
+		}
+
+		s.logger.Infof("scheduled run of %s source %s, next run %s\n", src.Kind, src.Name, sched.NextRun.Format(time.RFC3339))
+		go s.runSource(src, sched)
+	}
+}
+
+// runSource runs a source and records how the run ended
+func (s *Scheduler) runSource(src *ScheduledSource, sched SourceSchedule) {
+	defer s.end(src.Name)
+
+	sched.LastStatus = ScheduleStatusOK
+	err := src.Run()
+	if err != nil {
+		s.logger.Errorf("error in scheduled run of %s %s\n", src.Name, err.Error())
+		sched.LastStatus = err.Error()
+	}
+	err = s.store.Finished(sched)
+	if err != nil {
+		s.logger.Errorf("error saving schedule of %s %s\n", src.Name, err.Error())
+	}
+}
+
+// begin marks a source as running, it returns false when a run of
+// the source is still going
+func (s *Scheduler) begin(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[name] {
+		return false
+	}
+	s.running[name] = true
+	return true
+}
+
+func (s *Scheduler) end(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, name)
+}
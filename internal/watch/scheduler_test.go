@@ -0,0 +1,238 @@
+package watch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+)
+
+// memScheduleStore keeps schedules in memory the way the admin
+// database does
+type memScheduleStore struct {
+	mu        sync.Mutex
+	schedules map[string]SourceSchedule
+	finished  chan SourceSchedule
+}
+
+func (m *memScheduleStore) Get(name string) (SourceSchedule, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.schedules[name]
+	return a, ok, nil
+}
+
+func (m *memScheduleStore) Save(a SourceSchedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.schedules[a.Name] = a
+	return nil
+}
+
+func (m *memScheduleStore) Started(a SourceSchedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.schedules[a.Name]
+	r.RunRequested = false
+	r.LastRun, r.NextRun, r.LastStatus = a.LastRun, a.NextRun, a.LastStatus
+	m.schedules[a.Name] = r
+	return nil
+}
+
+func (m *memScheduleStore) Finished(a SourceSchedule) error {
+	m.mu.Lock()
+	r := m.schedules[a.Name]
+	r.LastStatus = a.LastStatus
+	m.schedules[a.Name] = r
+	m.mu.Unlock()
+	m.finished <- r
+	return nil
+}
+
+func (m *memScheduleStore) update(name string, f func(a *SourceSchedule)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.schedules[name]
+	f(&r)
+	m.schedules[name] = r
+}
+
+func TestScheduler(t *testing.T) {
+	store := &memScheduleStore{schedules: make(map[string]SourceSchedule), finished: make(chan SourceSchedule, 10)}
+	s := &Scheduler{logger: zap.NewNop().Sugar(), store: store, running: make(map[string]bool)}
+
+	runs := 0
+	fail := false
+	err := s.Add(ScheduledSource{Name: "rates", Kind: ScheduleKindHTTP, Cron: "0 * * * *", Run: func() error {
+		runs++
+		if fail {
+			return fmt.Errorf("source unavailable")
+		}
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(ScheduledSource{Name: "bad", Cron: "every minute"}); err == nil {
+		t.Error("expected an invalid schedule to fail")
+	}
+
+	wait := func() SourceSchedule {
+		select {
+		case r := <-store.finished:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("run did not finish")
+		}
+		return SourceSchedule{}
+	}
+
+	start := time.Date(2020, 6, 1, 10, 30, 0, 0, time.UTC)
+	s.tick(start)
+	r, _, _ := store.Get("rates")
+	if !r.NextRun.Equal(time.Date(2020, 6, 1, 11, 0, 0, 0, time.UTC)) || runs != 0 {
+		t.Fatalf("unexpected schedule %+v after %d runs", r, runs)
+	}
+
+	// due at the next hour
+	s.tick(start.Add(10 * time.Minute))
+	if runs != 0 {
+		t.Fatal("source ran before it was due")
+	}
+	s.tick(start.Add(30 * time.Minute))
+	r = wait()
+	if runs != 1 || r.LastStatus != ScheduleStatusOK || !r.NextRun.Equal(time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected schedule %+v after %d runs", r, runs)
+	}
+
+	// a paused schedule only runs when a run is requested
+	store.update("rates", func(a *SourceSchedule) { a.Paused = true })
+	s.tick(start.Add(2 * time.Hour))
+	if runs != 1 {
+		t.Fatal("paused source ran")
+	}
+	fail = true
+	store.update("rates", func(a *SourceSchedule) { a.RunRequested = true })
+	s.tick(start.Add(2*time.Hour + time.Minute))
+	r = wait()
+	if runs != 2 || r.RunRequested || r.LastStatus != "source unavailable" {
+		t.Fatalf("unexpected schedule %+v after %d runs", r, runs)
+	}
+
+	// a changed cron expression is rescheduled from now
+	s.sources[0].Cron = "15 2 * * *"
+	s.sources[0].schedule, _ = ParseSchedule("15 2 * * *")
+	s.tick(start.Add(3 * time.Hour))
+	r, _, _ = store.Get("rates")
+	if !r.Paused || !r.NextRun.Equal(time.Date(2020, 6, 2, 2, 15, 0, 0, time.UTC)) {
+		t.Errorf("unexpected schedule %+v", r)
+	}
+}
+
+func TestScheduledWork(t *testing.T) {
+	s := &Server{logger: zap.NewNop().Sugar(), Queue: NewWorkQueue(1)}
+	run := s.scheduledWork(ExtractWork{WatchDirectoryId: scheduleWorkPrefix + "rates", WatchDirName: "rates", Scheme: "http-poll"})
+
+	for _, status := range []string{OutcomeSucceeded, OutcomeFailed} {
+		result := make(chan error, 1)
+		go func() { result <- run() }()
+
+		var w ExtractWork
+		for start := time.Now(); ; time.Sleep(time.Millisecond) {
+			var ok bool
+			if w, ok = s.Queue.Next(map[string]int{}, map[string]int{}); ok {
+				break
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("timed out waiting for the scheduled work")
+			}
+		}
+
+		// the run lasts until the extraction it queued finished
+		select {
+		case err := <-result:
+			t.Fatalf("run ended before the outcome %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		s.outcomeArrived(ExtractOutcome{WorkId: w.Id, Status: OutcomeRetried})
+		s.outcomeArrived(ExtractOutcome{WorkId: "other", Status: OutcomeSucceeded})
+		select {
+		case err := <-result:
+			t.Fatalf("run ended on another outcome %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		s.outcomeArrived(ExtractOutcome{WorkId: w.Id, Status: status})
+		select {
+		case err := <-result:
+			if (err == nil) != (status == OutcomeSucceeded) {
+				t.Errorf("outcome %s ended the run with %v", status, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the run")
+		}
+	}
+}
+
+func TestCopyFileSource(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "churro-file-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/lists/codes.csv" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("a,b\n"))
+	}))
+	defer server.Close()
+
+	local := filepath.Join(tmp, "local.csv")
+	ioutil.WriteFile(local, []byte("c,d\n"), 0644)
+	watchPath := filepath.Join(tmp, "watch")
+	os.Mkdir(watchPath, 0755)
+
+	now := time.Date(2020, 6, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		path    string
+		want    string
+		content string
+	}{
+		{server.URL + "/lists/codes.csv", "codes-20200601T103000.csv", "a,b\n"},
+		{local, "local-20200601T103000.csv", "c,d\n"},
+	}
+	for _, tt := range tests {
+		got, err := copyFileSource(v1alpha1.FileSource{Name: "codes", Path: tt.path, WatchPath: watchPath}, server.Client(), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != filepath.Join(watchPath, tt.want) {
+			t.Errorf("unexpected copy %s", got)
+		}
+		content, _ := ioutil.ReadFile(got)
+		if string(content) != tt.content {
+			t.Errorf("unexpected content %q", content)
+		}
+	}
+
+	_, err = copyFileSource(v1alpha1.FileSource{Name: "codes", Path: server.URL + "/missing.csv", WatchPath: watchPath}, server.Client(), now)
+	if err == nil {
+		t.Error("expected a missing file to fail")
+	}
+	infos, _ := ioutil.ReadDir(watchPath)
+	if len(infos) != 2 {
+		t.Errorf("unexpected files in the watch path %d", len(infos))
+	}
+}
@@ -0,0 +1,273 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+)
+
+const (
+	DEFAULT_SFTP_INTERVAL = 300
+	DEFAULT_SFTP_PORT     = "22"
+
+	// the keys of an sftp source's key secret
+	sftpPrivateKey = "privateKey"
+	sftpHostKey    = "hostKey"
+
+	sftpDialTimeout = 30 * time.Second
+)
+
+// RemoteFile is the remote path and version a local file was
+// downloaded from
+type RemoteFile struct {
+	Path    string
+	Version string
+}
+
+// downloads holds the remote files downloaded into watch directories
+// until their extraction finishes, the extraction records the remote
+// file on its dataprov
+type downloads struct {
+	mu    sync.Mutex
+	files map[string]RemoteFile
+}
+
+func (d *downloads) add(localPath string, f RemoteFile) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.files == nil {
+		d.files = make(map[string]RemoteFile)
+	}
+	d.files[localPath] = f
+}
+
+func (d *downloads) get(localPath string) (RemoteFile, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, ok := d.files[localPath]
+	return f, ok
+}
+
+func (d *downloads) remove(localPath string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.files, localPath)
+}
+
+// pending reports whether a version of a remote file is downloaded
+// but its extraction has not finished
+func (d *downloads) pending(f RemoteFile) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, file := range d.files {
+		if file == f {
+			return true
+		}
+	}
+	return false
+}
+
+// SFTPWatcher downloads the new files of a remote SFTP directory
+// into a watch directory where they are extracted like any other
+type SFTPWatcher struct {
+	Source v1alpha1.SFTPSource
+
+	logger *zap.SugaredLogger
+	// secret reads a key of the key secret
+	secret func(name, key string) (string, error)
+	// seen reports the file versions already loaded, downloads
+	// holds those still being extracted
+	seen      func(path, etag string) (bool, error)
+	downloads *downloads
+}
+
+// NewSFTPWatcher builds the watcher of an sftp source, the keys
+// are read on each poll
+func NewSFTPWatcher(src v1alpha1.SFTPSource, seen func(path, etag string) (bool, error), d *downloads, l *zap.SugaredLogger) (*SFTPWatcher, error) {
+	if src.Host == "" || src.Path == "" || src.WatchPath == "" {
+		return nil, fmt.Errorf("sftp source %s needs a host, path and watch path", src.Name)
+	}
+	if _, err := path.Match(src.Glob, ""); err != nil {
+		return nil, fmt.Errorf("sftp source %s glob %v", src.Name, err)
+	}
+	switch src.Disposition {
+	case "", DispositionDelete, DispositionRename:
+	default:
+		return nil, fmt.Errorf("sftp source %s disposition %s is not delete or rename", src.Name, src.Disposition)
+	}
+
+	return &SFTPWatcher{
+		Source:    src,
+		logger:    l,
+		secret:    GetSecretValue,
+		seen:      seen,
+		downloads: d,
+	}, nil
+}
+
+// Run polls the remote directory on the source interval until ctx
+// is cancelled
+func (w *SFTPWatcher) Run(ctx context.Context) {
+	interval := w.Source.IntervalSeconds
+	if interval <= 0 {
+		interval = DEFAULT_SFTP_INTERVAL
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		err := w.poll()
+		if err != nil {
+			w.logger.Errorf("error polling sftp source %s %s\n", w.Source.Name, err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// connect opens an sftp session authenticated with the source keys
+func (w *SFTPWatcher) connect() (*sftp.Client, *ssh.Client, error) {
+	privateKey, err := w.secret(w.Source.KeySecret, sftpPrivateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read key secret %v", err)
+	}
+	hostKey, err := w.secret(w.Source.KeySecret, sftpHostKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read key secret %v", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid private key %v", err)
+	}
+	hostPub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid host key %v", err)
+	}
+
+	addr := w.Source.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DEFAULT_SFTP_PORT)
+	}
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            w.Source.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostPub),
+		Timeout:         sftpDialTimeout,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return client, conn, nil
+}
+
+// poll downloads the remote files not seen before
+func (w *SFTPWatcher) poll() error {
+	client, conn, err := w.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer client.Close()
+
+	infos, err := client.ReadDir(w.Source.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || strings.HasSuffix(info.Name(), ProcessedSuffix) {
+			continue
+		}
+		if w.Source.Glob != "" {
+			if match, _ := path.Match(w.Source.Glob, info.Name()); !match {
+				continue
+			}
+		}
+
+		remotePath := path.Join(w.Source.Path, info.Name())
+		provPath := "sftp://" + w.Source.Host + remotePath
+		version := fmt.Sprintf("%d-%d", info.Size(), info.ModTime().Unix())
+		remoteFile := RemoteFile{Path: provPath, Version: version}
+		if w.downloads.pending(remoteFile) {
+			continue
+		}
+		seen, err := w.seen(provPath, version)
+		if err != nil {
+			return err
+		}
+		if seen {
+			continue
+		}
+
+		// a file sent again under the same name does not overwrite
+		// a copy that is not extracted yet
+		localPath := uniquePath(filepath.Join(w.Source.WatchPath, info.Name()))
+		w.downloads.add(localPath, remoteFile)
+		err = w.download(client, remotePath, localPath)
+		if err != nil {
+			w.downloads.remove(localPath)
+			w.logger.Errorf("error downloading %s %s\n", provPath, err.Error())
+			continue
+		}
+		w.logger.Infof("sftp source %s downloaded %s to %s\n", w.Source.Name, provPath, localPath)
+
+		switch w.Source.Disposition {
+		case DispositionDelete:
+			err = client.Remove(remotePath)
+		case DispositionRename:
+			err = client.Rename(remotePath, remotePath+ProcessedSuffix)
+		}
+		if err != nil {
+			w.logger.Errorf("error in disposing of %s %s\n", provPath, err.Error())
+		}
+	}
+	return nil
+}
+
+// download copies a remote file under a partial name which the watch
+// directory ignores, and renames it into place once complete
+func (w *SFTPWatcher) download(client *sftp.Client, remotePath, localPath string) error {
+	src, err := client.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(localPath + PartialSuffix)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	closeErr := dst.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return err
+	}
+	return os.Rename(dst.Name(), localPath)
+}
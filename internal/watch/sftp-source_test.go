@@ -0,0 +1,182 @@
+package watch
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+)
+
+func newTestKey(t *testing.T) (ssh.Signer, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+// startSFTPServer serves the local filesystem over sftp to the
+// holder of clientKey
+func startSFTPServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) net.Listener {
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, os.ErrPermission
+			}
+			return nil, nil
+		},
+	}
+	cfg.AddHostKey(hostKey)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			nConn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(nConn, cfg)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						for req := range requests {
+							req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+						}
+					}()
+					server, err := sftp.NewServer(channel)
+					if err != nil {
+						return
+					}
+					server.Serve()
+					server.Close()
+				}
+			}()
+		}
+	}()
+	return lis
+}
+
+func TestSFTPWatcher(t *testing.T) {
+	hostKey, _ := newTestKey(t)
+	clientKey, clientPEM := newTestKey(t)
+	lis := startSFTPServer(t, hostKey, clientKey.PublicKey())
+	defer lis.Close()
+
+	remote, err := ioutil.TempDir("", "sftp-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(remote)
+	local, err := ioutil.TempDir("", "sftp-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(local)
+
+	ioutil.WriteFile(filepath.Join(remote, "a.csv"), []byte("1,2\n"), 0644)
+	ioutil.WriteFile(filepath.Join(remote, "b.csv"), []byte("3,4\n"), 0644)
+	ioutil.WriteFile(filepath.Join(remote, "notes.txt"), []byte("skip"), 0644)
+
+	// an earlier a.csv that is not extracted yet is kept
+	ioutil.WriteFile(filepath.Join(local, "a.csv"), []byte("old"), 0644)
+
+	d := &downloads{}
+	src := v1alpha1.SFTPSource{
+		Name:        "partner",
+		Host:        lis.Addr().String(),
+		User:        "churro",
+		Path:        remote,
+		Glob:        "*.csv",
+		KeySecret:   "sftp-keys",
+		WatchPath:   local,
+		Disposition: DispositionRename,
+	}
+	w, err := NewSFTPWatcher(src,
+		func(path, etag string) (bool, error) {
+			return false, nil
+		},
+		d, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.secret = func(name, key string) (string, error) {
+		if key == sftpPrivateKey {
+			return clientPEM, nil
+		}
+		return string(ssh.MarshalAuthorizedKey(hostKey.PublicKey())), nil
+	}
+
+	if err := w.poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, localName := range map[string]string{"a.csv": "a-1.csv", "b.csv": "b.csv"} {
+		content, err := ioutil.ReadFile(filepath.Join(local, localName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(content) != 4 {
+			t.Errorf("unexpected content of %s %q", localName, content)
+		}
+		if _, err := os.Stat(filepath.Join(remote, name+ProcessedSuffix)); err != nil {
+			t.Errorf("remote %s was not renamed %v", name, err)
+		}
+		f, ok := d.get(filepath.Join(local, localName))
+		if !ok || f.Path != "sftp://"+src.Host+filepath.Join(remote, name) {
+			t.Errorf("unexpected remote file of %s %+v", localName, f)
+		}
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(local, "a.csv")); string(content) != "old" {
+		t.Errorf("earlier a.csv was overwritten %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(local, "notes.txt")); !os.IsNotExist(err) {
+		t.Error("file outside the glob was downloaded")
+	}
+	infos, _ := ioutil.ReadDir(local)
+	if len(infos) != 3 {
+		t.Errorf("unexpected local files %d", len(infos))
+	}
+
+	// a host presenting another key is refused
+	otherKey, _ := newTestKey(t)
+	w.secret = func(name, key string) (string, error) {
+		if key == sftpPrivateKey {
+			return clientPEM, nil
+		}
+		return string(ssh.MarshalAuthorizedKey(otherKey.PublicKey())), nil
+	}
+	if err := w.poll(); err == nil {
+		t.Error("expected an unknown host key to fail")
+	}
+}
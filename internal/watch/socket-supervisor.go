@@ -0,0 +1,273 @@
+package watch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	SocketRunning = "running"
+	SocketBackoff = "backoff"
+
+	// socketWorkPrefix marks the extract work of a socket, the
+	// socket name follows it where a watch directory id would be
+	socketWorkPrefix = "socket-"
+
+	// tailSocketPrefix marks the supervised follower of a tail mode
+	// watch directory, socket names may not start with it
+	tailSocketPrefix = "tail-"
+)
+
+// socketInitialBackoff and socketMaxBackoff bound the wait before
+// a socket extractor that exited is started again, the wait
+// doubles on each exit and resets once the socket has streamed
+// for socketStableTime
+var (
+	socketInitialBackoff = time.Second
+	socketMaxBackoff     = 5 * time.Minute
+	socketStableTime     = time.Minute
+)
+
+// SocketStatus describes a supervised socket source
+type SocketStatus struct {
+	Name        string    `json:"name"`
+	Scheme      string    `json:"scheme"`
+	Path        string    `json:"path"`
+	Tablename   string    `json:"tablename"`
+	State       string    `json:"state"`
+	Restarts    int       `json:"restarts"`
+	LastError   string    `json:"lasterror"`
+	LastStarted time.Time `json:"laststarted"`
+	NextRestart time.Time `json:"nextrestart"`
+}
+
+type supervisedSocket struct {
+	// key names the socket in the supervisor
+	key     string
+	socket  v1alpha1.WatchSocket
+	status  SocketStatus
+	workId  string
+	backoff time.Duration
+	timer   *time.Timer
+}
+
+// SocketSupervisor keeps an extractor running for each socket
+// source, restarting it with exponential backoff when it exits
+type SocketSupervisor struct {
+	logger   *zap.SugaredLogger
+	executor Executor
+	mu       sync.Mutex
+	sockets  map[string]*supervisedSocket
+}
+
+// NewSocketSupervisor creates a supervisor that starts socket
+// extractors with executor
+func NewSocketSupervisor(executor Executor, l *zap.SugaredLogger) *SocketSupervisor {
+	return &SocketSupervisor{
+		logger:   l,
+		executor: executor,
+		sockets:  make(map[string]*supervisedSocket),
+	}
+}
+
+// socketWorkId is the watch directory id used for a socket's work
+func socketWorkId(name string) string {
+	return socketWorkPrefix + name
+}
+
+// isSocketWork reports whether an extraction belongs to a socket
+func isSocketWork(watchDirId string) bool {
+	return strings.HasPrefix(watchDirId, socketWorkPrefix)
+}
+
+// Add starts supervising a socket, a socket whose extractor is
+// already running, for example from before a restart of
+// churro-watch, is adopted rather than started again
+func (s *SocketSupervisor) Add(socket v1alpha1.WatchSocket) error {
+	if socket.Name == "" {
+		return fmt.Errorf("socket name is empty")
+	}
+	if strings.HasPrefix(socket.Name, tailSocketPrefix) {
+		return fmt.Errorf("socket name %s can not start with %s", socket.Name, tailSocketPrefix)
+	}
+	return s.add(socket.Name, socket)
+}
+
+// AddTail supervises the follower of a tail mode watch directory,
+// it is kept apart from the sockets so the names never collide
+func (s *SocketSupervisor) AddTail(socket v1alpha1.WatchSocket) error {
+	if socket.Name == "" {
+		return fmt.Errorf("watch directory name is empty")
+	}
+	return s.add(tailSocketPrefix+socket.Name, socket)
+}
+
+func (s *SocketSupervisor) add(key string, socket v1alpha1.WatchSocket) error {
+	err := validScheme(socket.Scheme)
+	if err != nil {
+		return err
+	}
+
+	// the work id becomes the watchdirid label of the extract job
+	if errs := validation.IsValidLabelValue(socketWorkId(key)); len(errs) > 0 {
+		return fmt.Errorf("socket name %s is not usable: %s", key, strings.Join(errs, ", "))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sockets[key]; ok {
+		return fmt.Errorf("socket %s is already being watched", key)
+	}
+
+	ss := &supervisedSocket{
+		key:     key,
+		socket:  socket,
+		backoff: socketInitialBackoff,
+		status: SocketStatus{
+			Name:      key,
+			Scheme:    socket.Scheme,
+			Path:      socket.Path,
+			Tablename: socket.Tablename,
+		},
+	}
+	s.sockets[key] = ss
+
+	// keep the running extractor's work id so that outcomes of
+	// earlier extractors are not taken as its exit
+	running, err := s.executor.RunningWork()
+	if err == nil {
+		for _, w := range running {
+			if w.WatchDirectoryId != socketWorkId(key) {
+				continue
+			}
+			s.logger.Infof("socket %s extractor is already running\n", key)
+			ss.workId = w.Id
+			ss.status.State = SocketRunning
+			ss.status.LastStarted = time.Now()
+			return nil
+		}
+	}
+
+	s.start(ss)
+
+	return nil
+}
+
+// Remove stops supervising a socket and stops its extractor
+func (s *SocketSupervisor) Remove(name string) error {
+	if strings.HasPrefix(name, tailSocketPrefix) {
+		return fmt.Errorf("%s follows a tail mode watch directory", name)
+	}
+
+	s.mu.Lock()
+	ss, ok := s.sockets[name]
+	if ok {
+		if ss.timer != nil {
+			ss.timer.Stop()
+		}
+		delete(s.sockets, name)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("socket %s is not being watched", name)
+	}
+
+	return s.executor.Stop(socketWorkId(name))
+}
+
+// Status returns the state of each supervised socket
+func (s *SocketSupervisor) Status() []SocketStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]SocketStatus, 0, len(s.sockets))
+	for _, ss := range s.sockets {
+		list = append(list, ss.status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Exited handles the outcome of a socket extractor, a new
+// extractor is scheduled after the socket's backoff
+func (s *SocketSupervisor) Exited(o ExtractOutcome) {
+	name := strings.TrimPrefix(o.WatchDirectoryId, socketWorkPrefix)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ss, ok := s.sockets[name]
+	if !ok || ss.status.State != SocketRunning {
+		return
+	}
+	// outcomes of extractors started before the current one
+	if o.WorkId != ss.workId {
+		return
+	}
+
+	s.logger.Infof("socket %s extractor exited %s\n", name, o.Status)
+	if o.Status != OutcomeSucceeded {
+		ss.status.LastError = fmt.Sprintf("extractor %s", o.Status)
+	}
+	if time.Since(ss.status.LastStarted) >= socketStableTime {
+		ss.backoff = socketInitialBackoff
+	}
+	s.scheduleRestart(ss)
+}
+
+// start runs a new extractor for the socket, the caller holds mu
+func (s *SocketSupervisor) start(ss *supervisedSocket) {
+	ss.workId = xid.New().String()
+	w := ExtractWork{
+		Id:               ss.workId,
+		WatchDirectoryId: socketWorkId(ss.key),
+		WatchDirName:     ss.socket.Name,
+		Scheme:           ss.socket.Scheme,
+		FilePath:         ss.socket.Path,
+		Tablename:        ss.socket.Tablename,
+		Streaming:        true,
+	}
+
+	ss.status.LastStarted = time.Now()
+	ss.status.NextRestart = time.Time{}
+	err := s.executor.Start(w)
+	if err != nil {
+		s.logger.Errorf("error starting socket %s extractor %s\n", ss.key, err.Error())
+		ss.status.LastError = err.Error()
+		s.scheduleRestart(ss)
+		return
+	}
+	ss.status.State = SocketRunning
+}
+
+// scheduleRestart waits out the socket's backoff before starting
+// it again, the caller holds mu
+func (s *SocketSupervisor) scheduleRestart(ss *supervisedSocket) {
+	wait := ss.backoff
+	ss.backoff *= 2
+	if ss.backoff > socketMaxBackoff {
+		ss.backoff = socketMaxBackoff
+	}
+
+	ss.status.State = SocketBackoff
+	ss.status.NextRestart = time.Now().Add(wait)
+	ss.timer = time.AfterFunc(wait, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.sockets[ss.key] != ss {
+			return
+		}
+		ss.status.Restarts++
+		s.start(ss)
+	})
+}
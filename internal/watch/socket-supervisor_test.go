@@ -0,0 +1,145 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestSocketSupervisor(t *testing.T) {
+	socketInitialBackoff = 10 * time.Millisecond
+	logger := zap.NewNop().Sugar()
+
+	started := make(chan ExtractWork, 4)
+	run := func(ctx context.Context, w ExtractWork) error {
+		started <- w
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	e := NewLocalExecutor(1, run, logger)
+	sup := NewSocketSupervisor(e, logger)
+	go func() {
+		for o := range e.Outcomes() {
+			sup.Exited(o)
+		}
+	}()
+
+	socket := v1alpha1.WatchSocket{Name: "stocks", Scheme: config.FinnHubScheme, Path: "wss://example"}
+	if err := sup.Add(socket); err != nil {
+		t.Fatal(err)
+	}
+	if err := sup.Add(socket); err == nil {
+		t.Fatal("expected duplicate socket to be rejected")
+	}
+	if err := sup.Add(v1alpha1.WatchSocket{Name: "us stocks/eu", Scheme: config.FinnHubScheme}); err == nil {
+		t.Fatal("expected a socket name that is not a valid label value to be rejected")
+	}
+	waitStarted(t, started)
+
+	// the extractor exiting is followed by a restart
+	e.Stop(socketWorkId("stocks"))
+	waitStarted(t, started)
+	if st := sup.Status(); len(st) != 1 || st[0].Restarts != 1 || st[0].State != SocketRunning {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	// a removed socket is not restarted
+	if err := sup.Remove("stocks"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-started:
+		t.Fatal("removed socket was restarted")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if st := sup.Status(); len(st) != 0 {
+		t.Fatalf("expected no sockets, got %+v", st)
+	}
+}
+
+func TestSocketSupervisorAdopt(t *testing.T) {
+	socketInitialBackoff = 10 * time.Millisecond
+	logger := zap.NewNop().Sugar()
+
+	started := make(chan ExtractWork, 4)
+	run := func(ctx context.Context, w ExtractWork) error {
+		started <- w
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	e := NewLocalExecutor(1, run, logger)
+	sup := NewSocketSupervisor(e, logger)
+	defer e.Stop(socketWorkId("stocks"))
+
+	// an extractor left running from before a restart is adopted
+	err := e.Start(ExtractWork{Id: "earlier", WatchDirectoryId: socketWorkId("stocks"), Streaming: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(t, started)
+	if err := sup.Add(v1alpha1.WatchSocket{Name: "stocks", Scheme: config.FinnHubScheme, Path: "wss://example"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a replayed outcome of an older extractor is not its exit
+	sup.Exited(ExtractOutcome{WatchDirectoryId: socketWorkId("stocks"), WorkId: "older", Status: OutcomeFailed})
+	select {
+	case <-started:
+		t.Fatal("a second extractor was started")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	sup.Exited(ExtractOutcome{WatchDirectoryId: socketWorkId("stocks"), WorkId: "earlier", Status: OutcomeFailed})
+	waitStarted(t, started)
+}
+
+func TestSocketSupervisorTail(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+
+	started := make(chan ExtractWork, 4)
+	run := func(ctx context.Context, w ExtractWork) error {
+		started <- w
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	e := NewLocalExecutor(2, run, logger)
+	sup := NewSocketSupervisor(e, logger)
+	defer e.Stop(socketWorkId("logs"))
+	defer e.Stop(socketWorkId(tailSocketPrefix + "logs"))
+
+	// a tail directory and a socket of the same name do not collide
+	err := sup.AddTail(v1alpha1.WatchSocket{Name: "logs", Scheme: config.TailScheme, Path: "/tmp/logs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := waitStarted(t, started)
+	if w.WatchDirName != "logs" || w.WatchDirectoryId != socketWorkId(tailSocketPrefix+"logs") {
+		t.Errorf("unexpected tail work %+v", w)
+	}
+	err = sup.Add(v1alpha1.WatchSocket{Name: "logs", Scheme: config.FinnHubScheme, Path: "wss://example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(t, started)
+
+	if err := sup.Add(v1alpha1.WatchSocket{Name: tailSocketPrefix + "logs", Scheme: config.FinnHubScheme}); err == nil {
+		t.Error("expected a socket named like a tail follower to be rejected")
+	}
+	if err := sup.Remove(tailSocketPrefix + "logs"); err == nil {
+		t.Error("expected removing a tail follower to be rejected")
+	}
+}
+
+func waitStarted(t *testing.T, started chan ExtractWork) ExtractWork {
+	select {
+	case w := <-started:
+		return w
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for socket extractor")
+	}
+	return ExtractWork{}
+}
@@ -3,27 +3,32 @@ package watch
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/rs/xid"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	cruntime "sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/yaml"
 
-	"github.com/fsnotify/fsnotify"
 	"gitlab.com/churro-group/churro/api/v1alpha1"
+	"gitlab.com/churro-group/churro/internal"
 	"gitlab.com/churro-group/churro/internal/config"
+	"gitlab.com/churro-group/churro/internal/dataprov"
 	pb "gitlab.com/churro-group/churro/rpc/watch"
 
 	"os"
 
 	"go.uber.org/zap"
-	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -31,6 +36,14 @@ const (
 	DEFAULT_PORT = ":8087"
 )
 
+// queuePollInterval is how often the work queue is checked for
+// extractions that can be started
+var queuePollInterval = 5 * time.Second
+
+// pruneInterval is how often archived files are checked against
+// their watch directory retention period
+var pruneInterval = time.Hour
+
 // Server implements the watch service
 type Server struct {
 	logger           *zap.SugaredLogger
@@ -39,6 +52,18 @@ type Server struct {
 	DBCreds          config.DBCredentials
 	UserDBCreds      config.DBCredentials
 	WatchDirectories []WatchDirectory
+	Queue            *WorkQueue
+	Executor         Executor
+	Sockets          *SocketSupervisor
+	ObjectStores     map[string]*ObjectStoreWatcher
+	Scheduler        *Scheduler
+	queueDB          *sql.DB
+	// downloads are the sftp files not extracted yet
+	downloads downloads
+	// awaiting holds the scheduled runs waiting on the outcome of
+	// the work they queued, by work id
+	awaitMu  sync.Mutex
+	awaiting map[string]chan ExtractOutcome
 }
 
 func (s *Server) Ping(ctx context.Context, size *pb.PingRequest) (hat *pb.PingResponse, err error) {
@@ -47,8 +72,9 @@ func (s *Server) Ping(ctx context.Context, size *pb.PingRequest) (hat *pb.PingRe
 
 // NewWatchServer creates a watch server and returns
 // a pointer to it.  The server is built based on the configuration
-// passed to it.
-func NewWatchServer(debug bool, svcCreds config.ServiceCredentials, pipeline v1alpha1.Pipeline, l *zap.SugaredLogger, userDBCreds config.DBCredentials, dbCreds config.DBCredentials) *Server {
+// passed to it.  Extractions are run by executor, when it is nil
+// each extraction runs as a kubernetes Job.
+func NewWatchServer(debug bool, svcCreds config.ServiceCredentials, pipeline v1alpha1.Pipeline, l *zap.SugaredLogger, userDBCreds config.DBCredentials, dbCreds config.DBCredentials, executor Executor) *Server {
 
 	s := &Server{
 		logger:       l,
@@ -56,10 +82,33 @@ func NewWatchServer(debug bool, svcCreds config.ServiceCredentials, pipeline v1a
 		UserDBCreds:  userDBCreds,
 		DBCreds:      dbCreds,
 		Pi:           pipeline,
+		Queue:        NewWorkQueue(pipeline.Spec.WatchConfig.MaxConcurrentExtracts),
+		Executor:     executor,
+	}
+
+	if s.Executor == nil {
+		s.Executor = NewKubeExecutor(pipeline, l)
+	}
+	s.Sockets = NewSocketSupervisor(s.Executor, l)
+
+	pgConnectString := s.DBCreds.GetDBConnectString(s.Pi.Spec.AdminDataSource)
+	db, err := sql.Open("postgres", pgConnectString)
+	if err != nil {
+		s.logger.Errorf("error opening admin db for work queue %s\n", err.Error())
 	}
+	s.queueDB = db
+	s.Scheduler = NewScheduler(db, l)
+
+	go s.recordOutcomes()
 
 	go s.startSocketProcessing()
 
+	s.startObjectStores()
+
+	s.startSFTPSources()
+
+	s.startScheduler()
+
 	go s.startWatching()
 
 	s.logger.Infof("watch service started %s\n", DEFAULT_PORT)
@@ -72,221 +121,287 @@ func (s *Server) startSocketProcessing() {
 	s.logger.Info("watching the following sockets...")
 	for _, socket := range sockets {
 		s.logger.Infof("socket %v\n", socket)
-		err := s.createExtractPod(socket.Scheme, socket.Path, s.Pi, socket.Tablename, "")
+		err := s.Sockets.Add(socket)
+		if err != nil {
+			s.logger.Errorf("error in socket %s %s\n", socket.Name, err.Error())
+		}
+	}
+
+	// polled http and sql sources without a schedule, cdc, mqtt and kafka sources run until stopped like a socket,
+	// the extractor reads the rest of the source from the pipeline
+	for _, src := range s.Pi.Spec.HTTPSources {
+		if src.Schedule != "" {
+			continue
+		}
+		s.logger.Infof("http source %s %s\n", src.Name, src.URL)
+		err := s.Sockets.Add(v1alpha1.WatchSocket{
+			Name:      src.Name,
+			Path:      src.URL,
+			Scheme:    config.HTTPPollScheme,
+			Tablename: src.Tablename,
+		})
+		if err != nil {
+			s.logger.Errorf("error in http source %s %s\n", src.Name, err.Error())
+		}
+	}
+	for _, src := range s.Pi.Spec.SQLSources {
+		if src.Schedule != "" {
+			continue
+		}
+		s.logger.Infof("sql source %s\n", src.Name)
+		err := s.Sockets.Add(v1alpha1.WatchSocket{
+			Name:      src.Name,
+			Path:      src.Name,
+			Scheme:    config.SQLScheme,
+			Tablename: src.Tablename,
+		})
+		if err != nil {
+			s.logger.Errorf("error in sql source %s %s\n", src.Name, err.Error())
+		}
+	}
+	for _, src := range s.Pi.Spec.CDCSources {
+		s.logger.Infof("cdc source %s\n", src.Name)
+		err := s.Sockets.Add(v1alpha1.WatchSocket{
+			Name:      src.Name,
+			Path:      src.Table,
+			Scheme:    config.CDCScheme,
+			Tablename: src.Tablename,
+		})
+		if err != nil {
+			s.logger.Errorf("error in cdc source %s %s\n", src.Name, err.Error())
+		}
+	}
+	for _, src := range s.Pi.Spec.MQTTSources {
+		s.logger.Infof("mqtt source %s %s\n", src.Name, src.Broker)
+		err := s.Sockets.Add(v1alpha1.WatchSocket{
+			Name:      src.Name,
+			Path:      src.Broker,
+			Scheme:    config.MQTTScheme,
+			Tablename: src.Tablename,
+		})
+		if err != nil {
+			s.logger.Errorf("error in mqtt source %s %s\n", src.Name, err.Error())
+		}
+	}
+	for _, src := range s.Pi.Spec.KafkaSources {
+		s.logger.Infof("kafka source %s %s\n", src.Name, src.Topic)
+		err := s.Sockets.Add(v1alpha1.WatchSocket{
+			Name:      src.Name,
+			Path:      src.Topic,
+			Scheme:    config.KafkaScheme,
+			Tablename: src.Tablename,
+		})
 		if err != nil {
-			s.logger.Errorf("error createExtractPod %s\n", err.Error())
+			s.logger.Errorf("error in kafka source %s %s\n", src.Name, err.Error())
 		}
 	}
 
 }
 
-func (s *Server) startWatching() {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		s.logger.Errorf("error in watcher %s\n", err.Error())
-		os.Exit(1)
-	}
-	defer watcher.Close()
+// startObjectStores polls each s3 source, the object versions are
+// recorded in dataprov once loaded so each is only extracted once
+func (s *Server) startObjectStores() {
+	s.ObjectStores = make(map[string]*ObjectStoreWatcher)
 
-	done := make(chan bool)
+	for _, src := range s.Pi.Spec.S3Sources {
+		w, err := NewObjectStoreWatcher(src, s.enqueueExtract, s.remoteSeen, s.logger)
+		if err != nil {
+			s.logger.Errorf("error in s3 source %s %s\n", src.Name, err.Error())
+			continue
+		}
+		s.logger.Infof("s3 source %s %s/%s\n", src.Name, src.Bucket, src.Prefix)
+		s.ObjectStores[src.Name] = w
+		go w.Run(context.Background())
+	}
+}
 
-	// TODO totally refactor this select to use the regex that is
-	// in the CR watch configurations instead of them being
-	// hard-coded here
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
-				//log.Infof("event: %v", event)
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					s.logger.Debugf("modified file: %s\n", event.Name)
-				}
-				if event.Op == fsnotify.Create {
-					filePath := event.Name
-					err := s.createExtractPodForNewFile(filePath)
-					if err != nil {
-						s.logger.Error(err.Error())
-					}
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				if err != nil {
-					s.logger.Error(err.Error())
-				}
+// startSFTPSources polls each sftp source, the downloaded files are
+// picked up by the watch directory they land in and their remote
+// path recorded on the dataprov of the extraction
+func (s *Server) startSFTPSources() {
+	for _, src := range s.Pi.Spec.SFTPSources {
+		w, err := NewSFTPWatcher(src, s.remoteSeen, &s.downloads, s.logger)
+		if err != nil {
+			s.logger.Errorf("error in sftp source %s %s\n", src.Name, err.Error())
+			continue
+		}
+		s.logger.Infof("sftp source %s %s:%s\n", src.Name, src.Host, src.Path)
+		if src.Schedule != "" {
+			err = s.Scheduler.Add(ScheduledSource{Name: src.Name, Kind: ScheduleKindSFTP, Cron: src.Schedule, Run: w.poll})
+			if err != nil {
+				s.logger.Errorf("error in sftp source %s %s\n", src.Name, err.Error())
 			}
+			continue
 		}
-	}()
-
-	s.createWatchedDirectories(watcher)
+		go w.Run(context.Background())
+	}
+}
 
-	<-done
+// startScheduler schedules the http, sql and file sources that have
+// a cron schedule and starts the scheduler, a scheduled http or sql
+// source is queued as an extraction that reads the source once
+func (s *Server) startScheduler() {
+	for _, src := range s.Pi.Spec.HTTPSources {
+		if src.Schedule == "" {
+			continue
+		}
+		w := ExtractWork{
+			WatchDirectoryId: scheduleWorkPrefix + src.Name,
+			WatchDirName:     src.Name,
+			Scheme:           config.HTTPPollScheme,
+			FilePath:         src.URL,
+			Tablename:        src.Tablename,
+		}
+		err := s.Scheduler.Add(ScheduledSource{Name: src.Name, Kind: ScheduleKindHTTP, Cron: src.Schedule, Run: s.scheduledWork(w)})
+		if err != nil {
+			s.logger.Errorf("error in http source %s %s\n", src.Name, err.Error())
+		}
+	}
+	for _, src := range s.Pi.Spec.SQLSources {
+		if src.Schedule == "" {
+			continue
+		}
+		w := ExtractWork{
+			WatchDirectoryId: scheduleWorkPrefix + src.Name,
+			WatchDirName:     src.Name,
+			Scheme:           config.SQLScheme,
+			FilePath:         src.Name,
+			Tablename:        src.Tablename,
+		}
+		err := s.Scheduler.Add(ScheduledSource{Name: src.Name, Kind: ScheduleKindSQL, Cron: src.Schedule, Run: s.scheduledWork(w)})
+		if err != nil {
+			s.logger.Errorf("error in sql source %s %s\n", src.Name, err.Error())
+		}
+	}
+	client := &http.Client{Timeout: 10 * time.Minute}
+	for _, src := range s.Pi.Spec.FileSources {
+		src := src
+		err := s.Scheduler.Add(ScheduledSource{Name: src.Name, Kind: ScheduleKindFile, Cron: src.Schedule, Run: func() error {
+			path, err := copyFileSource(src, client, time.Now())
+			if err == nil {
+				s.logger.Infof("file source %s copied to %s\n", src.Name, path)
+			}
+			return err
+		}})
+		if err != nil {
+			s.logger.Errorf("error in file source %s %s\n", src.Name, err.Error())
+		}
+	}
 
+	if s.Scheduler.Len() > 0 {
+		s.logger.Infof("scheduled sources %d\n", s.Scheduler.Len())
+		go s.Scheduler.Run(context.Background())
+	}
 }
 
-func getTable(scheme string, dirs []WatchDirectory) (string, error) {
-	for _, dir := range dirs {
-		if dir.Scheme == scheme {
-			return dir.Tablename, nil
+// scheduledWork returns a run queuing a copy of w, the run lasts
+// until the extraction finishes so that the scheduler neither starts
+// it again meanwhile nor reports it ok before it loaded
+func (s *Server) scheduledWork(w ExtractWork) func() error {
+	return func() error {
+		work := w
+		work.Id = xid.New().String()
+		done := s.awaitOutcome(work.Id)
+		err := s.enqueueExtract(work)
+		if err != nil {
+			s.outcomeArrived(ExtractOutcome{WorkId: work.Id, Status: OutcomeFailed})
+			return err
+		}
+
+		o := <-done
+		if o.Status != OutcomeSucceeded {
+			return fmt.Errorf("extraction of %s %s", work.WatchDirName, o.Status)
 		}
+		return nil
 	}
-	return "", fmt.Errorf("could not find right scheme %s in churro config", scheme)
 }
 
-func (s *Server) createExtractPod(scheme string, filePath string, cfg v1alpha1.Pipeline, tableName, watchDirName string) error {
-	ns := os.Getenv("CHURRO_NAMESPACE")
-	pipelineName := os.Getenv("CHURRO_PIPELINE")
-	imageName := "registry.gitlab.com/churro-group/churro/churro-extract"
-	ctx := context.TODO()
-
-	// TODO cleanup this selection logic as its redundant
+// awaitOutcome returns the channel the final outcome of the work
+// with id is sent on
+func (s *Server) awaitOutcome(id string) <-chan ExtractOutcome {
+	done := make(chan ExtractOutcome, 1)
+	s.awaitMu.Lock()
+	defer s.awaitMu.Unlock()
+	if s.awaiting == nil {
+		s.awaiting = make(map[string]chan ExtractOutcome)
+	}
+	s.awaiting[id] = done
+	return done
+}
 
-	switch scheme {
-	case config.FinnHubScheme:
-	case config.XMLScheme:
-	case config.CSVScheme:
-	case config.JSONScheme:
-	case config.JSONPathScheme:
-	case config.XLSXScheme:
-		s.logger.Debugf("scheme used for extract job %s\n", scheme)
-	default:
-		return fmt.Errorf("%s scheme is not recognized", scheme)
+// outcomeArrived hands the final outcome of a work to the scheduled
+// run waiting on it if any
+func (s *Server) outcomeArrived(o ExtractOutcome) {
+	if o.Status == OutcomeRetried {
+		return
 	}
+	s.awaitMu.Lock()
+	defer s.awaitMu.Unlock()
+	if done, ok := s.awaiting[o.WorkId]; ok {
+		delete(s.awaiting, o.WorkId)
+		done <- o
+	}
+}
 
-	client, err := GetKubeClient("")
+// remoteSeen reports whether a version of a remote file was
+// already loaded
+func (s *Server) remoteSeen(path, etag string) (bool, error) {
+	return dataprov.ObjectSeen(path, etag, s.Pi, s.UserDBCreds)
+}
+
+func (s *Server) startWatching() {
+	notifyWatcher, err := NewNotifyWatcher(s.logger)
 	if err != nil {
-		return err
+		s.logger.Errorf("error in watcher %s\n", err.Error())
+		os.Exit(1)
 	}
+	defer notifyWatcher.Close()
 
-	pod := getPodDefinition(filePath, tableName, scheme, rand.String(4), ns, imageName, pipelineName, watchDirName)
-	s.logger.Debugf("creating pod %s\n", pod.Name)
+	pollWatcher := NewPollWatcher(s.queueDB, s.logger)
+	defer pollWatcher.Close()
 
-	pod, err = client.CoreV1().Pods(ns).Create(ctx, pod, metav1.CreateOptions{})
-	if err != nil {
-		return err
+	done := make(chan bool)
+
+	for _, watcher := range []FileWatcher{notifyWatcher, pollWatcher} {
+		go s.handleFileEvents(watcher)
 	}
 
-	return nil
+	s.createWatchedDirectories(notifyWatcher, pollWatcher)
+
+	go s.startQueue()
+
+	go s.startPruning()
+
+	go s.startResuming()
+
+	<-done
+
 }
 
-// getPodDefinition fills out a Pod definition
-func getPodDefinition(filePath, tableName, scheme, suffix, namespace, imageName, pipelineName, watchDirName string) *v1.Pod {
-	entrypoint := []string{
-		"/usr/local/bin/churro-extract",
-		"-servicecert",
-		"/servicecerts",
-		"-dbcert",
-		"/dbcerts",
-		"-debug",
-		"true",
-	}
-
-	var mode int32
-	//mode = 0620
-	mode = 256
-
-	return &v1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("churro-extract-%s", suffix),
-			Namespace: namespace,
-			Labels: map[string]string{
-				"app":     "churro",
-				"service": "churro-extract",
-			},
-		},
-		Spec: v1.PodSpec{
-			ServiceAccountName: "churro",
-			RestartPolicy:      v1.RestartPolicyNever,
-			Containers: []v1.Container{
-				{
-					Name:            "churro-extract",
-					Image:           imageName,
-					ImagePullPolicy: v1.PullIfNotPresent,
-					Command:         entrypoint,
-					VolumeMounts: []v1.VolumeMount{
-						{
-							MountPath: "/dbcerts",
-							Name:      "db-certs",
-							ReadOnly:  true,
-						},
-						{
-							MountPath: "/servicecerts",
-							Name:      "service-certs",
-							ReadOnly:  true,
-						},
-						{
-							MountPath: "/churro",
-							Name:      "churrodata",
-							ReadOnly:  false,
-						},
-					},
-					Env: []v1.EnvVar{
-						{
-							Name: "CHURRO_NAMESPACE",
-							ValueFrom: &v1.EnvVarSource{
-								FieldRef: &v1.ObjectFieldSelector{
-									FieldPath: "metadata.namespace",
-								},
-							},
-						},
-						{
-							Name:  "CHURRO_PIPELINE",
-							Value: pipelineName,
-						},
-						{
-							Name:  "CHURRO_FILENAME",
-							Value: filePath,
-						},
-						{
-							Name:  "CHURRO_SCHEME",
-							Value: scheme,
-						},
-						{
-							Name:  "CHURRO_WATCHDIR_NAME",
-							Value: watchDirName,
-						},
-						{
-							Name:  "CHURRO_TABLENAME",
-							Value: tableName,
-						},
-					},
-				},
-			},
-			Volumes: []v1.Volume{
-				{
-					Name: "db-certs",
-					VolumeSource: v1.VolumeSource{
-						Secret: &v1.SecretVolumeSource{
-							SecretName:  "cockroachdb.client.root",
-							DefaultMode: &mode,
-						},
-					},
-				},
-				{
-					Name: "service-certs",
-					VolumeSource: v1.VolumeSource{
-						Secret: &v1.SecretVolumeSource{
-							SecretName: "churro.client.root",
-						},
-					},
-				},
-				{
-					Name: "churrodata",
-					VolumeSource: v1.VolumeSource{
-						PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
-							ClaimName: "churrodata",
-						},
-					},
-				},
-			},
-		},
+// handleFileEvents queues extractions for the files reported by
+// a watcher
+func (s *Server) handleFileEvents(watcher FileWatcher) {
+	for filePath := range watcher.Events() {
+		// the duplicate check waits for the file to be completely
+		// written so files are queued independently of each other
+		go func(filePath string) {
+			err := s.queueExtractForNewFile(filePath)
+			if err != nil {
+				s.logger.Error(err.Error())
+			}
+		}(filePath)
 	}
 }
 
+func getTable(scheme string, dirs []WatchDirectory) (string, error) {
+	for _, dir := range dirs {
+		if dir.Scheme == scheme {
+			return dir.Tablename, nil
+		}
+	}
+	return "", fmt.Errorf("could not find right scheme %s in churro config", scheme)
+}
+
 func GetKubeClient(kubeconfig string) (client kubernetes.Interface, err error) {
 
 	/**
@@ -309,7 +424,22 @@ func GetKubeClient(kubeconfig string) (client kubernetes.Interface, err error) {
 	return clientset, err
 }
 
-func (s *Server) createWatchedDirectories(watcher *fsnotify.Watcher) {
+// GetSecretValue reads a key of a secret in the pipeline namespace
+func GetSecretValue(name, key string) (string, error) {
+	client, err := GetKubeClient("")
+	if err != nil {
+		return "", err
+	}
+
+	ns := os.Getenv("CHURRO_NAMESPACE")
+	secret, err := client.CoreV1().Secrets(ns).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(secret.Data[key])), nil
+}
+
+func (s *Server) createWatchedDirectories(notifyWatcher, pollWatcher FileWatcher) {
 
 	// TODO get the list of watched directories from the database to
 	// bootstrap the watching process
@@ -342,8 +472,26 @@ func (s *Server) createWatchedDirectories(watcher *fsnotify.Watcher) {
 			}
 		}
 		_, err = os.Stat(dir.Path)
-		if err == nil {
-			err = watcher.Add(dir.Path)
+		if err == nil && dir.WatchMode == WatchModeTail {
+			// followed files are read by a long running extractor
+			// that is supervised like a socket
+			err = s.Sockets.AddTail(v1alpha1.WatchSocket{
+				Name:      dir.Name,
+				Path:      dir.Path,
+				Scheme:    config.TailScheme,
+				Tablename: dir.Tablename,
+			})
+			if err != nil {
+				s.logger.Errorf("error following %s %s\n", dir.Path, err.Error())
+			} else {
+				s.logger.Infof("following files in %s\n", dir.Path)
+			}
+		} else if err == nil {
+			var watcher FileWatcher = notifyWatcher
+			if dir.WatchMode == WatchModePoll {
+				watcher = pollWatcher
+			}
+			err = watcher.Add(dir)
 			if err != nil {
 				s.logger.Errorf("error adding watch path %s %s", dir.Path, err.Error())
 			} else {
@@ -353,14 +501,30 @@ func (s *Server) createWatchedDirectories(watcher *fsnotify.Watcher) {
 	}
 }
 
-func (s *Server) createExtractPodForNewFile(filePath string) error {
+// queueExtractForNewFile queues an extraction for each watch
+// directory whose regex matches the new file
+func (s *Server) queueExtractForNewFile(filePath string) error {
+
+	// files renamed or compressed after processing land back in
+	// the watch directory and must not be extracted again, partial
+	// downloads are extracted once renamed into place
+	if Processed(filePath) {
+		return nil
+	}
 
 	dirs := s.WatchDirectories
 
+	// the file is checked for duplicates at most once, and only
+	// when a watch directory matches
+	var prev dataprov.DataProvenance
+	var duplicate, checked bool
+
 	for i := 0; i < len(dirs); i++ {
+		if dirs[i].WatchMode == WatchModeTail {
+			continue
+		}
 		regex := dirs[i].Regex
 		scheme := dirs[i].Scheme
-		watchDirName := dirs[i].Name
 		s.logger.Infof("scheme %s %s\n", scheme, regex)
 		match, err := regexp.Match(regex, []byte(filePath))
 		if err != nil {
@@ -375,9 +539,39 @@ func (s *Server) createExtractPodForNewFile(filePath string) error {
 				return err
 			}
 
-			err = s.createExtractPod(scheme, filePath, s.Pi, tableName, watchDirName)
+			w := ExtractWork{
+				WatchDirectoryId: dirs[i].Id,
+				WatchDirName:     dirs[i].Name,
+				Scheme:           scheme,
+				FilePath:         filePath,
+				Tablename:        tableName,
+				Priority:         dirs[i].Priority,
+			}
+			if f, ok := s.downloads.get(filePath); ok {
+				w.SourcePath = f.Path
+				w.SourceVersion = f.Version
+			}
+
+			if !checked {
+				checked = true
+				prev, duplicate, err = s.findDuplicate(filePath)
+				if err != nil {
+					s.logger.Errorf("error checking %s for duplicates %s\n", filePath, err.Error())
+				}
+			}
+			if duplicate {
+				policy, decision := duplicateDecision(dirs[i], prev)
+				if policy == DuplicateSkip {
+					s.skipDuplicate(dirs[i], filePath, decision)
+					continue
+				}
+				w.Duplicate = policy
+				w.Decision = decision
+			}
+
+			err = s.enqueueExtract(w)
 			if err != nil {
-				s.logger.Errorf("error in createExtractPod %s\n", err.Error())
+				s.logger.Errorf("error in enqueueExtract %s\n", err.Error())
 				return err
 			}
 		}
@@ -385,6 +579,162 @@ func (s *Server) createExtractPodForNewFile(filePath string) error {
 	return nil
 }
 
+// enqueueExtract persists the work to the admin database and
+// adds it to the in-memory work queue
+func (s *Server) enqueueExtract(w ExtractWork) error {
+	if s.queueDB != nil {
+		err := w.Create(s.queueDB)
+		if err != nil {
+			return err
+		}
+	}
+	s.Queue.Push(w)
+	s.logger.Infof("queued extract %s for %s, %d queued\n", w.Id, w.FilePath, s.Queue.Len())
+	return nil
+}
+
+// startQueue reloads any work that was queued before a restart
+// and then starts extractions as capacity allows
+func (s *Server) startQueue() {
+	if s.queueDB != nil {
+		pending, err := GetExtractWork(s.queueDB)
+		if err != nil {
+			s.logger.Errorf("error getting queued extracts %s\n", err.Error())
+		}
+		for _, w := range pending {
+			s.Queue.Push(w)
+		}
+		s.logger.Infof("queued extracts restored %d\n", len(pending))
+	}
+
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.dispatchQueue()
+	}
+}
+
+// dispatchQueue starts as many queued extractions as the pipeline
+// and watch directory limits allow
+func (s *Server) dispatchQueue() {
+	if s.Queue.Len() == 0 {
+		return
+	}
+
+	running, err := s.Executor.Running()
+	if err != nil {
+		s.logger.Errorf("error counting running extracts %s\n", err.Error())
+		return
+	}
+
+	limits := make(map[string]int)
+	for _, dir := range s.WatchDirectories {
+		limits[dir.Id] = dir.MaxConcurrent
+	}
+
+	for {
+		w, ok := s.Queue.Next(running, limits)
+		if !ok {
+			return
+		}
+
+		err := validScheme(w.Scheme)
+		if err != nil {
+			s.logger.Errorf("dropping queued extract %s %s\n", w.FilePath, err.Error())
+			s.removeQueued(w)
+			s.outcomeArrived(ExtractOutcome{WorkId: w.Id, Status: OutcomeFailed})
+			continue
+		}
+
+		err = s.Executor.Start(w)
+		if err != nil {
+			// leave the work queued and try again on the next tick
+			s.logger.Errorf("error starting extract %s\n", err.Error())
+			s.Queue.Push(w)
+			return
+		}
+		s.removeQueued(w)
+		running[w.WatchDirectoryId]++
+	}
+}
+
+// startPruning periodically removes archived files that are past
+// their watch directory retention period
+func (s *Server) startPruning() {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, dir := range s.WatchDirectories {
+			removed, err := PruneArchive(dir, time.Now())
+			if err != nil {
+				s.logger.Errorf("error pruning archive of %s %s\n", dir.Name, err.Error())
+				continue
+			}
+			if removed > 0 {
+				s.logger.Infof("pruned %d archive days from %s\n", removed, dir.ArchiveDir())
+			}
+		}
+	}
+}
+
+// quarantine moves the file of an extraction whose last attempt
+// failed out of its watch directory, the extractor leaves a failed
+// file in place so that a retry of the job still finds it
+func (s *Server) quarantine(o ExtractOutcome) {
+	for _, dir := range s.WatchDirectories {
+		if dir.Id != o.WatchDirectoryId {
+			continue
+		}
+		if _, err := os.Stat(o.FilePath); err != nil {
+			return
+		}
+		newPath, err := DisposeFile(dir, o.FilePath, true, time.Now())
+		if err != nil {
+			s.logger.Errorf("error quarantining %s %s\n", o.FilePath, err.Error())
+			return
+		}
+		s.logger.Infof("quarantined %s new path %s\n", o.FilePath, newPath)
+		return
+	}
+}
+
+// removeQueued removes started or invalid work from the admin
+// database so it is not restored after a restart
+func (s *Server) removeQueued(w ExtractWork) {
+	if s.queueDB == nil {
+		return
+	}
+	err := w.Delete(s.queueDB)
+	if err != nil {
+		s.logger.Errorf("error removing queued extract %s %s\n", w.Id, err.Error())
+	}
+}
+
+// recordOutcomes stores the outcome of each finished extraction
+// in the admin database as the file history
+func (s *Server) recordOutcomes() {
+	for o := range s.Executor.Outcomes() {
+		s.logger.Infof("extract %s for %s %s\n", o.Id, o.FilePath, o.Status)
+		if isSocketWork(o.WatchDirectoryId) {
+			s.Sockets.Exited(o)
+			continue
+		}
+		if o.Status == OutcomeFailed {
+			s.quarantine(o)
+		}
+		if o.Status != OutcomeRetried {
+			s.downloads.remove(o.FilePath)
+		}
+		s.outcomeArrived(o)
+		if s.queueDB == nil {
+			continue
+		}
+		err := o.Upsert(s.queueDB)
+		if err != nil {
+			s.logger.Errorf("error recording outcome of %s %s\n", o.Id, err.Error())
+		}
+	}
+}
 func (s *Server) CreateWatchDirectory(ctx context.Context, req *pb.CreateWatchDirectoryRequest) (response *pb.CreateWatchDirectoryResponse, err error) {
 
 	resp := &pb.CreateWatchDirectoryResponse{}
@@ -417,3 +767,86 @@ func (s *Server) DeleteWatchDirectory(ctx context.Context, req *pb.DeleteWatchDi
 
 	return resp, nil
 }
+
+// GetSocketStatus returns the state of each supervised socket
+func (s *Server) GetSocketStatus(ctx context.Context, req *pb.GetSocketStatusRequest) (response *pb.GetSocketStatusResponse, err error) {
+
+	resp := &pb.GetSocketStatusResponse{}
+
+	b, err := json.Marshal(s.Sockets.Status())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	resp.SocketsString = string(b)
+
+	return resp, nil
+}
+
+// CreateWatchSocket starts supervising a socket while churro-watch
+// is running
+func (s *Server) CreateWatchSocket(ctx context.Context, req *pb.CreateWatchSocketRequest) (response *pb.CreateWatchSocketResponse, err error) {
+
+	resp := &pb.CreateWatchSocketResponse{}
+	var socket v1alpha1.WatchSocket
+
+	err = yaml.Unmarshal([]byte(req.ConfigString), &socket)
+	if err != nil {
+		s.logger.Errorf("error CreateWatchSocket %s\n", err.Error())
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	err = s.Sockets.Add(socket)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	// save the socket so it is watched again after a restart
+	_, err = internal.UpdatePipeline(func(p *v1alpha1.Pipeline) {
+		p.Spec.WatchSockets = append(withoutSocket(p.Spec.WatchSockets, socket.Name), socket)
+	})
+	if err != nil {
+		s.logger.Errorf("error saving socket %s %s\n", socket.Name, err.Error())
+		if rerr := s.Sockets.Remove(socket.Name); rerr != nil {
+			s.logger.Errorf("error removing socket %s %s\n", socket.Name, rerr.Error())
+		}
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+// DeleteWatchSocket stops a socket and its extractor
+func (s *Server) DeleteWatchSocket(ctx context.Context, req *pb.DeleteWatchSocketRequest) (response *pb.DeleteWatchSocketResponse, err error) {
+
+	resp := &pb.DeleteWatchSocketResponse{}
+
+	if req.SocketName == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "socket name is empty")
+	}
+
+	err = s.Sockets.Remove(req.SocketName)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, err.Error())
+	}
+
+	_, err = internal.UpdatePipeline(func(p *v1alpha1.Pipeline) {
+		p.Spec.WatchSockets = withoutSocket(p.Spec.WatchSockets, req.SocketName)
+	})
+	if err != nil {
+		s.logger.Errorf("error saving socket removal %s %s\n", req.SocketName, err.Error())
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	return resp, nil
+}
+
+// withoutSocket returns sockets less the one with the given name
+func withoutSocket(sockets []v1alpha1.WatchSocket, name string) []v1alpha1.WatchSocket {
+	kept := make([]v1alpha1.WatchSocket, 0, len(sockets))
+	for _, socket := range sockets {
+		if socket.Name != name {
+			kept = append(kept, socket)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,109 @@
+package watch
+
+import (
+	"container/heap"
+	"sync"
+)
+
+const (
+	// DEFAULT_MAX_EXTRACTS is the pipeline wide cap on running
+	// extractions when the pipeline does not specify one
+	DEFAULT_MAX_EXTRACTS = 10
+)
+
+// WorkQueue holds the extractions waiting to be started, ordered
+// by priority and then by the time they were queued
+type WorkQueue struct {
+	mu            sync.Mutex
+	pending       workHeap
+	MaxConcurrent int
+}
+
+// NewWorkQueue creates an empty work queue that allows at most
+// maxConcurrent extractions to run at once
+func NewWorkQueue(maxConcurrent int) *WorkQueue {
+	if maxConcurrent <= 0 {
+		maxConcurrent = DEFAULT_MAX_EXTRACTS
+	}
+	return &WorkQueue{MaxConcurrent: maxConcurrent}
+}
+
+// Push adds work to the queue
+func (q *WorkQueue) Push(w ExtractWork) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	heap.Push(&q.pending, w)
+}
+
+// Len returns the number of queued extractions
+func (q *WorkQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending.Len()
+}
+
+// Next removes and returns the highest priority work that can be
+// started given the extractions currently running per watch
+// directory id and the per watch directory limits, a limit of
+// zero means the directory is only bound by the pipeline limit.
+// Socket extractors run until stopped so they do not count
+// against the pipeline limit
+func (q *WorkQueue) Next(running map[string]int, limits map[string]int) (ExtractWork, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	total := 0
+	for k, v := range running {
+		if isSocketWork(k) {
+			continue
+		}
+		total += v
+	}
+	if total >= q.MaxConcurrent {
+		return ExtractWork{}, false
+	}
+
+	// work for directories at their limit is set aside and
+	// put back once we find something that can run
+	skipped := make([]ExtractWork, 0)
+	defer func() {
+		for _, w := range skipped {
+			heap.Push(&q.pending, w)
+		}
+	}()
+
+	for q.pending.Len() > 0 {
+		w := heap.Pop(&q.pending).(ExtractWork)
+		limit := limits[w.WatchDirectoryId]
+		if limit > 0 && running[w.WatchDirectoryId] >= limit {
+			skipped = append(skipped, w)
+			continue
+		}
+		return w, true
+	}
+
+	return ExtractWork{}, false
+}
+
+type workHeap []ExtractWork
+
+func (h workHeap) Len() int { return len(h) }
+
+func (h workHeap) Less(i, j int) bool {
+	if h[i].Priority != h[j].Priority {
+		return h[i].Priority > h[j].Priority
+	}
+	return h[i].CreatedTime.Before(h[j].CreatedTime)
+}
+
+func (h workHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *workHeap) Push(x interface{}) { *h = append(*h, x.(ExtractWork)) }
+
+func (h *workHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	w := old[n-1]
+	*h = old[:n-1]
+	return w
+}
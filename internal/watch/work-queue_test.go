@@ -0,0 +1,63 @@
+package watch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkQueue(t *testing.T) {
+	now := time.Now()
+
+	t.Run("PriorityThenAge", func(t *testing.T) {
+		q := NewWorkQueue(10)
+		q.Push(ExtractWork{Id: "old", WatchDirectoryId: "dir1", CreatedTime: now})
+		q.Push(ExtractWork{Id: "new", WatchDirectoryId: "dir1", CreatedTime: now.Add(time.Second)})
+		q.Push(ExtractWork{Id: "urgent", WatchDirectoryId: "dir1", Priority: 5, CreatedTime: now.Add(2 * time.Second)})
+
+		for _, want := range []string{"urgent", "old", "new"} {
+			w, ok := q.Next(map[string]int{}, map[string]int{})
+			if !ok || w.Id != want {
+				t.Fatalf("expected %s, got %s %v", want, w.Id, ok)
+			}
+		}
+		if _, ok := q.Next(map[string]int{}, map[string]int{}); ok {
+			t.Fatal("expected an empty queue")
+		}
+	})
+
+	t.Run("PipelineLimit", func(t *testing.T) {
+		q := NewWorkQueue(2)
+		q.Push(ExtractWork{Id: "a", WatchDirectoryId: "dir1", CreatedTime: now})
+		if _, ok := q.Next(map[string]int{"dir1": 1, "dir2": 1}, map[string]int{}); ok {
+			t.Fatal("expected the pipeline limit to hold the work")
+		}
+		if q.Len() != 1 {
+			t.Fatalf("expected the work to stay queued, got %d", q.Len())
+		}
+	})
+
+	t.Run("DirectoryLimit", func(t *testing.T) {
+		q := NewWorkQueue(10)
+		q.Push(ExtractWork{Id: "busy", WatchDirectoryId: "dir1", Priority: 1, CreatedTime: now})
+		q.Push(ExtractWork{Id: "free", WatchDirectoryId: "dir2", CreatedTime: now})
+
+		w, ok := q.Next(map[string]int{"dir1": 1}, map[string]int{"dir1": 1})
+		if !ok || w.Id != "free" {
+			t.Fatalf("expected the work of the directory under its limit, got %s %v", w.Id, ok)
+		}
+		if q.Len() != 1 {
+			t.Fatalf("expected the skipped work to be put back, got %d", q.Len())
+		}
+	})
+
+	t.Run("SocketsDoNotCount", func(t *testing.T) {
+		q := NewWorkQueue(1)
+		q.Push(ExtractWork{Id: "file", WatchDirectoryId: "dir1", CreatedTime: now})
+
+		running := map[string]int{socketWorkId("stocks"): 1, socketWorkId("feed"): 1}
+		w, ok := q.Next(running, map[string]int{})
+		if !ok || w.Id != "file" {
+			t.Fatalf("expected running sockets to leave room for file work, got %s %v", w.Id, ok)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+// Package ingestclient writes records to a churro pipeline through
+// the Ingest gRPC service of churro-watch
+package ingestclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/xid"
+	pb "gitlab.com/churro-group/churro/rpc/ingest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// Client is a connection to a pipeline's Ingest service for one
+// ingest source
+type Client struct {
+	conn   *grpc.ClientConn
+	client pb.IngestClient
+	source string
+	token  string
+}
+
+// Dial connects to the Ingest service at target, e.g.
+// churro-watch.pipeline1:8090, trusting the service certificate in
+// certFile and authenticating with the ingest source's token
+func Dial(target, certFile, source, token string) (*Client, error) {
+	creds, err := credentials.NewClientTLSFromFile(certFile, "")
+	if err != nil {
+		return nil, fmt.Errorf("could not process the credentials: %v", err)
+	}
+
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(conn, source, token), nil
+}
+
+// NewClient creates a client on an existing connection
+func NewClient(conn *grpc.ClientConn, source, token string) *Client {
+	return &Client{
+		conn:   conn,
+		client: pb.NewIngestClient(conn),
+		source: source,
+		token:  token,
+	}
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Writer streams batches of records, the acks of all batches are
+// returned by Close
+type Writer struct {
+	source string
+	stream pb.Ingest_WriteRecordsClient
+}
+
+// NewWriter starts a WriteRecords stream
+func (c *Client) NewWriter(ctx context.Context) (*Writer, error) {
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+	stream, err := c.client.WriteRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{source: c.source, stream: stream}, nil
+}
+
+// Write sends a batch of rows for table, an empty table writes to
+// the ingest source's table and any other must be one of the source's
+// tables, the returned batch id identifies the batch's ack
+func (w *Writer) Write(table string, columns []string, rows [][]string) (string, error) {
+	req := &pb.WriteRecordsRequest{
+		Source:  w.source,
+		BatchId: xid.New().String(),
+		Table:   table,
+		Columns: columns,
+		Rows:    make([]*pb.Row, 0, len(rows)),
+	}
+	for _, r := range rows {
+		req.Rows = append(req.Rows, &pb.Row{Values: r})
+	}
+
+	err := w.stream.Send(req)
+	if err != nil {
+		return "", err
+	}
+	return req.BatchId, nil
+}
+
+// Close ends the stream and returns the ack of each batch, a batch
+// that was not loaded has its Error set
+func (w *Writer) Close() ([]*pb.BatchAck, error) {
+	resp, err := w.stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Acks, nil
+}